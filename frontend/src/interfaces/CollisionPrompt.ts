@@ -0,0 +1,5 @@
+export interface CollisionPrompt {
+  id: string;
+  fileName: string;
+  dir: string;
+}
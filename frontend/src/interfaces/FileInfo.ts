@@ -3,4 +3,9 @@ export interface FileInfo {
   port: string;
   tcp: boolean;
   paths: string[];
+  windowSize: number;
+  selectiveRepeat: boolean;
+  reliableUDP: boolean;
+  hashAlgorithm: string;
+  congestionControl: string;
 }
\ No newline at end of file
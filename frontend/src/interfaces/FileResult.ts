@@ -0,0 +1,8 @@
+import type { TransferStats } from "./TransferStats.js";
+
+export interface FileResult {
+  name: string;
+  status: 'verified' | 'sent' | 'skipped' | 'rejected' | 'failed';
+  message?: string;
+  stats?: TransferStats;
+}
\ No newline at end of file
@@ -0,0 +1,5 @@
+export interface ListenSettings {
+  address: string;
+  tcpPort: number;
+  udpPort: number;
+}
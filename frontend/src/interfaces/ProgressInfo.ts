@@ -1,3 +1,5 @@
+import type { TransferStats } from "./TransferStats.js";
+
 export interface ProgressInfo {
   visible: boolean;
   fileName: string;
@@ -5,5 +7,11 @@ export interface ProgressInfo {
   totalFiles: number;
   sent: number;
   total: number;
+  bytes?: number;
+  totalBytes?: number;
   arqs?: number;
+  // Últimas ventanas de congestión informadas por el emisor, en segmentos
+  cwnd?: number[];
+  // Últimas estadísticas de la transferencia
+  stats?: TransferStats;
 }
\ No newline at end of file
@@ -0,0 +1,13 @@
+export interface OfferedFile {
+  name: string;
+  size: number;
+  mimeType: string;
+}
+
+export interface TransferRequest {
+  id: string;
+  sender: string;
+  peerName: string;
+  files: OfferedFile[];
+  totalSize: number;
+}
@@ -0,0 +1,22 @@
+export interface TransferStats {
+  file: string;
+  bytes: number;
+  totalBytes: number;
+  elapsedMs: number;
+  // Bytes por segundo: en el enlace (con retransmisiones), útiles y del último intervalo
+  throughputBps: number;
+  goodputBps: number;
+  currentBps: number;
+  // -1 mientras no se pueda estimar
+  etaMs: number;
+  // Solo los mide el emisor
+  rttMinMs?: number;
+  rttAvgMs?: number;
+  rttMaxMs?: number;
+  retransmissions: number;
+  timeouts: number;
+  duplicates: number;
+  outOfOrder: number;
+  corrupt: number;
+  done: boolean;
+}
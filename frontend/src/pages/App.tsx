@@ -2,28 +2,142 @@ import { useState, useRef, useEffect } from "react";
 import type { FileInfo } from "../interfaces/FileInfo.js";
 import type { ProgressInfo } from "../interfaces/ProgressInfo.js";
 import type { EventMessage } from "../interfaces/EventMessage.js";
+import type { ListenSettings } from "../interfaces/ListenSettings.js";
+import type { CollisionPrompt } from "../interfaces/CollisionPrompt.js";
+import type { TransferRequest } from "../interfaces/TransferRequest.js";
+import type { FileResult } from "../interfaces/FileResult.js";
+import type { TransferStats } from "../interfaces/TransferStats.js";
 import "../styles/App.css";
 import { Icon } from "@iconify/react";
 import {
   EventsOn,
   EventsOff,
 } from "../../wailsjs/runtime/runtime.js";
-import { SendFileHandler, ToggleDowntime } from "../../wailsjs/go/server/Client.js";
 import {
+  ClearScenario,
+  GetImpairment,
+  LoadScenario,
+  SendFileHandler,
+  SetImpairment,
+  ToggleCorruption,
+  ToggleDowntime,
+} from "../../wailsjs/go/server/Client.js";
+import {
+  AcceptTransfer,
+  ClearScenario as ClearServerScenario,
+  GetAutoAccept,
+  GetCollisionPolicy,
+  GetImpairment as GetServerImpairment,
+  GetMismatchAction,
+  GetReceiveDir,
+  LoadScenario as LoadServerScenario,
   ReceiveFileHandler,
+  RejectTransfer,
+  ResolveCollision,
+  SetAutoAccept,
+  SetCollisionPolicy,
+  SetImpairment as SetServerImpairment,
+  SetMismatchAction,
+  SetReceiveDir,
   StopServerHandler,
+  ToggleCorruption as ToggleServerCorruption,
   ToggleDowntime as ToggleServerDowntime,
 } from "../../wailsjs/go/server/Server.js";
-import { SelectFile, GetLocalIP } from "../../wailsjs/go/app/App.js";
+import {
+  SelectFile,
+  SelectDirectory,
+  SelectScenario,
+  GetLocalIP,
+} from "../../wailsjs/go/app/App.js";
+import { impair, server } from "../../wailsjs/go/models.js";
+
+// Cantidad de archivos de una solicitud que se listan antes de resumir el resto.
+const MAX_LISTED_FILES = 5;
+
+// Ícono, color y texto de cada resultado de un envío.
+const RESULT_STYLES: Record<FileResult["status"], { icon: string; color: string; label: string }> = {
+  verified: { icon: "mdi:check-decagram", color: "text-success", label: "Verificado" },
+  sent: { icon: "mdi:check", color: "text-info", label: "Enviado" },
+  skipped: { icon: "mdi:skip-next", color: "text-base-content/70", label: "Omitido" },
+  rejected: { icon: "mdi:cancel", color: "text-warning", label: "Rechazado" },
+  failed: { icon: "mdi:alert-circle", color: "text-error", label: "Dañado" },
+};
+
+// Parámetros del simulador de red, en el orden en que se muestran.
+const IMPAIRMENT_FIELDS: { key: keyof impair.Config; label: string; unit: string; max: number }[] = [
+  { key: "lossPercent", label: "Pérdida", unit: "%", max: 100 },
+  { key: "burstPercent", label: "Ráfagas de pérdida", unit: "%", max: 100 },
+  { key: "burstLength", label: "Largo de las ráfagas", unit: "segm.", max: 1000 },
+  { key: "delayMs", label: "Demora", unit: "ms", max: 10000 },
+  { key: "jitterMs", label: "Variación de la demora", unit: "ms", max: 10000 },
+  { key: "duplicatePercent", label: "Duplicados", unit: "%", max: 100 },
+  { key: "reorderPercent", label: "Desorden", unit: "%", max: 100 },
+  { key: "corruptPercent", label: "Errores de bits", unit: "%", max: 100 },
+  { key: "bandwidthKbps", label: "Ancho de banda (0 = sin límite)", unit: "kbit/s", max: 10000000 },
+];
+
+// Cantidad de muestras de la ventana de congestión que se grafican.
+const MAX_CWND_POINTS = 300;
+
+// Puntos de la polilínea que grafica la ventana de congestión en un área de 100x40.
+const cwndPoints = (cwnd: number[]) => {
+  const top = Math.max(...cwnd, 1);
+  const step = 100 / Math.max(cwnd.length - 1, 1);
+  return cwnd.map((w, i) => `${(i * step).toFixed(2)},${(40 - (w / top) * 38).toFixed(2)}`).join(" ");
+};
+
+const formatSize = (bytes: number) => {
+  const units = ["B", "KB", "MB", "GB", "TB"];
+  let value = bytes;
+  let unit = 0;
+  while (value >= 1024 && unit < units.length - 1) {
+    value /= 1024;
+    unit++;
+  }
+  return `${unit === 0 ? value : value.toFixed(1)} ${units[unit]}`;
+};
+
+const formatDuration = (ms: number) => {
+  const seconds = Math.round(ms / 1000);
+  return seconds < 60 ? `${seconds} s` : `${Math.floor(seconds / 60)} min ${seconds % 60} s`;
+};
+
+// Resumen de una transferencia en una línea, para el registro de eventos.
+const statsSummary = (st: TransferStats) => {
+  let text = `${st.file}: ${formatSize(st.goodputBps)}/s en ${formatDuration(st.elapsedMs)}`;
+  if (st.rttAvgMs) {
+    text += `, RTT ${st.rttMinMs?.toFixed(1)}/${st.rttAvgMs.toFixed(1)}/${st.rttMaxMs?.toFixed(1)} ms`;
+  }
+  return `${text}, ${st.retransmissions} retransmisiones, ${st.timeouts} timeouts, ${st.duplicates} duplicados, ${st.outOfOrder} desordenados, ${st.corrupt} dañados`;
+};
+
 function App() {
   const [recibir, setRecibir] = useState(false);
   const [serverOn, setServerOn] = useState(false);
+  const [listenSettings, setListenSettings] = useState<ListenSettings>({
+    address: "",
+    tcpPort: 8080,
+    udpPort: 8080,
+  });
+  const [listenInfo, setListenInfo] = useState<server.ListenInfo | null>(null);
+  const [receiveDir, setReceiveDir] = useState("");
+  const [collisionPolicy, setCollisionPolicy] = useState("overwrite");
+  const [mismatchAction, setMismatchAction] = useState("quarantine");
+  const [collisions, setCollisions] = useState<CollisionPrompt[]>([]);
+  const [autoAccept, setAutoAccept] = useState(false);
+  const [requests, setRequests] = useState<TransferRequest[]>([]);
   const [enviando, setEnviando] = useState(false);
+  const [results, setResults] = useState<FileResult[]>([]);
   const [fileInfo, setFileInfo] = useState<FileInfo>({
     address: "",
     port: "8080",
     tcp: true,
     paths: [],
+    windowSize: 1,
+    selectiveRepeat: false,
+    reliableUDP: false,
+    hashAlgorithm: "md5",
+    congestionControl: "reno",
   });
   const [events, setEvents] = useState<EventMessage[]>([]);
   const [progress, setProgress] = useState<ProgressInfo>({
@@ -35,6 +149,12 @@ function App() {
     total: 100,
   });
   const [isDowntime, setIsDowntime] = useState(false);
+  const [isCorrupting, setIsCorrupting] = useState(false);
+  const [impairment, setImpairment] = useState<impair.Config>(new impair.Config());
+  const [impairmentError, setImpairmentError] = useState("");
+  // Escenario cargado en cada extremo, como ruta del archivo
+  const [scenarios, setScenarios] = useState({ client: "", server: "" });
+  const scenario = recibir ? scenarios.server : scenarios.client;
 
   const modalRef = useRef<HTMLDialogElement>(null);
 
@@ -53,8 +173,21 @@ function App() {
 
   useEffect(() => {
     GetLocalIP().then(setLocalIP).catch(console.error);
+    GetReceiveDir().then(setReceiveDir).catch(console.error);
+    GetCollisionPolicy().then(setCollisionPolicy).catch(console.error);
+    GetMismatchAction().then(setMismatchAction).catch(console.error);
+    GetAutoAccept().then(setAutoAccept).catch(console.error);
   }, []);
 
+  // El simulador de red se aplica al extremo de la pestaña activa: al emisor al
+  // transmitir y al receptor al recibir
+  useEffect(() => {
+    setImpairmentError("");
+    (recibir ? GetServerImpairment() : GetImpairment())
+      .then(setImpairment)
+      .catch(console.error);
+  }, [recibir]);
+
   const addEvent = (text: string, type: EventMessage["type"]) => {
     const newEvent: EventMessage = {
       id: Date.now() + Math.random(),
@@ -89,6 +222,38 @@ function App() {
       setEnviando(false);
     });
     EventsOn("server-error", (message) => addEvent(message, "error"));
+    EventsOn("client-info", (message) => addEvent(message, "info"));
+    EventsOn("transfer-results", (list: FileResult[] | null) =>
+      setResults(list ?? [])
+    );
+    EventsOn("file-collision", (data) =>
+      setCollisions((prev) => [
+        ...prev,
+        { id: data.id, fileName: data.fileName, dir: data.dir },
+      ])
+    );
+    EventsOn("incoming-transfer-request", (data) =>
+      setRequests((prev) => [
+        ...prev,
+        {
+          id: data.id,
+          sender: data.sender,
+          peerName: data.peerName,
+          files: data.files,
+          totalSize: data.totalSize,
+        },
+      ])
+    );
+    EventsOn("prompt-expired", (id) => {
+      setCollisions((prev) => prev.filter((c) => c.id !== id));
+      setRequests((prev) => prev.filter((r) => r.id !== id));
+    });
+    EventsOn("client-reconnecting", (data) =>
+      addEvent(
+        `Conexión perdida, reintentando (${data.attempt}/${data.maxAttempts})...`,
+        "info"
+      )
+    );
 
     EventsOn("sending-file-start", (data) => {
       setProgress({
@@ -98,18 +263,43 @@ function App() {
         totalFiles: data.totalFiles,
         sent: 0,
         total: 1,
+        bytes: 0,
+        totalBytes: 0,
       });
     });
     EventsOn("sending-file-progress", (data) => {
-      setProgress((prev) => ({ ...prev, sent: data.sent, total: data.total }));
+      setProgress((prev) => ({
+        ...prev,
+        sent: data.sent,
+        total: data.total,
+        bytes: data.sentBytes,
+        totalBytes: data.totalBytes,
+        cwnd:
+          data.cwnd === undefined
+            ? prev.cwnd
+            : [...(prev.cwnd ?? []), data.cwnd].slice(-MAX_CWND_POINTS),
+      }));
     });
 
+    const onStats = (st: TransferStats) =>
+      setProgress((prev) => ({ ...prev, stats: st }));
+    const onSummary = (st: TransferStats) => {
+      onStats(st);
+      addEvent(statsSummary(st), "info");
+    };
+    EventsOn("sending-file-stats", onStats);
+    EventsOn("receiving-file-stats", onStats);
+    EventsOn("sending-file-summary", onSummary);
+    EventsOn("receiving-file-summary", onSummary);
+
     EventsOn("receiving-file-progress", (data) => {
       setProgress((prev) => ({
         ...prev,
         visible: true,
         sent: data.received,
         total: data.total,
+        bytes: data.bytes,
+        totalBytes: data.totalBytes,
       }));
     });
 
@@ -119,9 +309,19 @@ function App() {
         "reception-finished",
         "client-error",
         "server-error",
+        "client-info",
+        "transfer-results",
+        "file-collision",
+        "incoming-transfer-request",
+        "prompt-expired",
+        "client-reconnecting",
         "sending-file-start",
         "sending-file-progress",
-        "receiving-file-progress"
+        "receiving-file-progress",
+        "sending-file-stats",
+        "receiving-file-stats",
+        "sending-file-summary",
+        "receiving-file-summary"
       );
     };
   }, []);
@@ -136,6 +336,14 @@ function App() {
           ToggleDowntime(true);
         }
       }
+      if (e.key === "c") {
+        setIsCorrupting(true);
+        if (recibir) {
+          ToggleServerCorruption(true);
+        } else {
+          ToggleCorruption(true);
+        }
+      }
     };
 
     const handleKeyUp = (e: KeyboardEvent) => {
@@ -147,6 +355,14 @@ function App() {
           ToggleDowntime(false);
         }
       }
+      if (e.key === "c") {
+        setIsCorrupting(false);
+        if (recibir) {
+          ToggleServerCorruption(false);
+        } else {
+          ToggleCorruption(false);
+        }
+      }
     };
 
     window.addEventListener("keydown", handleKeyDown);
@@ -179,6 +395,7 @@ function App() {
   const enviar = async () => {
     if (!fileInfo.address.trim() || fileInfo.paths.length === 0) return;
     setEnviando(true);
+    setResults([]);
     try {
       await SendFileHandler(fileInfo);
       limpiarPaths();
@@ -195,7 +412,7 @@ function App() {
       startServer();
     } else {
       setRecibir(false);
-      await StopServerHandler();
+      await stopServer();
     }
   };
 
@@ -203,14 +420,130 @@ function App() {
     if (serverOn) return;
     setServerOn(true);
     try {
-      await ReceiveFileHandler();
+      const info = await ReceiveFileHandler(
+        server.ListenConfig.createFrom({
+          Address: listenSettings.address.trim(),
+          TCPPort: listenSettings.tcpPort,
+          UDPPort: listenSettings.udpPort,
+        })
+      );
+      setListenInfo(info);
     } catch (err) {
       console.error(err);
+      addEvent(String(err), "error");
     } finally {
       setServerOn(false);
     }
   };
 
+  const stopServer = async () => {
+    await StopServerHandler();
+    setListenInfo(null);
+  };
+
+  const cambiarCarpeta = async () => {
+    try {
+      const dir = await SelectDirectory();
+      if (!dir) return;
+      await SetReceiveDir(dir);
+      setReceiveDir(await GetReceiveDir());
+    } catch (err) {
+      console.error(err);
+      addEvent(String(err), "error");
+    }
+  };
+
+  const cambiarPolitica = async (policy: string) => {
+    try {
+      await SetCollisionPolicy(policy);
+      setCollisionPolicy(policy);
+    } catch (err) {
+      console.error(err);
+      addEvent(String(err), "error");
+    }
+  };
+
+  const cambiarAccionDaniados = async (action: string) => {
+    try {
+      await SetMismatchAction(action);
+      setMismatchAction(action);
+    } catch (err) {
+      console.error(err);
+      addEvent(String(err), "error");
+    }
+  };
+
+  const cambiarImperfeccion = async (key: keyof impair.Config, value: number) => {
+    const cfg = new impair.Config({ ...impairment, [key]: value });
+    setImpairment(cfg);
+    try {
+      await (recibir ? SetServerImpairment(cfg) : SetImpairment(cfg));
+      setImpairmentError("");
+    } catch (err) {
+      setImpairmentError(String(err));
+    }
+  };
+
+  const cargarEscenario = async () => {
+    try {
+      const path = await SelectScenario();
+      if (!path) return;
+      await (recibir ? LoadServerScenario(path) : LoadScenario(path));
+      setScenarios((prev) => ({ ...prev, [recibir ? "server" : "client"]: path }));
+      setImpairmentError("");
+    } catch (err) {
+      setImpairmentError(String(err));
+    }
+  };
+
+  const quitarEscenario = async () => {
+    try {
+      await (recibir ? ClearServerScenario() : ClearScenario());
+      setScenarios((prev) => ({ ...prev, [recibir ? "server" : "client"]: "" }));
+    } catch (err) {
+      setImpairmentError(String(err));
+    }
+  };
+
+  const resolverColision = async (id: string, action: string) => {
+    setCollisions((prev) => prev.filter((c) => c.id !== id));
+    try {
+      await ResolveCollision(id, action);
+    } catch (err) {
+      console.error(err);
+      addEvent(String(err), "error");
+    }
+  };
+
+  const cambiarAutoAceptar = async (enabled: boolean) => {
+    try {
+      await SetAutoAccept(enabled);
+      setAutoAccept(enabled);
+    } catch (err) {
+      console.error(err);
+      addEvent(String(err), "error");
+    }
+  };
+
+  const responderSolicitud = async (id: string, accept: boolean) => {
+    setRequests((prev) => prev.filter((r) => r.id !== id));
+    try {
+      await (accept ? AcceptTransfer(id) : RejectTransfer(id));
+    } catch (err) {
+      console.error(err);
+      addEvent(String(err), "error");
+    }
+  };
+
+  // Con el tamaño en bytes el avance es exacto; los pares que no lo informan
+  // solo reportan fragmentos
+  const hasBytes = (progress.totalBytes ?? 0) > 0;
+  const done = hasBytes ? progress.bytes ?? 0 : progress.sent;
+  const goal = hasBytes ? progress.totalBytes ?? 1 : progress.total;
+
+  const parsePort = (value: string) =>
+    Math.min(65535, Math.max(0, Math.trunc(Number(value)) || 0));
+
   return (
     <div
       data-theme="synthwave"
@@ -222,6 +555,51 @@ function App() {
         </div>
       )}
       <div className="toast toast-top toast-end z-50">
+        {requests.map((r) => (
+          <div key={r.id} className="alert alert-info shadow-lg flex flex-col items-start gap-2">
+            <span>
+              <span className="font-mono font-bold">{r.peerName || r.sender}</span>
+              {r.peerName && <span className="font-mono"> ({r.sender})</span>} quiere enviarte{" "}
+              {r.files.length === 1 ? "un archivo" : `${r.files.length} archivos`} ({formatSize(r.totalSize)}):
+            </span>
+            <ul className="text-sm font-mono list-disc list-inside">
+              {r.files.slice(0, MAX_LISTED_FILES).map((f) => (
+                <li key={f.name} title={f.mimeType}>
+                  {f.name} ({formatSize(f.size)})
+                </li>
+              ))}
+              {r.files.length > MAX_LISTED_FILES && (
+                <li>y {r.files.length - MAX_LISTED_FILES} más</li>
+              )}
+            </ul>
+            <div className="flex gap-2">
+              <button className="btn btn-xs btn-success" onClick={() => responderSolicitud(r.id, true)}>
+                Aceptar
+              </button>
+              <button className="btn btn-xs btn-error" onClick={() => responderSolicitud(r.id, false)}>
+                Rechazar
+              </button>
+            </div>
+          </div>
+        ))}
+        {collisions.map((c) => (
+          <div key={c.id} className="alert alert-warning shadow-lg flex flex-col items-start gap-2">
+            <span>
+              Ya existe <span className="font-mono font-bold">{c.fileName}</span> en la carpeta de descarga.
+            </span>
+            <div className="flex gap-2">
+              <button className="btn btn-xs" onClick={() => resolverColision(c.id, "overwrite")}>
+                Reemplazar
+              </button>
+              <button className="btn btn-xs" onClick={() => resolverColision(c.id, "rename")}>
+                Guardar con otro nombre
+              </button>
+              <button className="btn btn-xs btn-ghost" onClick={() => resolverColision(c.id, "skip")}>
+                No recibir
+              </button>
+            </div>
+          </div>
+        ))}
         {events.map((event) => (
           <div key={event.id} className={`alert alert-${event.type} shadow-lg flex justify-between items-start gap-4`}>
             <span>{event.text}</span>
@@ -241,7 +619,15 @@ function App() {
         className="modal modal-bottom sm:modal-middle"
         ref={modalRef}
       >
-        <div className={`modal-box ${isDowntime ? "bg-error text-error-content" : ""}`}>
+        <div
+          className={`modal-box ${
+            isDowntime
+              ? "bg-error text-error-content"
+              : isCorrupting
+                ? "bg-warning text-warning-content"
+                : ""
+          }`}
+        >
           <div className="w-full flex flex-col items-center gap-2">
             <h3 className="font-bold text-lg text-primary">
               {recibir ? "Recibiendo Archivos" : "Enviando Archivos"}
@@ -261,16 +647,64 @@ function App() {
                 Fragmentos enviados: {progress.sent} de {progress.total}
               </span>
             )}
+            {hasBytes && (
+              <span className="text-secondary text-xs">
+                {formatSize(progress.bytes ?? 0)} de {formatSize(progress.totalBytes ?? 0)}
+              </span>
+            )}
+            {progress.stats && (
+              <div className="w-full grid grid-cols-2 gap-x-4 text-xs text-secondary">
+                <span>Velocidad: {formatSize(progress.stats.currentBps)}/s</span>
+                <span>
+                  Restante:{" "}
+                  {progress.stats.etaMs < 0 ? "calculando..." : formatDuration(progress.stats.etaMs)}
+                </span>
+                <span>Útil: {formatSize(progress.stats.goodputBps)}/s</span>
+                <span>Enlace: {formatSize(progress.stats.throughputBps)}/s</span>
+                {progress.stats.rttAvgMs !== undefined && (
+                  <span className="col-span-2">
+                    RTT mín/prom/máx: {progress.stats.rttMinMs?.toFixed(1)} /{" "}
+                    {progress.stats.rttAvgMs.toFixed(1)} / {progress.stats.rttMaxMs?.toFixed(1)} ms
+                  </span>
+                )}
+                <span>Retransmisiones: {progress.stats.retransmissions}</span>
+                <span>Timeouts: {progress.stats.timeouts}</span>
+                <span>Duplicados: {progress.stats.duplicates}</span>
+                <span>Desordenados: {progress.stats.outOfOrder}</span>
+                <span>Dañados: {progress.stats.corrupt}</span>
+              </div>
+            )}
+            {!recibir && progress.cwnd && progress.cwnd.length > 1 && (
+              <div className="w-full flex flex-col gap-1">
+                <span className="text-secondary text-xs">
+                  Ventana de congestión: {progress.cwnd[progress.cwnd.length - 1]} segmentos
+                  (máx. {Math.max(...progress.cwnd)})
+                </span>
+                <svg
+                  viewBox="0 0 100 40"
+                  preserveAspectRatio="none"
+                  className="w-full h-16 rounded bg-base-200 text-accent"
+                >
+                  <polyline
+                    points={cwndPoints(progress.cwnd)}
+                    fill="none"
+                    stroke="currentColor"
+                    strokeWidth="1.5"
+                    vectorEffect="non-scaling-stroke"
+                  />
+                </svg>
+              </div>
+            )}
             <progress
               className="progress progress-primary w-full"
-              value={progress.sent}
-              max={progress.total}
+              value={done}
+              max={goal}
             ></progress>
             <span className="font-mono">
-              {Math.round((progress.sent / progress.total) * 100 || 0)}%
+              {Math.round((done / goal) * 100 || 0)}%
             </span>
             <span className="text-xs text-base-content/50 mt-2">
-              Presione D para simular downtime
+              Presione D para simular downtime y C para simular errores de bits
             </span>
           </div>
         </div>
@@ -300,8 +734,117 @@ function App() {
 
         {recibir ? (
           <div className="flex flex-col items-center gap-4 p-8">
-            <p className="label text-xl">Esperando archivos en puerto 8080</p>
-            <span className="loading loading-spinner text-primary loading-lg"></span>
+            {listenInfo ? (
+              <>
+                <p className="label text-xl">
+                  Esperando archivos en TCP {listenInfo.TCPPort} / UDP{" "}
+                  {listenInfo.UDPPort}
+                </p>
+                <span className="loading loading-spinner text-primary loading-lg"></span>
+                <button className="btn btn-ghost btn-sm" onClick={stopServer}>
+                  Detener
+                </button>
+              </>
+            ) : (
+              <>
+                <fieldset className="form-control w-full max-w-xl flex flex-col gap-2">
+                  <input
+                    type="text"
+                    placeholder="Dirección (vacío = todas las interfaces)"
+                    className="input input-bordered w-full"
+                    value={listenSettings.address}
+                    onChange={(e) =>
+                      setListenSettings((prev) => ({
+                        ...prev,
+                        address: e.target.value,
+                      }))
+                    }
+                    disabled={serverOn}
+                  />
+                  <div className="join justify-center">
+                    <label className="label join-item px-4">TCP</label>
+                    <input
+                      type="number"
+                      min={0}
+                      max={65535}
+                      className="input input-bordered join-item w-28"
+                      value={listenSettings.tcpPort}
+                      onChange={(e) =>
+                        setListenSettings((prev) => ({
+                          ...prev,
+                          tcpPort: parsePort(e.target.value),
+                        }))
+                      }
+                      disabled={serverOn}
+                    />
+                    <label className="label join-item px-4">UDP</label>
+                    <input
+                      type="number"
+                      min={0}
+                      max={65535}
+                      className="input input-bordered join-item w-28"
+                      value={listenSettings.udpPort}
+                      onChange={(e) =>
+                        setListenSettings((prev) => ({
+                          ...prev,
+                          udpPort: parsePort(e.target.value),
+                        }))
+                      }
+                      disabled={serverOn}
+                    />
+                  </div>
+                </fieldset>
+                <button
+                  className="btn btn-primary"
+                  onClick={startServer}
+                  disabled={serverOn}
+                >
+                  Escuchar
+                </button>
+              </>
+            )}
+            <div className="flex items-center gap-2 text-sm">
+              <Icon icon="mdi:folder-download" width="18" height="18" />
+              <span className="font-mono truncate max-w-md" title={receiveDir}>
+                {receiveDir}
+              </span>
+              <button className="btn btn-ghost btn-xs" onClick={cambiarCarpeta}>
+                Cambiar carpeta
+              </button>
+            </div>
+            <label className="flex items-center gap-2 text-sm">
+              Si el archivo ya existe:
+              <select
+                className="select select-bordered select-sm"
+                value={collisionPolicy}
+                onChange={(e) => cambiarPolitica(e.target.value)}
+              >
+                <option value="overwrite">Reemplazar</option>
+                <option value="rename">Guardar con otro nombre</option>
+                <option value="skip-identical">Omitir si es idéntico</option>
+                <option value="ask">Preguntar</option>
+              </select>
+            </label>
+            <label className="flex items-center gap-2 text-sm">
+              Si el archivo llega dañado:
+              <select
+                className="select select-bordered select-sm"
+                value={mismatchAction}
+                onChange={(e) => cambiarAccionDaniados(e.target.value)}
+              >
+                <option value="quarantine">Moverlo a cuarentena</option>
+                <option value="delete">Borrarlo</option>
+              </select>
+            </label>
+            <label className="flex items-center gap-2 text-sm cursor-pointer">
+              <input
+                type="checkbox"
+                className="toggle toggle-sm"
+                checked={autoAccept}
+                onChange={(e) => cambiarAutoAceptar(e.target.checked)}
+              />
+              Aceptar archivos sin preguntar
+            </label>
           </div>
         ) : (
           <div className="w-full max-w-xl flex flex-col items-center gap-4">
@@ -367,6 +910,117 @@ function App() {
               </div>
             </fieldset>
 
+            {fileInfo.tcp && (
+              <fieldset className="form-control w-full flex flex-col">
+                <div className="self-center">
+                  <label className="label">
+                    <legend className="fieldset-legend text-secondary text-center">
+                      Ventana de envío (segmentos)
+                    </legend>
+                  </label>
+                </div>
+                <div className="join justify-center">
+                  <input
+                    type="number"
+                    min={1}
+                    className="input input-bordered join-item w-24"
+                    value={fileInfo.windowSize}
+                    onChange={(e) =>
+                      setFileInfo((prev) => ({
+                        ...prev,
+                        windowSize: Math.max(1, Number(e.target.value) || 1),
+                      }))
+                    }
+                    disabled={enviando}
+                  />
+                  <label className="label join-item cursor-pointer gap-2 px-4">
+                    <input
+                      type="checkbox"
+                      className="toggle toggle-secondary toggle-sm"
+                      checked={fileInfo.selectiveRepeat}
+                      onChange={(e) =>
+                        setFileInfo((prev) => ({
+                          ...prev,
+                          selectiveRepeat: e.target.checked,
+                        }))
+                      }
+                      disabled={enviando || fileInfo.windowSize <= 1}
+                    />
+                    <span className="text-xs">
+                      {fileInfo.windowSize <= 1
+                        ? "Stop-and-Wait"
+                        : fileInfo.selectiveRepeat
+                          ? "Selective Repeat"
+                          : "Go-Back-N"}
+                    </span>
+                  </label>
+                </div>
+              </fieldset>
+            )}
+
+            {!fileInfo.tcp && (
+              <label className="label cursor-pointer gap-2">
+                <input
+                  type="checkbox"
+                  className="toggle toggle-accent toggle-sm"
+                  checked={fileInfo.reliableUDP}
+                  onChange={(e) =>
+                    setFileInfo((prev) => ({
+                      ...prev,
+                      reliableUDP: e.target.checked,
+                    }))
+                  }
+                  disabled={enviando}
+                />
+                <span className="text-xs">
+                  {fileInfo.reliableUDP
+                    ? "UDP fiable (NAK + retransmisión)"
+                    : "UDP best-effort"}
+                </span>
+              </label>
+            )}
+
+            <label className="flex items-center gap-2 text-sm">
+              Verificación:
+              <select
+                className="select select-bordered select-sm"
+                value={fileInfo.hashAlgorithm}
+                onChange={(e) =>
+                  setFileInfo((prev) => ({
+                    ...prev,
+                    hashAlgorithm: e.target.value,
+                  }))
+                }
+                disabled={enviando}
+              >
+                <option value="md5">MD5</option>
+                <option value="sha256">SHA-256</option>
+                <option value="blake2b">BLAKE2b</option>
+                <option value="xxh64">xxHash64</option>
+              </select>
+            </label>
+
+            {(fileInfo.tcp ? fileInfo.windowSize > 1 : fileInfo.reliableUDP) && (
+              <label className="flex items-center gap-2 text-sm">
+                Control de congestión:
+                <select
+                  className="select select-bordered select-sm"
+                  value={fileInfo.congestionControl}
+                  onChange={(e) =>
+                    setFileInfo((prev) => ({
+                      ...prev,
+                      congestionControl: e.target.value,
+                    }))
+                  }
+                  disabled={enviando}
+                >
+                  <option value="reno">Reno (ventana AIMD)</option>
+                  <option value="rate">Por ritmo (AIMD)</option>
+                  <option value="fixed">Fijo (sin control)</option>
+                </select>
+              </label>
+            )}
+
             {/* --- NUEVO PANEL DE SELECCIÓN DE ARCHIVOS --- */}
             <div className="w-full card bg-base-100 shadow-md">
               <div className="card-body p-4">
@@ -431,8 +1085,91 @@ function App() {
               )}
               {enviando ? "Enviando..." : "Enviar"}
             </button>
+
+            {results.length > 0 && (
+              <div className="w-full card bg-base-100 shadow">
+                <div className="card-body p-4 gap-2">
+                  <h3 className="font-bold text-primary">Resultado del envío</h3>
+                  <ul className="flex flex-col gap-1 text-sm">
+                    {results.map((r, i) => {
+                      const style = RESULT_STYLES[r.status] ?? RESULT_STYLES.sent;
+                      return (
+                        <li
+                          key={`${i}-${r.name}`}
+                          className="flex items-center gap-2"
+                          title={[r.message, r.stats && statsSummary(r.stats)].filter(Boolean).join("\n")}
+                        >
+                          <Icon className={style.color} icon={style.icon} width="18" height="18" />
+                          <span className="font-mono truncate flex-1">{r.name}</span>
+                          <span className={`text-xs ${style.color}`}>{style.label}</span>
+                        </li>
+                      );
+                    })}
+                  </ul>
+                </div>
+              </div>
+            )}
           </div>
         )}
+
+        <div className="collapse collapse-arrow w-full max-w-xl bg-base-100 shadow">
+          <input type="checkbox" />
+          <div className="collapse-title text-sm font-bold text-secondary flex items-center gap-2">
+            <Icon icon="mdi:access-point-network-off" width="18" height="18" />
+            Simulador de red ({recibir ? "receptor" : "emisor"})
+          </div>
+          <div className="collapse-content flex flex-col gap-2">
+            <p className="text-xs text-base-content/70">
+              Solo afecta a los segmentos de datos; headers, ACKs y trailers
+              comparten la demora y el ancho de banda pero llegan siempre.
+              Mantener presionada D o C pierde o daña todos los segmentos.
+            </p>
+            <div className="grid grid-cols-2 gap-2">
+              {IMPAIRMENT_FIELDS.map((f) => (
+                <label key={f.key} className="flex flex-col text-xs gap-1">
+                  {f.label}
+                  <div className="join">
+                    <input
+                      type="number"
+                      min={0}
+                      max={f.max}
+                      className="input input-bordered input-sm join-item w-full"
+                      value={impairment[f.key]}
+                      onChange={(e) => cambiarImperfeccion(f.key, Number(e.target.value) || 0)}
+                    />
+                    <span className="btn btn-sm join-item no-animation">{f.unit}</span>
+                  </div>
+                </label>
+              ))}
+            </div>
+            <div className="flex items-center gap-2 text-xs">
+              <Icon icon="mdi:script-text-outline" width="18" height="18" />
+              {scenario ? (
+                <>
+                  <span className="font-mono truncate flex-1" title={scenario}>
+                    {scenario.split(/[\\/]/).pop()}
+                  </span>
+                  <button className="btn btn-ghost btn-xs" onClick={quitarEscenario}>
+                    Quitar
+                  </button>
+                </>
+              ) : (
+                <>
+                  <span className="flex-1 text-base-content/70">
+                    Sin escenario: un archivo JSON reproduce la misma secuencia de
+                    fallos en cada envío
+                  </span>
+                  <button className="btn btn-ghost btn-xs" onClick={cargarEscenario}>
+                    Cargar escenario
+                  </button>
+                </>
+              )}
+            </div>
+            {impairmentError && (
+              <span className="text-error text-xs">{impairmentError}</span>
+            )}
+          </div>
+        </div>
       </div>
     </div>
   );
@@ -6,6 +6,10 @@ export function GetLocalIP():Promise<string>;
 
 export function Greet(arg1:string):Promise<string>;
 
+export function SelectDirectory():Promise<string>;
+
 export function SelectFile():Promise<Array<string>>;
 
+export function SelectScenario():Promise<string>;
+
 export function StartContext(arg1:context.Context):Promise<void>;
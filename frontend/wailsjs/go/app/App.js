@@ -10,10 +10,18 @@ export function Greet(arg1) {
   return window['go']['app']['App']['Greet'](arg1);
 }
 
+export function SelectDirectory() {
+  return window['go']['app']['App']['SelectDirectory']();
+}
+
 export function SelectFile() {
   return window['go']['app']['App']['SelectFile']();
 }
 
+export function SelectScenario() {
+  return window['go']['app']['App']['SelectScenario']();
+}
+
 export function StartContext(arg1) {
   return window['go']['app']['App']['StartContext'](arg1);
 }
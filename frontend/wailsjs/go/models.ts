@@ -1,3 +1,36 @@
+export namespace impair {
+	
+	export class Config {
+	    lossPercent: number;
+	    burstPercent: number;
+	    burstLength: number;
+	    delayMs: number;
+	    jitterMs: number;
+	    duplicatePercent: number;
+	    reorderPercent: number;
+	    corruptPercent: number;
+	    bandwidthKbps: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Config(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.lossPercent = source["lossPercent"];
+	        this.burstPercent = source["burstPercent"];
+	        this.burstLength = source["burstLength"];
+	        this.delayMs = source["delayMs"];
+	        this.jitterMs = source["jitterMs"];
+	        this.duplicatePercent = source["duplicatePercent"];
+	        this.reorderPercent = source["reorderPercent"];
+	        this.corruptPercent = source["corruptPercent"];
+	        this.bandwidthKbps = source["bandwidthKbps"];
+	    }
+	}
+
+}
+
 export namespace server {
 	
 	export class FileSenderInfo {
@@ -5,6 +38,11 @@ export namespace server {
 	    Port: string;
 	    TCP: boolean;
 	    Paths: string[];
+	    WindowSize: number;
+	    SelectiveRepeat: boolean;
+	    ReliableUDP: boolean;
+	    HashAlgorithm: string;
+	    CongestionControl: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new FileSenderInfo(source);
@@ -16,8 +54,44 @@ export namespace server {
 	        this.Port = source["Port"];
 	        this.TCP = source["TCP"];
 	        this.Paths = source["Paths"];
+	        this.WindowSize = source["WindowSize"];
+	        this.SelectiveRepeat = source["SelectiveRepeat"];
+	        this.ReliableUDP = source["ReliableUDP"];
+	        this.HashAlgorithm = source["HashAlgorithm"];
+	        this.CongestionControl = source["CongestionControl"];
+	    }
+	}
+	export class ListenConfig {
+	    Address: string;
+	    TCPPort: number;
+	    UDPPort: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ListenConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Address = source["Address"];
+	        this.TCPPort = source["TCPPort"];
+	        this.UDPPort = source["UDPPort"];
+	    }
+	}
+	export class ListenInfo {
+	    Address: string;
+	    TCPPort: number;
+	    UDPPort: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ListenInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.Address = source["Address"];
+	        this.TCPPort = source["TCPPort"];
+	        this.UDPPort = source["UDPPort"];
 	    }
 	}
 
 }
-
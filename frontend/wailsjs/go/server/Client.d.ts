@@ -1,12 +1,25 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {impair} from '../models';
 import {server} from '../models';
 import {context} from '../models';
 
+export function ClearScenario():Promise<void>;
+
+export function GetImpairment():Promise<impair.Config>;
+
+export function IsCorrupting():Promise<boolean>;
+
 export function IsDowntime():Promise<boolean>;
 
+export function LoadScenario(arg1:string):Promise<void>;
+
 export function SendFileHandler(arg1:server.FileSenderInfo):Promise<string>;
 
+export function SetImpairment(arg1:impair.Config):Promise<void>;
+
 export function StartContext(arg1:context.Context):Promise<void>;
 
+export function ToggleCorruption(arg1:boolean):Promise<void>;
+
 export function ToggleDowntime(arg1:boolean):Promise<void>;
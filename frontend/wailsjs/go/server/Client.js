@@ -2,18 +2,42 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function ClearScenario() {
+  return window['go']['server']['Client']['ClearScenario']();
+}
+
+export function GetImpairment() {
+  return window['go']['server']['Client']['GetImpairment']();
+}
+
+export function IsCorrupting() {
+  return window['go']['server']['Client']['IsCorrupting']();
+}
+
 export function IsDowntime() {
   return window['go']['server']['Client']['IsDowntime']();
 }
 
+export function LoadScenario(arg1) {
+  return window['go']['server']['Client']['LoadScenario'](arg1);
+}
+
 export function SendFileHandler(arg1) {
   return window['go']['server']['Client']['SendFileHandler'](arg1);
 }
 
+export function SetImpairment(arg1) {
+  return window['go']['server']['Client']['SetImpairment'](arg1);
+}
+
 export function StartContext(arg1) {
   return window['go']['server']['Client']['StartContext'](arg1);
 }
 
+export function ToggleCorruption(arg1) {
+  return window['go']['server']['Client']['ToggleCorruption'](arg1);
+}
+
 export function ToggleDowntime(arg1) {
   return window['go']['server']['Client']['ToggleDowntime'](arg1);
 }
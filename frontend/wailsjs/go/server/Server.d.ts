@@ -1,13 +1,49 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {impair} from '../models';
+import {server} from '../models';
 import {context} from '../models';
 
+export function AcceptTransfer(arg1:string):Promise<void>;
+
+export function ClearScenario():Promise<void>;
+
+export function GetAutoAccept():Promise<boolean>;
+
+export function GetCollisionPolicy():Promise<string>;
+
+export function GetImpairment():Promise<impair.Config>;
+
+export function GetMismatchAction():Promise<string>;
+
+export function GetReceiveDir():Promise<string>;
+
+export function IsCorrupting():Promise<boolean>;
+
 export function IsDowntime():Promise<boolean>;
 
-export function ReceiveFileHandler():Promise<string>;
+export function LoadScenario(arg1:string):Promise<void>;
+
+export function ReceiveFileHandler(arg1:server.ListenConfig):Promise<server.ListenInfo>;
+
+export function RejectTransfer(arg1:string):Promise<void>;
+
+export function ResolveCollision(arg1:string,arg2:string):Promise<void>;
+
+export function SetAutoAccept(arg1:boolean):Promise<void>;
+
+export function SetCollisionPolicy(arg1:string):Promise<void>;
+
+export function SetImpairment(arg1:impair.Config):Promise<void>;
+
+export function SetMismatchAction(arg1:string):Promise<void>;
+
+export function SetReceiveDir(arg1:string):Promise<void>;
 
 export function StartContext(arg1:context.Context):Promise<void>;
 
 export function StopServerHandler():Promise<void>;
 
+export function ToggleCorruption(arg1:boolean):Promise<void>;
+
 export function ToggleDowntime(arg1:boolean):Promise<void>;
@@ -2,12 +2,76 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AcceptTransfer(arg1) {
+  return window['go']['server']['Server']['AcceptTransfer'](arg1);
+}
+
+export function ClearScenario() {
+  return window['go']['server']['Server']['ClearScenario']();
+}
+
+export function GetAutoAccept() {
+  return window['go']['server']['Server']['GetAutoAccept']();
+}
+
+export function GetCollisionPolicy() {
+  return window['go']['server']['Server']['GetCollisionPolicy']();
+}
+
+export function GetImpairment() {
+  return window['go']['server']['Server']['GetImpairment']();
+}
+
+export function GetMismatchAction() {
+  return window['go']['server']['Server']['GetMismatchAction']();
+}
+
+export function GetReceiveDir() {
+  return window['go']['server']['Server']['GetReceiveDir']();
+}
+
+export function IsCorrupting() {
+  return window['go']['server']['Server']['IsCorrupting']();
+}
+
 export function IsDowntime() {
   return window['go']['server']['Server']['IsDowntime']();
 }
 
-export function ReceiveFileHandler() {
-  return window['go']['server']['Server']['ReceiveFileHandler']();
+export function LoadScenario(arg1) {
+  return window['go']['server']['Server']['LoadScenario'](arg1);
+}
+
+export function ReceiveFileHandler(arg1) {
+  return window['go']['server']['Server']['ReceiveFileHandler'](arg1);
+}
+
+export function RejectTransfer(arg1) {
+  return window['go']['server']['Server']['RejectTransfer'](arg1);
+}
+
+export function ResolveCollision(arg1, arg2) {
+  return window['go']['server']['Server']['ResolveCollision'](arg1, arg2);
+}
+
+export function SetAutoAccept(arg1) {
+  return window['go']['server']['Server']['SetAutoAccept'](arg1);
+}
+
+export function SetCollisionPolicy(arg1) {
+  return window['go']['server']['Server']['SetCollisionPolicy'](arg1);
+}
+
+export function SetImpairment(arg1) {
+  return window['go']['server']['Server']['SetImpairment'](arg1);
+}
+
+export function SetMismatchAction(arg1) {
+  return window['go']['server']['Server']['SetMismatchAction'](arg1);
+}
+
+export function SetReceiveDir(arg1) {
+  return window['go']['server']['Server']['SetReceiveDir'](arg1);
 }
 
 export function StartContext(arg1) {
@@ -18,6 +82,10 @@ export function StopServerHandler() {
   return window['go']['server']['Server']['StopServerHandler']();
 }
 
+export function ToggleCorruption(arg1) {
+  return window['go']['server']['Server']['ToggleCorruption'](arg1);
+}
+
 export function ToggleDowntime(arg1) {
   return window['go']['server']['Server']['ToggleDowntime'](arg1);
 }
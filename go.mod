@@ -4,7 +4,11 @@ go 1.23.0
 
 toolchain go1.24.6
 
-require github.com/wailsapp/wails/v2 v2.10.2
+require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/wailsapp/wails/v2 v2.10.2
+	golang.org/x/crypto v0.41.0
+)
 
 require (
 	github.com/bep/debounce v1.2.1 // indirect
@@ -30,7 +34,6 @@ require (
 	github.com/valyala/fasttemplate v1.2.2 // indirect
 	github.com/wailsapp/go-webview2 v1.0.22 // indirect
 	github.com/wailsapp/mimetype v1.4.1 // indirect
-	golang.org/x/crypto v0.41.0 // indirect
 	golang.org/x/net v0.43.0 // indirect
 	golang.org/x/sys v0.35.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
@@ -40,6 +40,29 @@ func (a *App) SelectFile() ([]string, error) {
 	return filePaths, nil
 }
 
+// SelectDirectory abre el diálogo para elegir la carpeta de descarga. Devuelve
+// "" si el usuario lo cancela.
+func (a *App) SelectDirectory() (string, error) {
+	return runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:                "Seleccionar carpeta de descarga",
+		CanCreateDirectories: true,
+	})
+}
+
+// SelectScenario abre el diálogo para elegir un escenario del simulador de red.
+// Devuelve "" si el usuario lo cancela.
+func (a *App) SelectScenario() (string, error) {
+	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Seleccionar escenario de red",
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: "Escenarios (*.json)",
+				Pattern:     "*.json",
+			},
+		},
+	})
+}
+
 func (a *App) GetLocalIP() (string, error) {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
@@ -0,0 +1,69 @@
+// Package cli permite enviar y recibir archivos desde la terminal, sin abrir la
+// ventana, con la misma lógica de transferencia que usa la interfaz gráfica.
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/NeichS/final-redes-wails/internal/events"
+)
+
+// Códigos de salida.
+const (
+	exitOK = 0
+	// exitError indica que la transferencia no se pudo hacer (conexión, puertos...).
+	exitError = 1
+	// exitUsage indica argumentos inválidos.
+	exitUsage = 2
+	// exitIncomplete indica que la transferencia terminó pero algún archivo fue
+	// rechazado o no llegó bien.
+	exitIncomplete = 3
+)
+
+const usage = `Uso:
+  final-redes send (--tcp | --udp) host:puerto [opciones] archivos...
+  final-redes receive [opciones]
+
+Ejecute "final-redes send -h" o "final-redes receive -h" para ver las opciones.
+`
+
+// IsCommand indica si arg es un subcomando de la línea de comandos.
+func IsCommand(arg string) bool {
+	switch arg {
+	case "send", "receive", "help", "-h", "--help":
+		return true
+	}
+	return false
+}
+
+// Run ejecuta el subcomando de args (sin el nombre del programa) y devuelve el
+// código de salida.
+func Run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "send":
+		return runSend(args[1:])
+	case "receive":
+		return runReceive(args[1:])
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "comando desconocido: %s\n\n%s", args[0], usage)
+	return exitUsage
+}
+
+// newLogger devuelve el logger de la lógica de transferencia. Sus mensajes de
+// depuración se mezclarían con las barras de progreso, así que solo se muestran
+// si se piden con --verbose.
+func newLogger(verbose bool) events.Logger {
+	if !verbose {
+		return events.Discard
+	}
+	return log.Default()
+}
@@ -0,0 +1,257 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	client "github.com/NeichS/final-redes-wails/internal/client"
+	"github.com/NeichS/final-redes-wails/internal/stats"
+)
+
+// Cada cuánto se redibuja la barra de progreso (o se informa el progreso en JSON).
+const progressRate = 100 * time.Millisecond
+
+// Ancho de la barra de progreso en caracteres.
+const barWidth = 30
+
+// Texto de cada resultado de un envío.
+var resultLabels = map[string]string{
+	client.FileVerified: "verificado",
+	client.FileSent:     "enviado",
+	client.FileSkipped:  "omitido",
+	client.FileRejected: "rechazado",
+	client.FileFailed:   "dañado",
+}
+
+// output muestra los eventos de una transferencia en la terminal: mensajes en
+// stdout y una barra de progreso en stderr, o una línea JSON por evento en stdout.
+// Los eventos pueden llegar desde varias goroutines a la vez.
+type output struct {
+	mu      sync.Mutex
+	json    bool
+	enc     *json.Encoder
+	bars    bool
+	drawn   bool
+	label   string
+	lastBar time.Time
+	// Lo que se informa en el resumen final
+	errors  []string
+	results []client.FileResult
+}
+
+// jsonEvent es cada línea de la salida JSON.
+type jsonEvent struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// summary es la última línea de la salida JSON.
+type summary struct {
+	ExitCode int                 `json:"exitCode"`
+	Error    string              `json:"error,omitempty"`
+	Errors   []string            `json:"errors,omitempty"`
+	Results  []client.FileResult `json:"results,omitempty"`
+}
+
+func newOutput(jsonMode bool) *output {
+	return &output{
+		json: jsonMode,
+		enc:  json.NewEncoder(os.Stdout),
+		// Las barras solo tienen sentido si alguien mira la terminal
+		bars: !jsonMode && isTerminal(os.Stderr),
+	}
+}
+
+// Emit recibe los eventos de Server y Client (output es un events.Sink).
+func (o *output) Emit(name string, data ...interface{}) {
+	var payload interface{}
+	if len(data) > 0 {
+		payload = data[0]
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	switch name {
+	case "client-error", "server-error":
+		o.errors = append(o.errors, fmt.Sprint(payload))
+	case "transfer-results":
+		if results, ok := payload.([]client.FileResult); ok {
+			o.results = results
+		}
+	}
+
+	if o.json {
+		if isProgress(name) && !o.progressDue(payload) {
+			return
+		}
+		o.enc.Encode(jsonEvent{Event: name, Data: payload})
+		return
+	}
+
+	switch name {
+	case "sending-file-start":
+		m, _ := payload.(map[string]interface{})
+		o.label = fmt.Sprintf("[%v/%v] %v", m["currentFile"], m["totalFiles"], m["fileName"])
+	case "reception-started":
+		o.label = fmt.Sprint(payload)
+		o.line(fmt.Sprintf("Recibiendo %v...", payload))
+	case "sending-file-progress":
+		m, _ := payload.(map[string]interface{})
+		o.bar(m["sentBytes"], m["totalBytes"], m["sent"], m["total"])
+	case "receiving-file-progress":
+		m, _ := payload.(map[string]interface{})
+		o.bar(m["bytes"], m["totalBytes"], m["received"], m["total"])
+	case "sending-file-summary", "receiving-file-summary":
+		if st, ok := payload.(stats.Snapshot); ok {
+			o.line(fmt.Sprintf("%s: %v", st.File, st))
+		}
+	case "client-error", "server-error":
+		o.line(fmt.Sprintf("Error: %v", payload))
+	case "client-info", "reception-finished":
+		o.line(fmt.Sprint(payload))
+	case "client-reconnecting":
+		m, _ := payload.(map[string]interface{})
+		o.line(fmt.Sprintf("Conexión perdida, reintentando (%v/%v)...", m["attempt"], m["maxAttempts"]))
+	case "transfer-results":
+		for _, r := range o.results {
+			text := fmt.Sprintf("  %-10s %s", resultLabels[r.Status], r.Name)
+			if r.Message != "" {
+				text += ": " + r.Message
+			}
+			o.line(text)
+		}
+	}
+}
+
+// event emite un evento propio de la línea de comandos. Sin payload solo se
+// muestra el texto, y en JSON se omite.
+func (o *output) event(name string, payload interface{}, text string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.json {
+		if payload == nil {
+			return
+		}
+		o.enc.Encode(jsonEvent{Event: name, Data: payload})
+		return
+	}
+	o.line(text)
+}
+
+// finish cierra la salida: en JSON escribe el resumen con el código de salida.
+func (o *output) finish(code int, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.json {
+		o.clearBar()
+		return
+	}
+	s := summary{ExitCode: code, Errors: o.errors, Results: o.results}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	o.enc.Encode(jsonEvent{Event: "summary", Data: s})
+}
+
+// failed indica si algún archivo no llegó bien.
+func (o *output) failed() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, r := range o.results {
+		if r.Status == client.FileRejected || r.Status == client.FileFailed {
+			return true
+		}
+	}
+	// Sin resultados por archivo (UDP) los errores se informan como eventos
+	return len(o.results) == 0 && len(o.errors) > 0
+}
+
+// reported indica si ya se mostró algún error.
+func (o *output) reported() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.errors) > 0
+}
+
+// line escribe un mensaje, borrando antes la barra de progreso si estaba dibujada.
+func (o *output) line(text string) {
+	o.clearBar()
+	fmt.Fprintln(os.Stdout, text)
+}
+
+func (o *output) clearBar() {
+	if o.drawn {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		o.drawn = false
+	}
+}
+
+// bar dibuja el progreso en bytes o, si no se conoce el tamaño, en segmentos.
+func (o *output) bar(bytes, totalBytes, segments, totalSegments interface{}) {
+	if !o.bars {
+		return
+	}
+	done, total := number(bytes), number(totalBytes)
+	if total == 0 {
+		done, total = number(segments), number(totalSegments)
+	}
+	if done < total && time.Since(o.lastBar) < progressRate {
+		return
+	}
+	o.lastBar = time.Now()
+
+	fraction := 1.0
+	if total > 0 {
+		fraction = min(done/total, 1)
+	}
+	filled := int(fraction * barWidth)
+	progress := fmt.Sprintf("%.0f/%.0f", done, total)
+	if number(totalBytes) > 0 {
+		progress = stats.FormatSize(done) + "/" + stats.FormatSize(total)
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s [%s%s] %3.0f%% %s", o.label,
+		strings.Repeat("#", filled), strings.Repeat(".", barWidth-filled), fraction*100, progress)
+	o.drawn = true
+}
+
+// progressDue limita la frecuencia de los eventos de progreso en JSON; el del
+// final de cada archivo siempre se informa.
+func (o *output) progressDue(payload interface{}) bool {
+	m, _ := payload.(map[string]interface{})
+	last := m["total"] != nil && (number(m["sent"]) >= number(m["total"]) || number(m["received"]) >= number(m["total"]))
+	if !last && time.Since(o.lastBar) < progressRate {
+		return false
+	}
+	o.lastBar = time.Now()
+	return true
+}
+
+func isProgress(name string) bool {
+	return name == "sending-file-progress" || name == "receiving-file-progress"
+}
+
+// number convierte los valores numéricos de los eventos, que usan distintos tipos enteros.
+func number(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/NeichS/final-redes-wails/internal/events"
+	sv "github.com/NeichS/final-redes-wails/internal/server"
+	"github.com/NeichS/final-redes-wails/internal/stats"
+)
+
+// Eventos del servidor que esperan una respuesta del usuario.
+const (
+	approvalEvent  = "incoming-transfer-request"
+	collisionEvent = "file-collision"
+)
+
+// question es una consulta del servidor pendiente de respuesta por stdin.
+type question struct {
+	event string
+	data  map[string]interface{}
+}
+
+// runReceive escucha transferencias hasta que se interrumpe con Ctrl+C.
+func runReceive(args []string) int {
+	flags := flag.NewFlagSet("receive", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), "Uso: final-redes receive [opciones]\n\nOpciones:\n")
+		flags.PrintDefaults()
+	}
+	dir := flags.String("dir", "receive", "carpeta donde se guardan los archivos recibidos")
+	address := flags.String("address", "", "dirección en la que se escucha (vacía es todas)")
+	port := flags.Int("port", 8080, "puerto TCP y UDP en el que se escucha (0 elige uno libre)")
+	tcpPort := flags.Int("tcp-port", -1, "puerto TCP, si es distinto de --port")
+	udpPort := flags.Int("udp-port", -1, "puerto UDP, si es distinto de --port")
+	onExists := flags.String("on-exists", sv.CollisionOverwrite, "qué hacer si el archivo ya existe: overwrite, rename, skip-identical o ask")
+	onCorrupt := flags.String("on-corrupt", sv.MismatchQuarantine, "qué hacer si el archivo llega dañado: quarantine o delete")
+	yes := flags.Bool("yes", false, "acepta las transferencias sin preguntar")
+	scenario := flags.String("scenario", "", "reproduce el escenario de imperfecciones del `archivo` JSON en los segmentos recibidos")
+	jsonMode := flags.Bool("json", false, "escribe cada evento como una línea JSON en stdout")
+	verbose := flags.Bool("verbose", false, "muestra los mensajes de depuración")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "argumento inesperado: %s\n", flags.Arg(0))
+		return exitUsage
+	}
+	if *tcpPort < 0 {
+		*tcpPort = *port
+	}
+	if *udpPort < 0 {
+		*udpPort = *port
+	}
+	out := newOutput(*jsonMode)
+	questions := make(chan question, 16)
+	s := sv.NewServer(events.Func(func(name string, data ...interface{}) {
+		out.Emit(name, data...)
+		if name == approvalEvent || name == collisionEvent {
+			if m, ok := data[0].(map[string]interface{}); ok {
+				// No se espera a que haya lugar en la cola: se llama desde la
+				// goroutine de la transferencia, y si la consulta no entra el
+				// servidor aplica la respuesta por defecto al vencer el plazo
+				select {
+				case questions <- question{event: name, data: m}:
+				default:
+				}
+			}
+		}
+	}), newLogger(*verbose))
+
+	fail := func(err error) int {
+		out.finish(exitUsage, err)
+		if !*jsonMode {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return exitUsage
+	}
+	if err := s.SetReceiveDir(*dir); err != nil {
+		return fail(err)
+	}
+	if err := s.SetCollisionPolicy(*onExists); err != nil {
+		return fail(err)
+	}
+	if err := s.SetMismatchAction(*onCorrupt); err != nil {
+		return fail(err)
+	}
+	s.SetAutoAccept(*yes)
+	if *scenario != "" {
+		if err := s.LoadScenario(*scenario); err != nil {
+			return fail(err)
+		}
+	}
+
+	info, err := s.ReceiveFileHandler(sv.ListenConfig{Address: *address, TCPPort: *tcpPort, UDPPort: *udpPort})
+	if err != nil {
+		out.finish(exitError, err)
+		if !*jsonMode {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return exitError
+	}
+	out.event("listening", map[string]interface{}{
+		"address": info.Address,
+		"tcpPort": info.TCPPort,
+		"udpPort": info.UDPPort,
+		"dir":     s.GetReceiveDir(),
+	}, fmt.Sprintf("Escuchando en TCP %d y UDP %d; los archivos se guardan en %s (Ctrl+C para terminar)",
+		info.TCPPort, info.UDPPort, s.GetReceiveDir()))
+
+	go answerQuestions(s, out, questions)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	s.StopServerHandler()
+	out.finish(exitOK, nil)
+	return exitOK
+}
+
+// answerQuestions le pregunta al usuario, de a una por vez, las consultas del
+// servidor y le entrega las respuestas que escribe en stdin. Si stdin se cierra
+// las transferencias se rechazan y los archivos repetidos se renombran.
+func answerQuestions(s *sv.Server, out *output, questions <-chan question) {
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- strings.TrimSpace(scanner.Text())
+		}
+		close(lines)
+	}()
+
+	for q := range questions {
+		id := fmt.Sprint(q.data["id"])
+		var err error
+		switch q.event {
+		case approvalEvent:
+			out.event("question", nil, fmt.Sprintf("%v quiere enviar %s (%s). ¿Aceptar? [s/N]",
+				q.data["sender"], describeFiles(q.data["files"]), stats.FormatSize(number(q.data["totalSize"]))))
+			if answer, ok := <-lines; ok && isYes(answer) {
+				err = s.AcceptTransfer(id)
+			} else {
+				err = s.RejectTransfer(id)
+			}
+		case collisionEvent:
+			out.event("question", nil, fmt.Sprintf("%v ya existe. ¿Sobrescribir, renombrar u omitir? [s/R/o]", q.data["fileName"]))
+			action := sv.CollisionRename
+			if answer, ok := <-lines; ok {
+				switch strings.ToLower(answer) {
+				case "s", "sobrescribir", sv.CollisionOverwrite:
+					action = sv.CollisionOverwrite
+				case "o", "omitir", "skip":
+					action = "skip"
+				}
+			}
+			err = s.ResolveCollision(id, action)
+		}
+		if err != nil {
+			out.event("question-expired", id, fmt.Sprintf("La respuesta llegó tarde: %v", err))
+		}
+	}
+}
+
+// describeFiles resume la lista de archivos de una oferta.
+func describeFiles(v interface{}) string {
+	files, _ := v.([]map[string]interface{})
+	if len(files) == 1 {
+		return fmt.Sprint(files[0]["name"])
+	}
+	return fmt.Sprintf("%d archivos", len(files))
+}
+
+func isYes(answer string) bool {
+	switch strings.ToLower(answer) {
+	case "s", "si", "sí", "y", "yes":
+		return true
+	}
+	return false
+}
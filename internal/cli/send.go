@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	client "github.com/NeichS/final-redes-wails/internal/client"
+)
+
+// runSend envía archivos a un receptor: final-redes send --tcp host:puerto archivos...
+func runSend(args []string) int {
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), "Uso: final-redes send (--tcp | --udp) host:puerto [opciones] archivos...\n\nOpciones:\n")
+		flags.PrintDefaults()
+	}
+	tcp := flags.String("tcp", "", "envía por TCP al receptor `host:puerto`")
+	udp := flags.String("udp", "", "envía por UDP al receptor `host:puerto`")
+	window := flags.Int("window", 1, "segmentos TCP en vuelo a la vez (1 es Stop-and-Wait)")
+	selective := flags.Bool("sr", false, "usa Selective Repeat en lugar de Go-Back-N cuando --window > 1")
+	reliable := flags.Bool("reliable", false, "activa ACKs y retransmisiones en el modo UDP")
+	hash := flags.String("hash", "md5", "algoritmo con el que se verifica cada archivo")
+	cc := flags.String("cc", "reno", "control de congestión del UDP fiable y de la ventana TCP: reno, rate o fixed")
+	scenario := flags.String("scenario", "", "reproduce el escenario de imperfecciones del `archivo` JSON en los segmentos enviados")
+	jsonMode := flags.Bool("json", false, "escribe cada evento como una línea JSON en stdout")
+	verbose := flags.Bool("verbose", false, "muestra los mensajes de depuración")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if (*tcp == "") == (*udp == "") {
+		fmt.Fprintln(os.Stderr, "hay que indicar exactamente uno de --tcp o --udp")
+		return exitUsage
+	}
+	target := *tcp + *udp
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dirección inválida %q: se espera host:puerto\n", target)
+		return exitUsage
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "no se indicó ningún archivo para enviar")
+		return exitUsage
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "no se puede leer %s: %v\n", path, err)
+			return exitUsage
+		}
+		if info.IsDir() {
+			fmt.Fprintf(os.Stderr, "%s es una carpeta; solo se pueden enviar archivos\n", path)
+			return exitUsage
+		}
+	}
+	out := newOutput(*jsonMode)
+	c := client.NewClient(out, newLogger(*verbose))
+	if *scenario != "" {
+		if err := c.LoadScenario(*scenario); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+	_, err = c.SendFileHandler(client.FileSenderInfo{
+		Address:           host,
+		Port:              port,
+		TCP:               *tcp != "",
+		Paths:             paths,
+		WindowSize:        *window,
+		SelectiveRepeat:   *selective,
+		ReliableUDP:       *reliable,
+		HashAlgorithm:     *hash,
+		CongestionControl: *cc,
+	})
+
+	code := exitOK
+	switch {
+	case err != nil:
+		code = exitError
+	case out.failed():
+		code = exitIncomplete
+	}
+	out.finish(code, err)
+	// Los errores de conexión ya se mostraron como evento "client-error"
+	if err != nil && !*jsonMode && !out.reported() {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	return code
+}
@@ -2,14 +2,20 @@ package server
 
 import (
 	"context"
-	"log"
-	"sync"
+
+	"github.com/NeichS/final-redes-wails/internal/congestion"
+	"github.com/NeichS/final-redes-wails/internal/events"
+	"github.com/NeichS/final-redes-wails/internal/impair"
+	"github.com/NeichS/final-redes-wails/internal/shared"
+	"github.com/NeichS/final-redes-wails/internal/stats"
 )
 
 type Client struct {
-	ctx        context.Context
-	downtime   bool
-	downtimeMu sync.RWMutex
+	// events y logger reciben los eventos para la interfaz y los mensajes de log
+	events events.Sink
+	logger events.Logger
+	// impairment simula un enlace imperfecto para los segmentos que se envían
+	impairment impair.Impairment
 }
 
 type FileSenderInfo struct {
@@ -17,27 +23,139 @@ type FileSenderInfo struct {
 	Port    string
 	TCP     bool
 	Paths   []string
+	// WindowSize es la cantidad de segmentos TCP que pueden estar en vuelo a la vez.
+	// Con 1 (o 0) el emisor se comporta como Stop-and-Wait.
+	WindowSize int
+	// SelectiveRepeat elige Selective Repeat en lugar de Go-Back-N cuando WindowSize > 1.
+	SelectiveRepeat bool
+	// ReliableUDP activa ACKs, NAKs y retransmisiones en el modo UDP. Sin él se
+	// mantiene el envío best-effort original, útil para las demostraciones.
+	ReliableUDP bool
+	// HashAlgorithm es el algoritmo con el que se verifica cada archivo (ver
+	// shared.HashAlgorithms). Vacío es MD5.
+	HashAlgorithm string
+	// CongestionControl es el algoritmo que regula el ritmo de envío en el UDP
+	// fiable y limita la ventana TCP (ver congestion.Algorithms). Vacío es Reno.
+	CongestionControl string
+}
+
+// Resultados posibles de cada archivo de un envío TCP.
+const (
+	// FileVerified indica que el receptor confirmó que el archivo llegó intacto.
+	FileVerified = "verified"
+	// FileSent indica que el archivo se envió completo a un receptor que no
+	// informa el resultado de la verificación.
+	FileSent = "sent"
+	// FileSkipped indica que el receptor ya tenía el archivo.
+	FileSkipped = "skipped"
+	// FileRejected indica que el receptor no aceptó el archivo.
+	FileRejected = "rejected"
+	// FileFailed indica que el archivo no pasó la verificación en ningún intento.
+	FileFailed = "failed"
+)
+
+// FileResult es el resultado del envío de un archivo. Al terminar un envío TCP
+// la lista se informa a la interfaz con el evento "transfer-results".
+type FileResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	// Stats es el resumen de la transferencia, si se llegaron a enviar los datos.
+	Stats *stats.Snapshot `json:"stats,omitempty"`
 }
 
+// NewClient crea un Client que informa sus eventos a sink y sus mensajes a logger,
+// para usarlo fuera de la interfaz gráfica.
+func NewClient(sink events.Sink, logger events.Logger) *Client {
+	return &Client{events: sink, logger: logger}
+}
+
+// StartContext recibe el contexto de Wails. Si el Client no se creó con NewClient,
+// los eventos van a la interfaz.
 func (c *Client) StartContext(ctx context.Context) {
-	c.ctx = ctx
+	if c.events == nil {
+		w := events.NewWails(ctx)
+		c.events, c.logger = w, w
+	}
 }
 
+// emit envía un evento a la interfaz.
+func (c *Client) emit(name string, data ...interface{}) {
+	if c.events != nil {
+		c.events.Emit(name, data...)
+	}
+}
+
+// logf registra un mensaje en el log de la aplicación.
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, args...)
+	}
+}
+
+// ToggleDowntime simula una caída del enlace: mientras está activa se pierden
+// todos los segmentos de datos que se envían y el emisor los retransmite al
+// vencer sus temporizadores.
 func (c *Client) ToggleDowntime(active bool) {
-	c.downtimeMu.Lock()
-	defer c.downtimeMu.Unlock()
-	c.downtime = active
+	c.impairment.SetDown(active)
 	if active {
-		log.Println("Downtime started")
+		c.logf("Downtime started")
 	} else {
-		log.Println("Downtime ended")
+		c.logf("Downtime ended")
 	}
 }
 
 func (c *Client) IsDowntime() bool {
-	c.downtimeMu.RLock()
-	defer c.downtimeMu.RUnlock()
-	return c.downtime
+	return c.impairment.Down()
+}
+
+// ToggleCorruption activa la simulación de errores de bits: mientras está activa
+// cada segmento de datos sale con un bit invertido, y el receptor lo descarta al
+// verificar su CRC.
+func (c *Client) ToggleCorruption(active bool) {
+	c.impairment.SetCorrupting(active)
+	if active {
+		c.logf("Bit error simulation started")
+	} else {
+		c.logf("Bit error simulation ended")
+	}
+}
+
+func (c *Client) IsCorrupting() bool {
+	return c.impairment.Corrupting()
+}
+
+// SetImpairment configura el simulador de red que se aplica a los segmentos que
+// se envían. Se puede cambiar durante una transferencia.
+func (c *Client) SetImpairment(cfg impair.Config) error {
+	if err := c.impairment.Set(cfg); err != nil {
+		return err
+	}
+	c.logf("Client impairment: %+v", cfg)
+	return nil
+}
+
+// GetImpairment devuelve la configuración del simulador de red.
+func (c *Client) GetImpairment() impair.Config {
+	return c.impairment.Config()
+}
+
+// LoadScenario carga un escenario en JSON (ver impair.Scenario) que se reproduce
+// sobre los segmentos que se envían, además de la configuración del simulador.
+func (c *Client) LoadScenario(path string) error {
+	sc, err := impair.LoadScenario(path)
+	if err != nil {
+		return err
+	}
+	c.impairment.SetScenario(sc)
+	c.logf("Client scenario loaded: %s (%d steps, seed %d)", path, len(sc.Steps), sc.Seed)
+	return nil
+}
+
+// ClearScenario deja de reproducir el escenario cargado.
+func (c *Client) ClearScenario() {
+	c.impairment.SetScenario(nil)
+	c.logf("Client scenario cleared")
 }
 
 func (c *Client) SendFileHandler(fi FileSenderInfo) (string, error) {
@@ -45,22 +163,31 @@ func (c *Client) SendFileHandler(fi FileSenderInfo) (string, error) {
 	if fi.TCP {
 		protocol = "TCP"
 	}
-	log.Printf("Sending file to %s using %s, with paths: %v", fi.Address, protocol, fi.Paths)
+	c.logf("Sending file to %s using %s, with paths: %v", fi.Address, protocol, fi.Paths)
+
+	algorithm, err := shared.NormalizeHash(fi.HashAlgorithm)
+	if err != nil {
+		return "", err
+	}
+	fi.HashAlgorithm = algorithm
+	if fi.CongestionControl, err = congestion.Normalize(fi.CongestionControl); err != nil {
+		return "", err
+	}
 
 	if fi.TCP {
-		err := startTCPClient(c.ctx, fi.Address, fi.Port, fi.Paths, c)
+		err := startTCPClient(fi, c)
 
 		if err != nil {
-			log.Printf("Error starting TCP server: %v", err)
+			c.logf("Error sending over TCP: %v", err)
 			return "", err
 		}
 	} else {
-		err := startUDPClient(c.ctx, fi.Address, fi.Port, fi.Paths)
+		err := startUDPClient(fi, c)
 		if err != nil {
-			log.Printf("Error starting UDP client: %v", err)
+			c.logf("Error sending over UDP: %v", err)
 			return "", err
 		}
 	}
 
-	return "Server started", nil
+	return "Files sent", nil
 }
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+)
+
+// Tiempo máximo de espera del HELLO-ACK antes de asumir un servidor sin handshake.
+const helloTimeout = 3 * time.Second
+
+// dialAndHandshake conecta con el servidor y negocia versión y funcionalidades.
+// Si el servidor no responde al HELLO (una versión anterior que corta la conexión
+// o nunca contesta) se reconecta y se continúa sin handshake.
+func (c *Client) dialAndHandshake(addr *net.TCPAddr, window uint16) (*net.TCPConn, protocol.Session, error) {
+	conn, err := net.DialTCP("tcp", nil, addr)
+	if err != nil {
+		return nil, protocol.Session{}, err
+	}
+
+	session, err := sendHello(conn, window)
+	if err == nil {
+		c.logf("Handshake with %q: version %d, features %#x, window %d", session.PeerName, session.Version, session.Features, session.MaxWindow)
+		return conn, session, nil
+	}
+	conn.Close()
+	c.logf("Server did not answer HELLO (%v), continuing without handshake", err)
+
+	conn, err = net.DialTCP("tcp", nil, addr)
+	if err != nil {
+		return nil, protocol.Session{}, err
+	}
+	return conn, protocol.LegacySession(), nil
+}
+
+func sendHello(conn *net.TCPConn, window uint16) (protocol.Session, error) {
+	local := localHello(window)
+	frame, err := local.MarshalBinary()
+	if err != nil {
+		return protocol.Session{}, err
+	}
+	if _, err := conn.Write(frame); err != nil {
+		return protocol.Session{}, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	reply, err := protocol.ReadFrame(conn)
+	if err != nil {
+		return protocol.Session{}, err
+	}
+	remote, ok := reply.(*protocol.Hello)
+	if !ok || remote.Type != protocol.TypeHelloAck {
+		return protocol.Session{}, fmt.Errorf("respuesta inesperada al HELLO: %T", reply)
+	}
+	return protocol.Negotiate(local, remote), nil
+}
+
+func localHello(window uint16) *protocol.Hello {
+	return &protocol.Hello{
+		Type:      protocol.TypeHello,
+		Version:   protocol.CurrentVersion,
+		Features:  protocol.SupportedFeatures,
+		MaxWindow: window,
+		PeerName:  protocol.LocalPeerName(),
+	}
+}
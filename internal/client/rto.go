@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// Límites del temporizador de retransmisión (RFC 6298). El mínimo es el de Linux
+// en lugar del segundo del RFC, para recuperarse rápido de una pérdida en una LAN.
+const (
+	initialRTO = 1 * time.Second
+	minRTO     = 200 * time.Millisecond
+	maxRTO     = 10 * time.Second
+)
+
+// Cantidad de timeouts seguidos de un mismo segmento después de los cuales se
+// abandona el envío.
+const maxRetries = 8
+
+// rtoEstimator calcula el temporizador de retransmisión a partir del RTT medido
+// en cada ACK, con el algoritmo de Jacobson/Karels: SRTT es el promedio móvil
+// del RTT y RTTVAR su variación, y el temporizador es SRTT + 4·RTTVAR. Cada
+// timeout lo duplica hasta la próxima medición.
+type rtoEstimator struct {
+	srtt, rttvar time.Duration
+	rto          time.Duration
+	sampled      bool
+}
+
+func newRTOEstimator() *rtoEstimator {
+	return &rtoEstimator{rto: initialRTO}
+}
+
+// sample incorpora una medición del RTT. Por el algoritmo de Karn solo se
+// miden los segmentos que se enviaron una vez: el ACK de uno retransmitido no
+// dice a cuál de los envíos responde.
+func (e *rtoEstimator) sample(rtt time.Duration) {
+	if !e.sampled {
+		e.srtt = rtt
+		e.rttvar = rtt / 2
+		e.sampled = true
+	} else {
+		diff := e.srtt - rtt
+		if diff < 0 {
+			diff = -diff
+		}
+		// RTTVAR = 3/4·RTTVAR + 1/4·|SRTT − RTT|; SRTT = 7/8·SRTT + 1/8·RTT
+		e.rttvar = (3*e.rttvar + diff) / 4
+		e.srtt = (7*e.srtt + rtt) / 8
+	}
+	e.rto = clampRTO(e.srtt + 4*e.rttvar)
+}
+
+// backoff duplica el temporizador después de un timeout.
+func (e *rtoEstimator) backoff() {
+	e.rto = clampRTO(2 * e.rto)
+}
+
+// timeout devuelve cuánto se espera un ACK antes de retransmitir.
+func (e *rtoEstimator) timeout() time.Duration {
+	return e.rto
+}
+
+func (e *rtoEstimator) String() string {
+	return fmt.Sprintf("srtt=%v rttvar=%v rto=%v", e.srtt, e.rttvar, e.rto)
+}
+
+func clampRTO(rto time.Duration) time.Duration {
+	return min(max(rto, minRTO), maxRTO)
+}
+
+// retriesExhaustedError indica que un segmento no se confirmó después de
+// maxRetries retransmisiones por timeout: el receptor o el enlace dejaron de
+// responder y se abandona el envío.
+type retriesExhaustedError struct {
+	seq uint32
+}
+
+func (e *retriesExhaustedError) Error() string {
+	return fmt.Sprintf("el receptor no confirmó el segmento %d después de %d retransmisiones", e.seq, maxRetries)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRTOEstimatorFirstSample(t *testing.T) {
+	e := newRTOEstimator()
+	if got := e.timeout(); got != initialRTO {
+		t.Fatalf("sin mediciones el temporizador es %v, se esperaba %v", got, initialRTO)
+	}
+	// RFC 6298: SRTT = R, RTTVAR = R/2, RTO = SRTT + 4·RTTVAR
+	e.sample(100 * time.Millisecond)
+	if e.srtt != 100*time.Millisecond || e.rttvar != 50*time.Millisecond {
+		t.Errorf("srtt=%v rttvar=%v, se esperaban 100ms y 50ms", e.srtt, e.rttvar)
+	}
+	if got := e.timeout(); got != 300*time.Millisecond {
+		t.Errorf("el temporizador es %v, se esperaban 300ms", got)
+	}
+}
+
+func TestRTOEstimatorSmoothing(t *testing.T) {
+	e := newRTOEstimator()
+	e.sample(100 * time.Millisecond)
+	e.sample(180 * time.Millisecond)
+	// RTTVAR = 3/4·50 + 1/4·80 = 57.5ms; SRTT = 7/8·100 + 1/8·180 = 110ms
+	if e.rttvar != 57500*time.Microsecond || e.srtt != 110*time.Millisecond {
+		t.Errorf("srtt=%v rttvar=%v, se esperaban 110ms y 57.5ms", e.srtt, e.rttvar)
+	}
+	if got := e.timeout(); got != 340*time.Millisecond {
+		t.Errorf("el temporizador es %v, se esperaban 340ms", got)
+	}
+}
+
+func TestRTOEstimatorClampAndBackoff(t *testing.T) {
+	e := newRTOEstimator()
+	// En loopback el RTT es de microsegundos, pero el temporizador no baja del mínimo
+	e.sample(50 * time.Microsecond)
+	if got := e.timeout(); got != minRTO {
+		t.Fatalf("el temporizador es %v, se esperaba el mínimo %v", got, minRTO)
+	}
+	for want := 2 * minRTO; want < maxRTO; want *= 2 {
+		e.backoff()
+		if got := e.timeout(); got != want {
+			t.Fatalf("después del timeout el temporizador es %v, se esperaba %v", got, want)
+		}
+	}
+	e.backoff()
+	if got := e.timeout(); got != maxRTO {
+		t.Errorf("el temporizador es %v, no puede pasar de %v", got, maxRTO)
+	}
+	// Una medición nueva termina el backoff
+	e.sample(50 * time.Microsecond)
+	if got := e.timeout(); got != minRTO {
+		t.Errorf("después de medir el temporizador es %v, se esperaba %v", got, minRTO)
+	}
+}
@@ -3,172 +3,753 @@
 package server
 
 import (
-	"context"
-	"crypto/md5"
-	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"log"
 	"net"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/NeichS/final-redes-wails/internal/congestion"
+	"github.com/NeichS/final-redes-wails/internal/impair"
+	"github.com/NeichS/final-redes-wails/internal/protocol"
 	"github.com/NeichS/final-redes-wails/internal/shared"
-	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"github.com/NeichS/final-redes-wails/internal/stats"
 )
 
-func startTCPClient(ctx context.Context, addr, port string, filePaths []string, client *Client) error {
-	tcpServer, err := net.ResolveTCPAddr("tcp", addr+":"+port)
-	if err != nil {
-		log.Printf("Error resolving TCP address: %v", err)
-		runtime.EventsEmit(ctx, "client-error", "dirección IP inválida")
-		return err
-	}
+// Tiempo máximo que se espera la respuesta a la oferta. El receptor rechaza solo
+// la transferencia si su usuario no contesta en un minuto.
+const offerTimeout = 90 * time.Second
+
+// Tiempo máximo que se espera el resultado de la verificación de un archivo. Es
+// amplio porque el receptor puede tener que leer un archivo existente para
+// compararlo.
+const verifyTimeout = 2 * time.Minute
+
+// Tiempo máximo que se espera la confirmación del header. El receptor puede
+// tener que consultar a su usuario si acepta el archivo y después si reemplaza
+// uno existente.
+const headerAckTimeout = 130 * time.Second
+
+// Cantidad de veces que se envía un archivo que llega dañado al receptor.
+const maxVerifyAttempts = 3
 
-	conn, err := net.DialTCP("tcp", nil, tcpServer)
+func startTCPClient(fi FileSenderInfo, client *Client) error {
+	tcpServer, err := net.ResolveTCPAddr("tcp", fi.Address+":"+fi.Port)
 	if err != nil {
-		runtime.EventsEmit(ctx, "client-error", fmt.Sprintf("No se pudo conectar: %v", err))
-		log.Printf("Error dialing: %v", err)
+		client.logf("Error resolving TCP address: %v", err)
+		client.emit("client-error", "dirección IP inválida")
 		return err
 	}
-	defer conn.Close()
 
-	err = sendFiles(ctx, filePaths, conn, client)
-	if err != nil {
-		log.Printf("Error sending files: %v", err)
-		runtime.EventsEmit(ctx, "client-error", fmt.Sprintf("Error durante el envío: %v", err))
-		return err
+	// Si la conexión se corta y el servidor soporta reanudación, reconectamos y
+	// seguimos desde el último segmento confirmado del archivo en curso.
+	var results []FileResult
+	for attempt := 0; ; attempt++ {
+		conn, session, err := client.dialAndHandshake(tcpServer, protocol.NormalizeWindow(fi.WindowSize))
+		if err != nil {
+			if attempt > 0 && attempt < maxReconnects {
+				client.logf("Reconnect attempt %d failed: %v", attempt, err)
+				time.Sleep(reconnectDelay(attempt))
+				continue
+			}
+			client.emit("client-error", fmt.Sprintf("No se pudo conectar: %v", err))
+			client.logf("Error dialing: %v", err)
+			return err
+		}
+
+		// Los segmentos salen por el simulador de red
+		link := impair.NewSender(conn, &client.impairment, impair.TCP)
+		err = sendFiles(fi, &results, session, link, client)
+		link.Close()
+		if err == nil {
+			break
+		}
+
+		var declined *transferDeclinedError
+		if errors.As(err, &declined) {
+			client.logf("Transfer declined: %v", err)
+			client.emit("client-error", "El receptor rechazó la transferencia.")
+			return err
+		}
+		var lost *connectionLostError
+		if !errors.As(err, &lost) || !session.Has(protocol.FeatureResume) || attempt+1 >= maxReconnects {
+			client.logf("Error sending files: %v", err)
+			client.emit("client-error", fmt.Sprintf("Error durante el envío: %v", err))
+			// Los archivos que llegaron a procesarse se informan igual
+			client.emit("transfer-results", results)
+			return err
+		}
+		client.logf("Connection lost (%v), reconnecting to resume...", err)
+		client.emit("client-reconnecting", map[string]interface{}{
+			"attempt":     attempt + 1,
+			"maxAttempts": maxReconnects,
+		})
+		time.Sleep(reconnectDelay(attempt + 1))
 	}
 
-	runtime.EventsEmit(ctx, "reception-finished", "¡Todos los archivos enviados con éxito!")
+	client.emit("transfer-results", results)
+	client.emit("reception-finished", resultsSummary(results))
 	return nil
 }
 
-// Renombrada a sendFiles y ahora itera sobre los paths
-func sendFiles(ctx context.Context, filePaths []string, conn *net.TCPConn, client *Client) error {
-	totalFiles := len(filePaths)
-	for i, path := range filePaths {
-		runtime.EventsEmit(ctx, "sending-file-start", map[string]interface{}{
+// resultsSummary resume el resultado de un envío en un mensaje para el usuario.
+func resultsSummary(results []FileResult) string {
+	failed, unverified := 0, 0
+	for _, r := range results {
+		switch r.Status {
+		case FileRejected, FileFailed:
+			failed++
+		case FileSent:
+			unverified++
+		}
+	}
+	switch {
+	case failed > 0:
+		return fmt.Sprintf("Envío terminado: %d de %d archivos no llegaron correctamente al receptor.", failed, len(results))
+	case unverified > 0:
+		// El receptor no confirma la verificación, solo sabemos que se enviaron
+		return "¡Todos los archivos enviados con éxito!"
+	default:
+		return "¡Todos los archivos enviados y verificados por el receptor!"
+	}
+}
+
+// Cantidad máxima de conexiones que se intentan para completar un envío.
+const maxReconnects = 5
+
+// reconnectDelay espera cada vez más entre reintentos: 1s, 2s, 4s...
+func reconnectDelay(attempt int) time.Duration {
+	return time.Second << (attempt - 1)
+}
+
+// connectionLostError marca los errores de red, después de los cuales el envío
+// puede reanudarse con una nueva conexión.
+type connectionLostError struct {
+	err error
+}
+
+func (e *connectionLostError) Error() string { return e.err.Error() }
+func (e *connectionLostError) Unwrap() error { return e.err }
+
+func connectionLost(err error) error {
+	return &connectionLostError{err: err}
+}
+
+// fileRejectedError indica que el servidor no aceptó un archivo. El resto de los
+// archivos se sigue enviando.
+type fileRejectedError struct {
+	reason  byte
+	message string
+}
+
+func (e *fileRejectedError) Error() string {
+	if e.reason == protocol.RejectDeclined {
+		return "el receptor rechazó el archivo"
+	}
+	return "el servidor rechazó el archivo: " + e.message
+}
+
+// verifyFailedError indica que el archivo llegó dañado o incompleto al receptor,
+// que lo descartó. Se puede volver a enviar.
+type verifyFailedError struct {
+	message string
+}
+
+func (e *verifyFailedError) Error() string {
+	return "el archivo no pasó la verificación del receptor: " + e.message
+}
+
+// transferDeclinedError indica que el usuario del receptor no aceptó la oferta,
+// así que no se envía ningún archivo.
+type transferDeclinedError struct {
+	message string
+}
+
+func (e *transferDeclinedError) Error() string { return e.message }
+
+// reportPlacement informa qué hizo el receptor con un archivo que ya existía y
+// devuelve true si no hay que enviarlo.
+func reportPlacement(client *Client, fileName string, status byte, savedAs string) bool {
+	var msg string
+	switch status {
+	case protocol.AckStatusSkipped:
+		msg = fmt.Sprintf("%s ya existe en el receptor, se omitió.", fileName)
+		client.logf("%s already exists on the receiver, skipped", fileName)
+	case protocol.AckStatusRenamed:
+		msg = fmt.Sprintf("%s ya existía en el receptor, se guarda como %s.", fileName, savedAs)
+		client.logf("%s already exists on the receiver, saved as %s", fileName, savedAs)
+	case protocol.AckStatusOverwritten:
+		msg = fmt.Sprintf("%s reemplaza a un archivo existente en el receptor.", fileName)
+		client.logf("%s overwrites an existing file on the receiver", fileName)
+	default:
+		return false
+	}
+	client.emit("client-info", msg)
+	return status == protocol.AckStatusSkipped
+}
+
+// Renombrada a sendFiles y ahora itera sobre los paths. Agrega a results el
+// resultado de cada archivo procesado y empieza por el primero que no tiene
+// resultado; los que el servidor rechaza o no logra verificar se saltean.
+func sendFiles(fi FileSenderInfo, results *[]FileResult, session protocol.Session, conn net.Conn, client *Client) error {
+	acks := newAckReader(conn)
+	defer acks.stop()
+	// El RTT y la ventana de congestión medidos con un archivo sirven para los siguientes
+	rto := newRTOEstimator()
+	cc, err := congestion.New(fi.CongestionControl)
+	if err != nil {
+		return err
+	}
+	totalFiles := len(fi.Paths)
+	start := len(*results)
+	if session.Has(protocol.FeatureOffer) {
+		// Las transferencias reanudadas solo ofrecen los archivos que faltan
+		if err := client.offerFiles(fi.Paths[start:], conn, acks); err != nil {
+			return err
+		}
+	}
+	for i := start; i < totalFiles; i++ {
+		path := fi.Paths[i]
+		client.emit("sending-file-start", map[string]interface{}{
 			"fileName":    filepath.Base(path),
 			"currentFile": i + 1,
 			"totalFiles":  totalFiles,
 		})
 		time.Sleep(100 * time.Millisecond)
-		err := sendSingleFile(ctx, path, conn, client)
-		if err != nil {
+		status, summary, err := sendSingleFile(path, conn, acks, rto, cc, fi, session, client)
+		var mismatch *verifyFailedError
+		for attempt := 2; errors.As(err, &mismatch) && attempt <= maxVerifyAttempts; attempt++ {
+			// El receptor ya descartó la copia dañada: se envía de nuevo desde el principio
+			client.logf("File %s failed verification (%s), retrying", path, mismatch.message)
+			client.emit("client-info", fmt.Sprintf("%s llegó dañado al receptor, se envía de nuevo (intento %d de %d).", filepath.Base(path), attempt, maxVerifyAttempts))
+			status, summary, err = sendSingleFile(path, conn, acks, rto, cc, fi, session, client)
+		}
+
+		result := FileResult{Name: filepath.Base(path), Status: status, Stats: summary}
+		var rejection *fileRejectedError
+		switch {
+		case errors.As(err, &mismatch):
+			client.logf("File %s failed verification %d times", path, maxVerifyAttempts)
+			client.emit("client-error", fmt.Sprintf("%s: %v", filepath.Base(path), err))
+			result.Status, result.Message = FileFailed, mismatch.message
+		case errors.As(err, &rejection):
+			client.logf("File %s rejected: %s", path, rejection.message)
+			client.emit("client-error", fmt.Sprintf("%s: %v", filepath.Base(path), err))
+			result.Status, result.Message = FileRejected, rejection.Error()
+		case err != nil:
 			// Si hay un error con un archivo, lo reportamos y paramos
 			return fmt.Errorf("failed to send file %s: %w", path, err)
 		}
+		*results = append(*results, result)
 	}
 	return nil
 }
 
-func sendSingleFile(ctx context.Context, filePath string, conn *net.TCPConn, client *Client) error {
-	file, err := os.Open(filePath)
+// offerFiles anuncia los archivos al servidor y espera a que el receptor los acepte.
+func (c *Client) offerFiles(paths []string, conn net.Conn, acks *ackReader) error {
+	offer := &protocol.Offer{Files: make([]protocol.OfferedFile, 0, len(paths))}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		offer.Files = append(offer.Files, protocol.OfferedFile{Name: filepath.Base(path), Size: uint64(info.Size())})
+	}
+	frame, err := offer.MarshalBinary()
 	if err != nil {
-		log.Printf("Error opening file %s: %v", filePath, err)
 		return err
 	}
-	defer file.Close()
+	if _, err := conn.Write(frame); err != nil {
+		return connectionLost(err)
+	}
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		log.Printf("Error calculating checksum: %v", err)
-		return err
+	c.logf("Offered %d files, waiting for the receiver to accept", len(paths))
+	select {
+	case ack, ok := <-acks.acks:
+		if !ok {
+			// Después de un rechazo el servidor cierra la conexión
+			select {
+			case reject := <-acks.rejects:
+				return &transferDeclinedError{message: reject.Message}
+			default:
+				return acks.closedErr()
+			}
+		}
+		if ack.Type != protocol.TypeAckOffer {
+			return fmt.Errorf("se esperaba la respuesta a la oferta, llegó el tipo %d", ack.Type)
+		}
+		return nil
+	case reject := <-acks.rejects:
+		return &transferDeclinedError{message: reject.Message}
+	case <-time.After(offerTimeout):
+		return errors.New("el receptor no respondió a la oferta")
 	}
-	checksum := hex.EncodeToString(hash.Sum(nil))
-	file.Seek(0, 0)
+}
 
-	baseName := filepath.Base(filePath)
-	header := shared.NewMetadata(file, baseName, checksum)
+// ackReader lee en segundo plano las confirmaciones del servidor para que el
+// emisor pueda seguir transmitiendo mientras llegan los ACKs. Los rechazos de
+// archivos y los resultados de la verificación llegan por canales aparte.
+type ackReader struct {
+	acks     chan *protocol.Ack
+	rejects  chan *protocol.Reject
+	verdicts chan *protocol.Verify
+	err      error
+	// done se cierra con stop, cuando ya nadie lee las confirmaciones
+	done chan struct{}
+}
 
-	dataBuffer := make([]byte, 1014)
+func newAckReader(conn net.Conn) *ackReader {
+	r := &ackReader{
+		acks:     make(chan *protocol.Ack, 64),
+		rejects:  make(chan *protocol.Reject, 1),
+		verdicts: make(chan *protocol.Verify, 1),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(r.acks)
+		for {
+			frame, err := protocol.ReadFrame(conn)
+			if err != nil {
+				if err != io.EOF {
+					r.err = err
+				}
+				return
+			}
+			// Un rechazo o un resultado que llega mientras otro espera ser leído
+			// no le sirve a nadie: se descarta para no trabar la lectura
+			if reject, ok := frame.(*protocol.Reject); ok {
+				select {
+				case r.rejects <- reject:
+				default:
+				}
+				continue
+			}
+			if verdict, ok := frame.(*protocol.Verify); ok {
+				select {
+				case r.verdicts <- verdict:
+				default:
+				}
+				continue
+			}
+			ack, ok := frame.(*protocol.Ack)
+			if !ok {
+				r.err = fmt.Errorf("frame inesperado del servidor: %T", frame)
+				return
+			}
+			select {
+			case r.acks <- ack:
+			case <-r.done:
+				return
+			}
+		}
+	}()
+	return r
+}
 
-	headerBuffer := []byte{1}
+// stop libera la goroutine de lectura si quedó esperando que se lea un ACK.
+func (r *ackReader) stop() {
+	close(r.done)
+}
 
-	temp := make([]byte, 4)
-	received := make([]byte, 1024)
+// closedErr devuelve el motivo por el que se cerró el canal de confirmaciones.
+func (r *ackReader) closedErr() error {
+	if r.err != nil {
+		return connectionLost(r.err)
+	}
+	return connectionLost(errors.New("connection closed by server prematurely"))
+}
 
-	binary.BigEndian.PutUint32(temp, header.Reps())
-	headerBuffer = append(headerBuffer, temp...)
+// wireHash devuelve el nombre de algoritmo que viaja en el protocolo: vacío para
+// MD5, que es el que asume un receptor si no se indica ninguno.
+func wireHash(algorithm string) string {
+	if algorithm == shared.DefaultHash {
+		return ""
+	}
+	return algorithm
+}
 
-	binary.BigEndian.PutUint32(temp, uint32(len(header.Name())))
-	headerBuffer = append(headerBuffer, temp...)
+// pendingSegment es un segmento enviado que todavía no fue confirmado.
+type pendingSegment struct {
+	frame []byte
+	// size son los bytes de datos del segmento
+	size   int
+	sentAt time.Time
+	acked  bool
+	// retransmitted excluye al segmento de la medición del RTT (algoritmo de Karn)
+	retransmitted bool
+	// retries cuenta los timeouts del segmento
+	retries int
+}
 
-	binary.BigEndian.PutUint32(temp, uint32(len(header.GetChecksum())))
-	headerBuffer = append(headerBuffer, temp...)
+func sendSingleFile(filePath string, conn net.Conn, acks *ackReader, rto *rtoEstimator, cc congestion.Controller, fi FileSenderInfo, session protocol.Session, client *Client) (string, *stats.Snapshot, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		client.logf("Error opening file %s: %v", filePath, err)
+		return "", nil, err
+	}
+	defer file.Close()
 
-	headerBuffer = append(headerBuffer, []byte(header.Name())...)
-	headerBuffer = append(headerBuffer, []byte(header.GetChecksum())...)
-	headerBuffer = append(headerBuffer, 0)
+	// Un servidor que no negocia algoritmos solo sabe verificar con MD5
+	baseName := filepath.Base(filePath)
+	algorithm := fi.HashAlgorithm
+	if algorithm != shared.DefaultHash && !(session.Has(protocol.FeatureHashAlgorithms) && session.Has(protocol.FeatureFileSize)) {
+		client.logf("%s: receiver does not support %s, verifying with %s", baseName, algorithm, shared.DefaultHash)
+		client.emit("client-info", fmt.Sprintf("%s: el receptor no soporta %s, se verifica con %s.", baseName, algorithm, shared.DefaultHash))
+		algorithm = shared.DefaultHash
+	}
 
-	_, err = conn.Write(headerBuffer)
-	if err != nil {
-		return err
+	// Con FeatureTrailer el checksum se calcula mientras se envía y viaja al final;
+	// si no, hay que leer el archivo una vez antes para ponerlo en el header
+	var (
+		checksum string
+		hasher   hash.Hash
+	)
+	if session.Has(protocol.FeatureTrailer) {
+		if hasher, err = shared.NewHash(algorithm); err != nil {
+			return "", nil, err
+		}
+	} else {
+		checksum, err = shared.Checksum(file, algorithm)
+		if err != nil {
+			client.logf("Error calculating checksum: %v", err)
+			return "", nil, err
+		}
+		file.Seek(0, 0)
 	}
 
-	_, err = conn.Read(received)
+	header, err := shared.NewMetadata(file, baseName, algorithm, checksum)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-	fmt.Println(string(received))
+	client.logf("Sending %s (%s, %d bytes)", baseName, header.MIMEType(), header.FileSize())
 
-	for i := 0; i < int(header.Reps()); i++ {
-		// Check for downtime
-		for client.IsDowntime() {
-			time.Sleep(100 * time.Millisecond)
+	// La ventana solo se usa si el servidor también la soporta
+	window := uint16(1)
+	if session.Has(protocol.FeatureWindow) {
+		window = min(protocol.NormalizeWindow(fi.WindowSize), session.MaxWindow)
+	}
+	mode := protocol.ARQStopAndWait
+	if window > 1 {
+		mode = protocol.ARQGoBackN
+		if fi.SelectiveRepeat {
+			mode = protocol.ARQSelectiveRepeat
 		}
+	}
 
-		n, err := file.Read(dataBuffer)
-		if err != nil && err != io.EOF {
-			return err
-		}
+	headerFrame := &protocol.Header{
+		Reps:     header.Reps(),
+		ARQMode:  mode,
+		Window:   window,
+		Name:     header.Name(),
+		Checksum: header.GetChecksum(),
+		Size:     uint64(header.FileSize()),
+		HasSize:  session.Has(protocol.FeatureFileSize),
+		// MD5 viaja vacío para que lo entiendan los receptores anteriores
+		HashAlgorithm: wireHash(header.HashAlgorithm()),
+		ModTime:       header.ModTime().UnixNano(),
+		Perm:          uint32(header.Mode()),
+		HasAttrs:      session.Has(protocol.FeatureFileSize) && session.Has(protocol.FeatureFileAttributes),
+	}
+	headerBuffer, err := headerFrame.MarshalBinary()
+	if err != nil {
+		return "", nil, err
+	}
 
-		segmentBuffer := []byte{0}
+	_, err = conn.Write(headerBuffer)
+	if err != nil {
+		return "", nil, connectionLost(err)
+	}
+
+	var ack *protocol.Ack
+	select {
+	case a, ok := <-acks.acks:
+		if !ok {
+			return "", nil, acks.closedErr()
+		}
+		ack = a
+	case reject := <-acks.rejects:
+		return "", nil, &fileRejectedError{reason: reject.Reason, message: reject.Message}
+	case <-time.After(headerAckTimeout):
+		return "", nil, errors.New("el receptor no confirmó el header")
+	}
+	if ack.Type != protocol.TypeAckHeader {
+		return "", nil, fmt.Errorf("se esperaba la confirmación del header, llegó el tipo %d", ack.Type)
+	}
+	if skip := reportPlacement(client, baseName, ack.Status, ack.Name); skip {
+		return FileSkipped, nil, nil
+	}
 
-		binary.BigEndian.PutUint32(temp, uint32(i))
-		segmentBuffer = append(segmentBuffer, temp...)
+	reps := header.Reps()
+	dataBuffer := make([]byte, protocol.SegmentSize)
+	inFlight := make(map[uint32]*pendingSegment)
+	var base, next uint32
+	// Los segmentos dañados antes de recovery ya redujeron la ventana
+	var recovery uint32
 
-		binary.BigEndian.PutUint32(temp, uint32(n))
-		segmentBuffer = append(segmentBuffer, temp...)
+	if ack.Status == protocol.AckStatusResume && ack.Seq < reps {
+		// El servidor ya tiene los primeros segmentos: seguimos desde ahí
+		client.logf("Resuming %s from segment %d", baseName, ack.Seq)
+		offset := int64(ack.Seq) * protocol.SegmentSize
+		if hasher != nil {
+			// Lo que ya tiene el servidor también entra en el checksum
+			if _, err := io.CopyN(hasher, file, offset); err != nil {
+				return "", nil, err
+			}
+		} else if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return "", nil, err
+		}
+		base, next = ack.Seq, ack.Seq
+	}
+	size := header.FileSize()
+	st := stats.New(baseName, uint64(size), uint64(min(int64(base)*protocol.SegmentSize, size)))
 
-		segmentBuffer = append(segmentBuffer, dataBuffer[:n]...)
-		segmentBuffer = append(segmentBuffer, 1) // End of segment
+	for base < reps {
+		if snapshot, ok := st.Due(); ok {
+			client.emit("sending-file-stats", snapshot)
+		}
+		// Llenamos la ventana, que el control de congestión puede achicar. En TCP
+		// solo se usa su ventana: el ritmo lo marcan los ACKs.
+		for next < reps && next-base < uint32(min(int(window), cc.Window())) {
+			n, err := io.ReadFull(file, dataBuffer)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return "", nil, err
+			}
+			if hasher != nil {
+				// Cada segmento se lee una sola vez y en orden; las retransmisiones
+				// reusan el frame ya armado
+				hasher.Write(dataBuffer[:n])
+			}
 
-		// Retry loop for Stop-and-Wait ARQ
-		for {
-			_, err = conn.Write(segmentBuffer)
+			segment := &protocol.Segment{Seq: next, Data: dataBuffer[:n]}
+			if session.Has(protocol.FeatureSegmentCRC) {
+				segment.CRC = protocol.SegmentCRC(next, segment.Data)
+				segment.HasCRC = true
+			}
+			segmentBuffer, err := segment.MarshalBinary()
 			if err != nil {
-				return err
+				return "", nil, err
 			}
 
-			// Set read deadline for ACK (e.g., 2 seconds)
-			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
-			_, err = conn.Read(received)
-			if err != nil {
-				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-					log.Printf("Timeout waiting for ACK %d. Resending...", i)
-					continue // Retry sending
+			if err := client.writeSegment(conn, segmentBuffer); err != nil {
+				return "", nil, err
+			}
+			inFlight[next] = &pendingSegment{frame: segmentBuffer, size: n, sentAt: time.Now()}
+			st.Transferred(n)
+			next++
+		}
+
+		wait := nextTimeout(inFlight, base, next, mode, rto.timeout())
+
+		select {
+		case ack, ok := <-acks.acks:
+			if !ok {
+				return "", nil, acks.closedErr()
+			}
+			if ack.Type != protocol.TypeAckSegment {
+				client.logf("Unexpected ACK type %d from server", ack.Type)
+				continue
+			}
+			if ack.Status == protocol.AckStatusDuplicate {
+				st.Duplicate()
+			}
+			seq := ack.Seq
+			if seq < base || seq >= next {
+				// ACK de un segmento ya confirmado (duplicado o tardío)
+				client.logf("Ignoring ACK %d outside window [%d, %d)", seq, base, next)
+				continue
+			}
+			if ack.Status == protocol.AckStatusCorrupt {
+				// El segmento llegó dañado: se reenvía sin esperar al temporizador. En
+				// Go-Back-N el receptor descarta lo que siguió, así que se reenvía todo
+				// desde ahí.
+				client.logf("Segment %d arrived corrupt. Resending...", seq)
+				st.Corrupt()
+				// Varios segmentos dañados de la misma ventana la reducen una sola vez
+				if seq >= recovery {
+					cc.OnLoss()
+					recovery = next
+				}
+				last := seq + 1
+				if mode == protocol.ARQGoBackN {
+					last = next
 				}
-				if err == io.EOF {
-					return errors.New("connection closed by server prematurely")
+				if err := client.resend(conn, inFlight, seq, last, st); err != nil {
+					return "", nil, err
 				}
-				return err
+				continue
 			}
-			// Clear deadline after successful read
-			conn.SetReadDeadline(time.Time{})
 
-			fmt.Println(string(received))
-			break // ACK received, move to next segment
+			var rtt time.Duration
+			if p := inFlight[seq]; !p.acked && !p.retransmitted {
+				rtt = time.Since(p.sentAt)
+				rto.sample(rtt)
+				st.RTT(rtt)
+			}
+			first := seq
+			if mode != protocol.ARQSelectiveRepeat {
+				// ACK acumulativo: confirma todo hasta seq inclusive
+				first = base
+			}
+			for s := first; s <= seq; s++ {
+				if p := inFlight[s]; !p.acked {
+					p.acked = true
+					// El RTT es el del segmento que trajo el ACK
+					if s != seq {
+						cc.OnAck(0)
+					} else {
+						cc.OnAck(rtt)
+					}
+				}
+			}
+			for base < next && inFlight[base].acked {
+				st.Delivered(inFlight[base].size)
+				delete(inFlight, base)
+				base++
+			}
+
+			client.emit("sending-file-progress", map[string]interface{}{
+				"sent":       base,
+				"total":      reps,
+				"sentBytes":  min(int64(base)*protocol.SegmentSize, header.FileSize()),
+				"totalBytes": header.FileSize(),
+				"cwnd":       min(int(window), cc.Window()),
+			})
+
+		case <-time.After(wait):
+			st.Timeout()
+			if err := client.retransmitExpired(conn, inFlight, base, next, mode, rto.timeout(), st); err != nil {
+				return "", nil, err
+			}
+			cc.OnTimeout()
+			recovery = next
+			rto.backoff()
+			client.logf("Retransmission timeout, backing off: %v", rto)
 		}
+	}
+	client.logf("Sent %s, RTT estimate: %v, congestion window: %d", baseName, rto, cc.Window())
+	summary := st.Summary()
+	client.logf("Stats for %s: %v", baseName, summary)
+	client.emit("sending-file-summary", summary)
 
-		runtime.EventsEmit(ctx, "sending-file-progress", map[string]interface{}{
-			"sent":  i + 1,
-			"total": header.Reps(),
-		})
+	if hasher != nil {
+		trailer, err := (&protocol.Trailer{Checksum: hex.EncodeToString(hasher.Sum(nil))}).MarshalBinary()
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err := conn.Write(trailer); err != nil {
+			return "", nil, connectionLost(err)
+		}
+	}
+	if !session.Has(protocol.FeatureVerify) {
+		// Un receptor anterior no informa el resultado de la verificación
+		return FileSent, &summary, nil
+	}
+	if err := awaitVerify(acks); err != nil {
+		return "", &summary, err
+	}
+	return FileVerified, &summary, nil
+}
+
+// awaitVerify espera a que el receptor informe si el archivo pasó la verificación.
+// Los ACKs que siguen llegando son de retransmisiones ya confirmadas.
+func awaitVerify(acks *ackReader) error {
+	timeout := time.NewTimer(verifyTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case verdict := <-acks.verdicts:
+			if verdict.Result != protocol.VerifyOK {
+				return &verifyFailedError{message: verdict.Message}
+			}
+			return nil
+		case _, ok := <-acks.acks:
+			if !ok {
+				return acks.closedErr()
+			}
+		case <-timeout.C:
+			return errors.New("el receptor no informó el resultado de la verificación")
+		}
+	}
+}
+
+// nextTimeout calcula cuánto esperar hasta que venza el primer temporizador de
+// retransmisión, si cada uno dura timeout.
+func nextTimeout(inFlight map[uint32]*pendingSegment, base, next uint32, mode byte, timeout time.Duration) time.Duration {
+	if base == next {
+		return timeout
+	}
+	oldest := inFlight[base].sentAt
+	if mode == protocol.ARQSelectiveRepeat {
+		for s := base; s < next; s++ {
+			if p := inFlight[s]; !p.acked && p.sentAt.Before(oldest) {
+				oldest = p.sentAt
+			}
+		}
+	}
+	wait := time.Until(oldest.Add(timeout))
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// retransmitExpired reenvía los segmentos cuyo temporizador de duración timeout
+// venció. En Go-Back-N (y Stop-and-Wait) se reenvía toda la ventana; en Selective
+// Repeat solo los vencidos. Devuelve un retriesExhaustedError si alguno ya se
+// retransmitió maxRetries veces.
+func (c *Client) retransmitExpired(conn net.Conn, inFlight map[uint32]*pendingSegment, base, next uint32, mode byte, timeout time.Duration, st *stats.Collector) error {
+	now := time.Now()
+	for s := base; s < next; s++ {
+		p := inFlight[s]
+		if p.acked {
+			continue
+		}
+		if mode == protocol.ARQSelectiveRepeat && now.Sub(p.sentAt) < timeout {
+			continue
+		}
+		if p.retries >= maxRetries {
+			return &retriesExhaustedError{seq: s}
+		}
+		p.retries++
+		c.logf("Timeout waiting for ACK %d (retry %d of %d). Resending...", s, p.retries, maxRetries)
+		if err := c.writeSegment(conn, p.frame); err != nil {
+			return err
+		}
+		st.Retransmission()
+		st.Transferred(p.size)
+		p.sentAt = now
+		p.retransmitted = true
+	}
+	return nil
+}
+
+// resend reenvía los segmentos [from, to) que todavía no fueron confirmados.
+func (c *Client) resend(conn net.Conn, inFlight map[uint32]*pendingSegment, from, to uint32, st *stats.Collector) error {
+	now := time.Now()
+	for s := from; s < to; s++ {
+		p := inFlight[s]
+		if p.acked {
+			continue
+		}
+		if err := c.writeSegment(conn, p.frame); err != nil {
+			return err
+		}
+		st.Retransmission()
+		st.Transferred(p.size)
+		p.sentAt = now
+		p.retransmitted = true
+	}
+	return nil
+}
+
+// writeSegment envía un segmento ya codificado.
+func (c *Client) writeSegment(conn net.Conn, frame []byte) error {
+	if _, err := conn.Write(frame); err != nil {
+		return connectionLost(err)
 	}
 	return nil
 }
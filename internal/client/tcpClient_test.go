@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+)
+
+// Los rechazos y resultados que nadie lee no traban la lectura de los ACKs, y
+// stop libera la goroutine aunque queden ACKs sin leer.
+func TestAckReaderDoesNotBlock(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	r := newAckReader(client)
+
+	written := make(chan error, 1)
+	go func() {
+		frames := []interface{ MarshalBinary() ([]byte, error) }{
+			&protocol.Reject{Reason: protocol.RejectDeclined, Message: "no"},
+			&protocol.Reject{Reason: protocol.RejectDeclined, Message: "otra vez no"},
+			&protocol.Verify{Result: protocol.VerifyOK},
+			&protocol.Verify{Result: protocol.VerifyChecksumMismatch},
+		}
+		// Uno más de los que entran en el canal de ACKs
+		for seq := uint32(0); seq <= uint32(cap(r.acks)); seq++ {
+			frames = append(frames, &protocol.Ack{Type: protocol.TypeAckSegment, Seq: seq})
+		}
+		for _, frame := range frames {
+			b, err := frame.MarshalBinary()
+			if err != nil {
+				written <- err
+				return
+			}
+			if _, err := server.Write(b); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- nil
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("la lectura se trabó con un rechazo o un resultado sin leer")
+	}
+
+	if reject := <-r.rejects; reject.Message != "no" {
+		t.Errorf("llegó el rechazo %q, se esperaba el primero", reject.Message)
+	}
+	r.stop()
+	server.Close()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-r.acks:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("la goroutine de lectura no terminó")
+		}
+	}
+}
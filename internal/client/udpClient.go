@@ -1,82 +1,143 @@
 package server
 
 import (
-	"context"
-	"crypto/md5"
-	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"io"
-	"log"
 	"net"
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/NeichS/final-redes-wails/internal/congestion"
+	"github.com/NeichS/final-redes-wails/internal/impair"
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+	"github.com/NeichS/final-redes-wails/internal/shared"
+	"github.com/NeichS/final-redes-wails/internal/stats"
 )
 
 const (
-	udpPacketSize = 1024
+	udpPacketSize = protocol.UDPSegmentSize
+	// Tiempo de espera de una respuesta del servidor en modo fiable
+	udpReplyTimeout = 500 * time.Millisecond
+	// Reintentos consecutivos sin respuesta antes de abandonar el archivo
+	udpMaxRetries = 10
+	// Tiempo que el modo simple espera un posible rechazo del paquete de inicio
+	udpRejectWait = 50 * time.Millisecond
+	// Tiempo máximo que se espera mientras el receptor consulta al usuario, que
+	// puede tener que aceptar el archivo y después decidir si reemplaza otro
+	udpDecisionWait = 130 * time.Second
+	// Cada cuánto se repite el paquete de inicio mientras tanto
+	udpPendingPoll = 2 * time.Second
 )
 
-func startUDPClient(ctx context.Context, addr, port string, filePaths []string) error {
-	serverAddr, err := net.ResolveUDPAddr("udp", addr+":"+port)
+func startUDPClient(fi FileSenderInfo, client *Client) error {
+	serverAddr, err := net.ResolveUDPAddr("udp", fi.Address+":"+fi.Port)
 	if err != nil {
-		runtime.EventsEmit(ctx, "client-error", fmt.Sprintf("Error resolviendo UDP: %v", err))
+		client.emit("client-error", fmt.Sprintf("Error resolviendo UDP: %v", err))
 		return err
 	}
 
-	conn, err := net.DialUDP("udp", nil, serverAddr)
+	raw, err := net.DialUDP("udp", nil, serverAddr)
 	if err != nil {
-		runtime.EventsEmit(ctx, "client-error", fmt.Sprintf("No se pudo conectar (UDP): %v", err))
+		client.emit("client-error", fmt.Sprintf("No se pudo conectar (UDP): %v", err))
 		return err
 	}
+	// Los datagramas salen por el simulador de red
+	conn := impair.NewSender(raw, &client.impairment, impair.UDP)
 	defer conn.Close()
 
-	totalFiles := len(filePaths)
-	for i, path := range filePaths {
-		runtime.EventsEmit(ctx, "sending-file-start", map[string]interface{}{
+	// Sin ACKs no hay con qué regular el ritmo: el modo simple mantiene la pausa fija
+	algorithm := congestion.Fixed
+	if fi.ReliableUDP {
+		algorithm = fi.CongestionControl
+	}
+	cc, err := congestion.New(algorithm)
+	if err != nil {
+		return err
+	}
+	// La ventana y el RTT medidos con un archivo sirven para los siguientes
+	sender := newUDPSender(conn, cc, fi.ReliableUDP, client)
+
+	totalFiles := len(fi.Paths)
+	for i, path := range fi.Paths {
+		client.emit("sending-file-start", map[string]interface{}{
 			"fileName":    filepath.Base(path),
 			"currentFile": i + 1,
 			"totalFiles":  totalFiles,
 		})
 
-		err := sendSingleFileUDP(ctx, path, conn)
+		err := sendSingleFileUDP(path, sender, fi.HashAlgorithm, client)
 		if err != nil {
-			runtime.EventsEmit(ctx, "client-error", fmt.Sprintf("Error enviando %s: %v", filepath.Base(path), err))
+			client.emit("client-error", fmt.Sprintf("Error enviando %s: %v", filepath.Base(path), err))
 		}
 		// Una pequeña pausa entre archivos para que el servidor pueda procesarlos.
 		time.Sleep(250 * time.Millisecond)
 	}
 
-	runtime.EventsEmit(ctx, "reception-finished", "¡Todos los archivos enviados!")
+	client.emit("reception-finished", "¡Todos los archivos enviados!")
 	return nil
 }
 
-func sendSingleFileUDP(ctx context.Context, filePath string, conn *net.UDPConn) error {
+func sendSingleFileUDP(filePath string, sender *udpSender, algorithm string, client *Client) error {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	// El checksum se calcula mientras se envía y viaja en el paquete final
+	hasher, err := shared.NewHash(algorithm)
+	if err != nil {
 		return err
 	}
-	checksum := hex.EncodeToString(hash.Sum(nil))
-	file.Seek(0, 0) // Rebobinar para leer el archivo
 
 	baseName := filepath.Base(filePath)
-	fileInfo, _ := file.Stat()
-	totalSegments := uint32(fileInfo.Size()/udpPacketSize) + 1
+	meta, err := shared.NewMetadata(file, baseName, algorithm, "")
+	if err != nil {
+		return err
+	}
+	size := meta.FileSize()
+	totalSegments := protocol.Segments(uint64(size), udpPacketSize)
 
-	startPacket := createStartPacket(totalSegments, baseName, checksum)
-	_, err = conn.Write(startPacket)
+	conn, reliable := sender.conn, sender.reliable
+	mode := protocol.UDPBestEffort
+	if reliable {
+		mode = protocol.UDPReliable
+	}
+
+	start := &protocol.UDPStart{
+		TotalSegments: totalSegments,
+		Size:          uint64(size),
+		Mode:          mode,
+		ModTime:       meta.ModTime().UnixNano(),
+		Perm:          uint32(meta.Mode()),
+		HashAlgorithm: wireHash(algorithm),
+		Name:          baseName,
+	}
+	startPacket, err := start.MarshalBinary()
 	if err != nil {
-		return fmt.Errorf("falló el envío del paquete de inicio: %w", err)
+		return err
+	}
+	var startAck *protocol.UDPStartAck
+	if reliable {
+		startAck, err = client.sendStartReliable(conn, startPacket)
+	} else {
+		_, err = conn.Write(startPacket)
+		if err != nil {
+			return fmt.Errorf("falló el envío del paquete de inicio: %w", err)
+		}
+		startAck, err = client.checkStartReply(conn, startPacket)
+	}
+	if err != nil {
+		return err
+	}
+	if skip := reportPlacement(client, baseName, startAck.Status, startAck.Name); skip {
+		return nil
 	}
 
+	sender.startFile(stats.New(baseName, uint64(size), 0))
 	buffer := make([]byte, udpPacketSize)
 	for seqNum := uint32(1); seqNum <= totalSegments; seqNum++ {
 		n, err := file.Read(buffer)
@@ -86,59 +147,216 @@ func sendSingleFileUDP(ctx context.Context, filePath string, conn *net.UDPConn)
 		if n == 0 {
 			break
 		}
+		// Los NAKs se atienden releyendo el archivo, así que cada byte entra una sola vez
+		hasher.Write(buffer[:n])
 
-		dataPacket := createDataPacket(seqNum, buffer[:n])
-		_, err = conn.Write(dataPacket)
-		if err != nil {
-			log.Printf("Error enviando segmento %d: %v", seqNum, err)
-			// En este modo simple, ignoramos el error y continuamos
+		if err := sender.send(seqNum, buffer[:n], false); err != nil {
+			return err
 		}
 
-		runtime.EventsEmit(ctx, "sending-file-progress", map[string]interface{}{
-			"sent":  seqNum,
-			"total": totalSegments,
-		})
+		progress := map[string]interface{}{
+			"sent":       seqNum,
+			"total":      totalSegments,
+			"sentBytes":  min(int64(seqNum)*udpPacketSize, size),
+			"totalBytes": size,
+		}
+		if cwnd := sender.window(); cwnd > 0 {
+			progress["cwnd"] = cwnd
+		}
+		client.emit("sending-file-progress", progress)
+	}
 
-		time.Sleep(1 * time.Millisecond)
+	endPacket := client.encodePacket(&protocol.UDPEnd{Seq: totalSegments + 1, Checksum: hex.EncodeToString(hasher.Sum(nil))})
+	if reliable {
+		err := finishReliable(sender, file, endPacket)
+		sender.forget()
+		if err == nil {
+			// El servidor tiene todo, aunque se hayan perdido algunos ACKs
+			sender.completeFile()
+		}
+		reportSummary(client, sender)
+		if err != nil {
+			return err
+		}
+		client.logf("Reliable send of '%s' completed (%v).", baseName, sender.rto)
+		return nil
 	}
 
-	endPacket := createEndPacket(totalSegments + 1)
 	_, err = conn.Write(endPacket)
 	if err != nil {
-		log.Printf("Error enviando paquete final: %v", err)
+		client.logf("Error sending final packet: %v", err)
 	}
 
-	log.Printf("Envío simple de '%s' completado.", baseName)
+	reportSummary(client, sender)
+	client.logf("Best-effort send of '%s' completed.", baseName)
 	return nil
 }
 
-func createStartPacket(totalSegs uint32, name, checksum string) []byte {
-	packet := []byte{1}
-	temp := make([]byte, 4)
-	binary.BigEndian.PutUint32(temp, totalSegs)
-	packet = append(packet, temp...)
-	binary.BigEndian.PutUint32(temp, uint32(len(name)))
-	packet = append(packet, temp...)
-	binary.BigEndian.PutUint32(temp, uint32(len(checksum)))
-	packet = append(packet, temp...)
-	packet = append(packet, []byte(name)...)
-	packet = append(packet, []byte(checksum)...)
-	return packet
+func reportSummary(client *Client, sender *udpSender) {
+	summary := sender.stats.Summary()
+	client.logf("Stats for '%s': %v", summary.File, summary)
+	client.emit("sending-file-summary", summary)
 }
 
-func createDataPacket(seqNum uint32, data []byte) []byte {
-	packet := []byte{2}
-	temp := make([]byte, 4)
-	binary.BigEndian.PutUint32(temp, seqNum)
-	packet = append(packet, temp...)
-	packet = append(packet, data...)
-	return packet
+// sendStartReliable reenvía el paquete de inicio hasta que el servidor lo confirma.
+func (c *Client) sendStartReliable(conn net.Conn, startPacket []byte) (*protocol.UDPStartAck, error) {
+	reply := make([]byte, protocol.MaxDatagramSize)
+	for attempt := 0; attempt < udpMaxRetries; attempt++ {
+		if _, err := conn.Write(startPacket); err != nil {
+			return nil, fmt.Errorf("falló el envío del paquete de inicio: %w", err)
+		}
+		n, err := readReply(conn, reply)
+		if err != nil {
+			if isTimeout(err) {
+				continue
+			}
+			return nil, err
+		}
+		switch p := c.parseReply(reply[:n]).(type) {
+		case *protocol.UDPStartAck:
+			if p.Status == protocol.AckStatusPending {
+				return c.awaitDecision(conn, startPacket)
+			}
+			return p, nil
+		case *protocol.UDPReject:
+			return nil, &fileRejectedError{reason: p.Reason, message: p.Message}
+		}
+	}
+	return nil, errors.New("el servidor no confirmó el inicio de la transferencia")
+}
+
+// checkStartReply espera brevemente una respuesta al paquete de inicio. En el
+// modo simple el servidor solo contesta si rechaza el archivo o si ya existía.
+func (c *Client) checkStartReply(conn net.Conn, startPacket []byte) (*protocol.UDPStartAck, error) {
+	reply := make([]byte, protocol.MaxDatagramSize)
+	conn.SetReadDeadline(time.Now().Add(udpRejectWait))
+	defer conn.SetReadDeadline(time.Time{})
+	n, err := conn.Read(reply)
+	if err != nil {
+		return &protocol.UDPStartAck{}, nil
+	}
+	switch p := c.parseReply(reply[:n]).(type) {
+	case *protocol.UDPStartAck:
+		if p.Status == protocol.AckStatusPending {
+			return c.awaitDecision(conn, startPacket)
+		}
+		return p, nil
+	case *protocol.UDPReject:
+		return nil, &fileRejectedError{reason: p.Reason, message: p.Message}
+	}
+	return &protocol.UDPStartAck{}, nil
+}
+
+// awaitDecision espera la respuesta definitiva mientras el receptor le pregunta
+// al usuario qué hacer con el archivo. El paquete de inicio se repite cada tanto
+// por si esa respuesta se pierde.
+func (c *Client) awaitDecision(conn net.Conn, startPacket []byte) (*protocol.UDPStartAck, error) {
+	c.logf("UDP: receiver is asking the user")
+	reply := make([]byte, protocol.MaxDatagramSize)
+	defer conn.SetReadDeadline(time.Time{})
+	deadline := time.Now().Add(udpDecisionWait)
+	for time.Now().Before(deadline) {
+		conn.SetReadDeadline(time.Now().Add(udpPendingPoll))
+		n, err := conn.Read(reply)
+		if err != nil {
+			if !isTimeout(err) {
+				return nil, err
+			}
+			if _, err := conn.Write(startPacket); err != nil {
+				return nil, fmt.Errorf("falló el envío del paquete de inicio: %w", err)
+			}
+			continue
+		}
+		switch p := c.parseReply(reply[:n]).(type) {
+		case *protocol.UDPStartAck:
+			if p.Status != protocol.AckStatusPending {
+				return p, nil
+			}
+		case *protocol.UDPReject:
+			return nil, &fileRejectedError{reason: p.Reason, message: p.Message}
+		}
+	}
+	return nil, errors.New("el receptor no respondió a tiempo")
+}
+
+// finishReliable envía el paquete final y retransmite los segmentos que el servidor
+// reporte como faltantes (o dañados) hasta recibir la confirmación de archivo completo.
+// Las retransmisiones también respetan el control de congestión.
+func finishReliable(sender *udpSender, file *os.File, endPacket []byte) error {
+	buffer := make([]byte, udpPacketSize)
+	retries := 0
+	for retries < udpMaxRetries {
+		if _, err := sender.conn.Write(endPacket); err != nil {
+			return fmt.Errorf("falló el envío del paquete final: %w", err)
+		}
+		reply, err := sender.awaitReply()
+		if err != nil {
+			if isTimeout(err) {
+				retries++
+				continue
+			}
+			return err
+		}
+
+		switch p := reply.(type) {
+		case *protocol.UDPComplete:
+			return nil
+		case *protocol.UDPNak:
+			missing := p.Missing
+			sender.client.logf("UDP: server requested %d missing segments", len(missing))
+			// El NAK dice qué falta: ya no se esperan los ACKs de lo enviado antes
+			sender.forget()
+			for _, seq := range missing {
+				read, err := file.ReadAt(buffer, int64(seq-1)*udpPacketSize)
+				if err != nil && err != io.EOF {
+					return err
+				}
+				if err := sender.send(seq, buffer[:read], true); err != nil {
+					return err
+				}
+			}
+			retries = 0
+		}
+	}
+	return errors.New("el servidor dejó de responder durante la transferencia")
 }
 
-func createEndPacket(seqNum uint32) []byte {
-	packet := []byte{3}
-	temp := make([]byte, 4)
-	binary.BigEndian.PutUint32(temp, seqNum)
-	packet = append(packet, temp...)
+func readReply(conn net.Conn, buffer []byte) (int, error) {
+	conn.SetReadDeadline(time.Now().Add(udpReplyTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	n, err := conn.Read(buffer)
+	if err == nil && n == 0 {
+		return 0, errors.New("respuesta vacía del servidor")
+	}
+	return n, err
+}
+
+// parseReply decodifica una respuesta del servidor; las inválidas se descartan.
+func (c *Client) parseReply(b []byte) protocol.Frame {
+	packet, err := protocol.ParsePacket(b)
+	if err != nil {
+		c.logf("UDP: invalid reply from server: %v", err)
+		return nil
+	}
 	return packet
 }
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// dataPacket codifica un fragmento con su CRC.
+func (c *Client) dataPacket(seq uint32, data []byte) []byte {
+	return c.encodePacket(&protocol.UDPData{Seq: seq, CRC: protocol.SegmentCRC(seq, data), Data: data})
+}
+
+// encodePacket serializa un paquete UDP. Los paquetes que arma el cliente siempre
+// son válidos, así que un error acá indica un bug y se reporta como tal.
+func (c *Client) encodePacket(packet protocol.Frame) []byte {
+	b, err := packet.MarshalBinary()
+	if err != nil {
+		c.logf("UDP: error encoding packet %T: %v", packet, err)
+	}
+	return b
+}
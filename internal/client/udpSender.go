@@ -0,0 +1,290 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/NeichS/final-redes-wails/internal/congestion"
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+	"github.com/NeichS/final-redes-wails/internal/stats"
+)
+
+const (
+	// Cantidad de envíos posteriores confirmados después de la cual un segmento
+	// sin ACK se da por perdido, como los tres ACKs duplicados de TCP
+	udpDupThresh = 3
+	// Cuánto puede atrasarse el ritmo de envío antes de dejar de recuperar el
+	// atraso con envíos seguidos
+	udpPacingSlack = 5 * time.Millisecond
+)
+
+// udpSender envía los segmentos de datos de una conexión UDP. En el modo fiable
+// cada segmento queda en vuelo hasta que llega su ACK, y el control de
+// congestión decide cuántos puede haber en vuelo y cada cuánto sale uno. Un
+// segmento sin ACK no se reenvía enseguida: se da por perdido para reducir el
+// ritmo y lo vuelve a pedir el NAK del final. En el modo simple no hay ACKs y
+// solo se respeta la pausa entre envíos.
+type udpSender struct {
+	conn     net.Conn
+	cc       congestion.Controller
+	rto      *rtoEstimator
+	reliable bool
+	client   *Client
+
+	// stats mide el archivo en curso; sizes guarda los bytes de datos de cada
+	// segmento enviado y delivered los que el servidor ya confirmó, para contar
+	// también los ACKs de segmentos que se habían dado por perdidos
+	stats     *stats.Collector
+	sizes     map[uint32]int
+	delivered map[uint32]bool
+
+	// queue tiene los envíos en vuelo en el orden en que salieron, y pending
+	// los indexa por secuencia. Los que ya se confirmaron o se dieron por
+	// perdidos se sacan de queue cuando llegan al frente.
+	queue    []*udpInFlight
+	pending  map[uint32]*udpInFlight
+	inFlight int
+	// sent numera los envíos y acked es el número del último confirmado
+	sent, acked uint64
+	// Las pérdidas de envíos hasta recovery ya redujeron el ritmo
+	recovery uint64
+	// timeouts cuenta los timeouts seguidos sin ningún ACK
+	timeouts int
+	nextSend time.Time
+	reply    []byte
+}
+
+type udpInFlight struct {
+	seq           uint32
+	order         uint64
+	sentAt        time.Time
+	retransmitted bool
+	done          bool
+}
+
+func newUDPSender(conn net.Conn, cc congestion.Controller, reliable bool, client *Client) *udpSender {
+	return &udpSender{
+		conn:     conn,
+		cc:       cc,
+		rto:      newRTOEstimator(),
+		reliable: reliable,
+		client:   client,
+		pending:  make(map[uint32]*udpInFlight),
+		reply:    make([]byte, protocol.MaxDatagramSize),
+	}
+}
+
+// startFile empieza a medir un archivo nuevo.
+func (s *udpSender) startFile(st *stats.Collector) {
+	s.stats = st
+	s.sizes = make(map[uint32]int)
+	s.delivered = make(map[uint32]bool)
+}
+
+// completeFile cuenta como entregados los segmentos cuyo ACK no llegó, una vez
+// que el servidor confirmó el archivo completo.
+func (s *udpSender) completeFile() {
+	for seq, n := range s.sizes {
+		if !s.delivered[seq] {
+			s.delivered[seq] = true
+			s.stats.Delivered(n)
+		}
+	}
+}
+
+// send envía un segmento cuando el control de congestión lo permite. Un error
+// al escribir no detiene el envío: el segmento queda como perdido.
+func (s *udpSender) send(seq uint32, data []byte, retransmission bool) error {
+	if err := s.waitTurn(); err != nil {
+		return err
+	}
+	if _, err := s.conn.Write(s.client.dataPacket(seq, data)); err != nil {
+		s.client.logf("Error sending segment %d: %v", seq, err)
+	}
+	s.stats.Transferred(len(data))
+	if retransmission {
+		s.stats.Retransmission()
+	}
+	s.report()
+	if !s.reliable {
+		// Sin ACKs no se sabe qué llegó: se cuenta lo enviado
+		s.stats.Delivered(len(data))
+		return nil
+	}
+	s.sizes[seq] = len(data)
+	if old, ok := s.pending[seq]; ok {
+		old.done = true
+		s.inFlight--
+	}
+	s.sent++
+	p := &udpInFlight{seq: seq, order: s.sent, sentAt: time.Now(), retransmitted: retransmission}
+	s.queue = append(s.queue, p)
+	s.pending[seq] = p
+	s.inFlight++
+	return nil
+}
+
+// waitTurn espera a que haya lugar en la ventana y a que pase la pausa desde el
+// envío anterior, atendiendo los ACKs que llegan mientras tanto.
+func (s *udpSender) waitTurn() error {
+	for {
+		if s.reliable && s.inFlight >= s.cc.Window() {
+			if err := s.poll(time.Now().Add(s.rto.timeout()), true); err != nil {
+				return err
+			}
+			continue
+		}
+		wait := time.Until(s.nextSend)
+		if wait <= 0 {
+			break
+		}
+		if !s.reliable {
+			time.Sleep(wait)
+			break
+		}
+		if err := s.poll(s.nextSend, false); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	if s.nextSend.Before(now.Add(-udpPacingSlack)) {
+		s.nextSend = now
+	}
+	s.nextSend = s.nextSend.Add(s.cc.Pacing())
+	return nil
+}
+
+// poll atiende una respuesta del servidor que llegue antes de deadline. Si la
+// ventana está llena y no llega nada, es un timeout.
+func (s *udpSender) poll(deadline time.Time, full bool) error {
+	s.conn.SetReadDeadline(deadline)
+	defer s.conn.SetReadDeadline(time.Time{})
+	n, err := s.conn.Read(s.reply)
+	if err != nil {
+		if !isTimeout(err) {
+			return err
+		}
+		if full {
+			return s.timeout()
+		}
+		return nil
+	}
+	if ack, ok := s.client.parseReply(s.reply[:n]).(*protocol.UDPAck); ok {
+		s.ack(ack.Seq)
+	}
+	return nil
+}
+
+// awaitReply espera una respuesta que no sea un ACK, atendiendo los ACKs que
+// llegan antes.
+func (s *udpSender) awaitReply() (protocol.Frame, error) {
+	s.conn.SetReadDeadline(time.Now().Add(udpReplyTimeout))
+	defer s.conn.SetReadDeadline(time.Time{})
+	for {
+		n, err := s.conn.Read(s.reply)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, errors.New("respuesta vacía del servidor")
+		}
+		p := s.client.parseReply(s.reply[:n])
+		if ack, ok := p.(*protocol.UDPAck); ok {
+			s.ack(ack.Seq)
+			continue
+		}
+		return p, nil
+	}
+}
+
+// ack procesa la confirmación de seq y da por perdidos los envíos que quedaron
+// udpDupThresh confirmaciones atrás.
+func (s *udpSender) ack(seq uint32) {
+	if s.delivered[seq] {
+		s.stats.Duplicate()
+	} else if n, ok := s.sizes[seq]; ok {
+		s.delivered[seq] = true
+		s.stats.Delivered(n)
+	}
+	p, ok := s.pending[seq]
+	if !ok {
+		// Duplicado, o de un segmento que ya se dio por perdido
+		return
+	}
+	s.timeouts = 0
+	s.forgetOne(p)
+	var rtt time.Duration
+	if !p.retransmitted {
+		rtt = time.Since(p.sentAt)
+		s.rto.sample(rtt)
+		s.stats.RTT(rtt)
+	}
+	s.cc.OnAck(rtt)
+	s.acked = max(s.acked, p.order)
+
+	for len(s.queue) > 0 {
+		q := s.queue[0]
+		if !q.done {
+			if q.order+udpDupThresh > s.acked {
+				break
+			}
+			s.forgetOne(q)
+			// Varias pérdidas de la misma ventana reducen el ritmo una sola vez
+			if q.order > s.recovery {
+				s.cc.OnLoss()
+				s.recovery = s.sent
+			}
+		}
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+	}
+}
+
+// timeout reduce el ritmo cuando se vence el temporizador sin ningún ACK. Todo
+// lo que estaba en vuelo se da por perdido.
+func (s *udpSender) timeout() error {
+	s.timeouts++
+	s.stats.Timeout()
+	s.report()
+	if s.timeouts > udpMaxRetries {
+		return errors.New("el servidor dejó de confirmar los segmentos")
+	}
+	s.cc.OnTimeout()
+	s.rto.backoff()
+	s.forget()
+	s.recovery = s.sent
+	s.client.logf("UDP: timeout waiting for ACKs, window %d, %v", s.cc.Window(), s.rto)
+	return nil
+}
+
+func (s *udpSender) forgetOne(p *udpInFlight) {
+	p.done = true
+	delete(s.pending, p.seq)
+	s.inFlight--
+}
+
+// forget deja de esperar los ACKs de lo que está en vuelo: después de un NAK o
+// al terminar un archivo, los faltantes ya los informó el servidor.
+func (s *udpSender) forget() {
+	clear(s.queue)
+	s.queue = s.queue[:0]
+	clear(s.pending)
+	s.inFlight = 0
+}
+
+// report informa las estadísticas del archivo cada stats.Interval.
+func (s *udpSender) report() {
+	if snapshot, ok := s.stats.Due(); ok {
+		s.client.emit("sending-file-stats", snapshot)
+	}
+}
+
+// window devuelve la ventana de congestión para los eventos de progreso, o 0 si
+// no hay una (modo simple o un algoritmo sin ventana).
+func (s *udpSender) window() int {
+	if w := s.cc.Window(); s.reliable && w <= congestion.MaxWindow {
+		return w
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+// Package congestion decide cuánto puede enviar un emisor según lo que le dicen
+// los ACKs: una ventana de segmentos en vuelo y, opcionalmente, una pausa
+// mínima entre envíos. Cada algoritmo implementa Controller y se elige por
+// nombre (ver New), para comparar su comportamiento sobre el mismo enlace.
+//
+// Un Controller no es seguro para usar desde varias goroutines: cada envío
+// tiene el suyo.
+package congestion
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Controller regula el ritmo de un emisor.
+type Controller interface {
+	// Window es la cantidad de segmentos que pueden estar en vuelo.
+	Window() int
+	// Pacing es la pausa mínima entre dos envíos; 0 no limita el ritmo.
+	Pacing() time.Duration
+	// OnAck se llama por cada segmento confirmado, con su RTT o 0 si no se
+	// pudo medir (por ejemplo, porque se había retransmitido).
+	OnAck(rtt time.Duration)
+	// OnLoss se llama una vez por cada episodio de pérdidas que detectan los ACKs.
+	OnLoss()
+	// OnTimeout se llama cuando se agota el temporizador sin ninguna confirmación.
+	OnTimeout()
+}
+
+// Algoritmos disponibles.
+const (
+	// Reno es el AIMD de TCP Reno: arranque lento y prevención de congestión
+	// sobre una ventana.
+	Reno = "reno"
+	// Rate aplica el mismo esquema a un ritmo de envío en segmentos por segundo.
+	Rate = "rate"
+	// Fixed es el comportamiento anterior al control de congestión: sin límite
+	// de ventana y una pausa fija entre envíos.
+	Fixed = "fixed"
+)
+
+// Default es el algoritmo que se usa si no se elige otro.
+const Default = Reno
+
+// Límites de la ventana de congestión, en segmentos.
+const (
+	InitialWindow = 4
+	MaxWindow     = 4096
+)
+
+// FixedPacing es la pausa entre envíos de Fixed.
+const FixedPacing = 1 * time.Millisecond
+
+var controllers = map[string]func() Controller{
+	Reno:  func() Controller { return NewReno() },
+	Rate:  func() Controller { return NewRate() },
+	Fixed: func() Controller { return fixed{} },
+}
+
+// Algorithms devuelve los algoritmos disponibles, empezando por el predeterminado.
+func Algorithms() []string {
+	return []string{Reno, Rate, Fixed}
+}
+
+// Normalize devuelve el nombre canónico del algoritmo; el vacío es Default.
+func Normalize(name string) (string, error) {
+	if name == "" {
+		return Default, nil
+	}
+	if _, ok := controllers[name]; !ok {
+		return "", fmt.Errorf("control de congestión desconocido: %q", name)
+	}
+	return name, nil
+}
+
+// New crea el controlador del algoritmo indicado; el vacío es Default.
+func New(name string) (Controller, error) {
+	name, err := Normalize(name)
+	if err != nil {
+		return nil, err
+	}
+	return controllers[name](), nil
+}
+
+// fixed no regula nada: la ventana es la que elija el emisor y el ritmo, uno
+// cada FixedPacing. Es lo único que se puede usar sin ACKs.
+type fixed struct{}
+
+func (fixed) Window() int           { return math.MaxInt32 }
+func (fixed) Pacing() time.Duration { return FixedPacing }
+func (fixed) OnAck(time.Duration)   {}
+func (fixed) OnLoss()               {}
+func (fixed) OnTimeout()            {}
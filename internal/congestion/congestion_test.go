@@ -0,0 +1,114 @@
+package congestion
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, name := range Algorithms() {
+		if got, err := Normalize(name); err != nil || got != name {
+			t.Errorf("Normalize(%q) = %q, %v", name, got, err)
+		}
+	}
+	if got, _ := Normalize(""); got != Default {
+		t.Errorf("Normalize(\"\") = %q, se esperaba %q", got, Default)
+	}
+	if _, err := New("cubic"); err == nil {
+		t.Error("New aceptó un algoritmo desconocido")
+	}
+}
+
+// ackWindow confirma una ventana completa, como ocurre en un RTT.
+func ackWindow(c Controller) {
+	for n := c.Window(); n > 0; n-- {
+		c.OnAck(10 * time.Millisecond)
+	}
+}
+
+func TestRenoSlowStartAndAvoidance(t *testing.T) {
+	r := NewReno()
+	// En el arranque lento la ventana se duplica en cada RTT
+	for _, want := range []int{8, 16, 32} {
+		ackWindow(r)
+		if got := r.Window(); got != want {
+			t.Fatalf("ventana %d después de un RTT, se esperaba %d", got, want)
+		}
+	}
+
+	r.OnLoss()
+	if got := r.Window(); got != 16 {
+		t.Fatalf("ventana %d después de una pérdida, se esperaba 16", got)
+	}
+	if r.SlowStart() {
+		t.Fatal("después de una pérdida la ventana sigue en el arranque lento")
+	}
+	// En la prevención de congestión crece casi un segmento por RTT: cada ACK
+	// suma 1/cwnd con la ventana que ya creció
+	for _, want := range []float64{17, 18} {
+		ackWindow(r)
+		if r.cwnd < want-0.2 || r.cwnd > want {
+			t.Fatalf("ventana %.2f después de un RTT, se esperaba cerca de %v", r.cwnd, want)
+		}
+	}
+
+	r.OnTimeout()
+	if got := r.Window(); got != 1 {
+		t.Fatalf("ventana %d después de un timeout, se esperaba 1", got)
+	}
+	// El arranque lento llega hasta la mitad de la ventana del timeout
+	if !r.SlowStart() {
+		t.Fatal("después de un timeout la ventana no vuelve al arranque lento")
+	}
+	for r.SlowStart() {
+		ackWindow(r)
+	}
+	if got := r.Window(); got < 9 || got > 16 {
+		t.Errorf("el arranque lento terminó con una ventana de %d, se esperaba cerca de 9", got)
+	}
+}
+
+func TestRenoWindowLimit(t *testing.T) {
+	r := NewReno()
+	for i := 0; i < 2*MaxWindow; i++ {
+		r.OnAck(time.Millisecond)
+	}
+	if got := r.Window(); got != MaxWindow {
+		t.Errorf("ventana %d, se esperaba el máximo %d", got, MaxWindow)
+	}
+}
+
+func TestRateAIMD(t *testing.T) {
+	r := NewRate()
+	if got, want := r.Pacing(), time.Second/initialRate; got != want {
+		t.Fatalf("pausa inicial %v, se esperaba %v", got, want)
+	}
+	// Con RTT de 100 ms una ronda son rate/10 ACKs
+	rtt := 100 * time.Millisecond
+	round := func() {
+		for n := int(r.Rate() / 10); n > 0; n-- {
+			r.OnAck(rtt)
+		}
+	}
+	round()
+	if got := r.Rate(); got != 2*initialRate {
+		t.Fatalf("ritmo %v después de una ronda, se esperaba %v", got, 2*initialRate)
+	}
+	if got := r.Window(); got != 2*initialRate/5 {
+		t.Errorf("ventana %d, se esperaban los segmentos de dos RTT (%d)", got, 2*initialRate/5)
+	}
+
+	r.OnLoss()
+	if got := r.Rate(); got != initialRate {
+		t.Fatalf("ritmo %v después de una pérdida, se esperaba %v", got, initialRate)
+	}
+	round()
+	if got := r.Rate(); got != initialRate+rateStep {
+		t.Fatalf("ritmo %v en la prevención de congestión, se esperaba %v", got, initialRate+rateStep)
+	}
+
+	r.OnTimeout()
+	if got := r.Rate(); got != minRate {
+		t.Errorf("ritmo %v después de un timeout, se esperaba %v", got, minRate)
+	}
+}
@@ -0,0 +1,83 @@
+package congestion
+
+import (
+	"math"
+	"time"
+)
+
+// Límites del ritmo de RateController, en segmentos por segundo.
+const (
+	initialRate = 250
+	minRate     = 10
+	maxRate     = 100000
+	// rateStep es cuánto crece el ritmo por RTT fuera del arranque lento
+	rateStep = 25
+)
+
+// RateController aplica AIMD al ritmo de envío en lugar de a la ventana: los
+// segmentos salen separados por 1/ritmo. Mientras está en el arranque lento el
+// ritmo se duplica en cada RTT y después crece rateStep segmentos por segundo
+// por RTT; una pérdida lo reduce a la mitad y un timeout lo vuelve al mínimo.
+//
+// El RTT se cuenta en ACKs: una ronda termina cuando se confirmaron los
+// segmentos que se envían en un RTT al ritmo actual.
+type RateController struct {
+	rate     float64
+	ssthresh float64
+	srtt     time.Duration
+	acked    float64
+}
+
+func NewRate() *RateController {
+	return &RateController{rate: initialRate, ssthresh: maxRate}
+}
+
+// Window deja en vuelo lo que se envía en dos RTT al ritmo actual, para que la
+// ventana no frene al ritmo pero tampoco se acumulen envíos sin confirmar si
+// los ACKs dejan de llegar.
+func (r *RateController) Window() int {
+	w := r.rate * r.srtt.Seconds() * 2
+	return int(min(max(math.Ceil(w), InitialWindow), MaxWindow))
+}
+
+func (r *RateController) Pacing() time.Duration {
+	return time.Duration(float64(time.Second) / r.rate)
+}
+
+// Rate devuelve el ritmo actual en segmentos por segundo.
+func (r *RateController) Rate() float64 {
+	return r.rate
+}
+
+func (r *RateController) OnAck(rtt time.Duration) {
+	if rtt > 0 {
+		if r.srtt == 0 {
+			r.srtt = rtt
+		} else {
+			r.srtt = (7*r.srtt + rtt) / 8
+		}
+	}
+	r.acked++
+	if r.acked < r.rate*r.srtt.Seconds() {
+		return
+	}
+	r.acked = 0
+	if r.rate < r.ssthresh {
+		r.rate *= 2
+	} else {
+		r.rate += rateStep
+	}
+	r.rate = min(r.rate, maxRate)
+}
+
+func (r *RateController) OnLoss() {
+	r.ssthresh = max(r.rate/2, minRate)
+	r.rate = r.ssthresh
+	r.acked = 0
+}
+
+func (r *RateController) OnTimeout() {
+	r.ssthresh = max(r.rate/2, minRate)
+	r.rate = minRate
+	r.acked = 0
+}
@@ -0,0 +1,50 @@
+package congestion
+
+import "time"
+
+// RenoController es el control de congestión de TCP Reno (RFC 5681). La ventana
+// empieza en InitialWindow y crece un segmento por ACK (se duplica en cada RTT)
+// hasta el umbral; de ahí en más crece un segmento por RTT. Una pérdida la
+// reduce a la mitad y un timeout la vuelve a un segmento.
+type RenoController struct {
+	cwnd     float64
+	ssthresh float64
+}
+
+func NewReno() *RenoController {
+	return &RenoController{cwnd: InitialWindow, ssthresh: MaxWindow}
+}
+
+func (r *RenoController) Window() int {
+	return int(r.cwnd)
+}
+
+func (r *RenoController) Pacing() time.Duration {
+	return 0
+}
+
+func (r *RenoController) OnAck(time.Duration) {
+	if r.cwnd < r.ssthresh {
+		// Arranque lento
+		r.cwnd++
+	} else {
+		// Prevención de congestión: 1/cwnd por ACK suma un segmento por ventana
+		r.cwnd += 1 / r.cwnd
+	}
+	r.cwnd = min(r.cwnd, MaxWindow)
+}
+
+func (r *RenoController) OnLoss() {
+	r.ssthresh = max(r.cwnd/2, 2)
+	r.cwnd = r.ssthresh
+}
+
+func (r *RenoController) OnTimeout() {
+	r.ssthresh = max(r.cwnd/2, 2)
+	r.cwnd = 1
+}
+
+// SlowStart indica si la ventana todavía está en el arranque lento.
+func (r *RenoController) SlowStart() bool {
+	return r.cwnd < r.ssthresh
+}
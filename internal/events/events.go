@@ -0,0 +1,113 @@
+// Package events define a dónde van los eventos y mensajes de log de la lógica de
+// transferencia. Server y Client reciben un Sink y un Logger, así la misma lógica
+// funciona con la interfaz gráfica (Wails), en pruebas (Channel) y sin interfaz
+// (Stdout o Func).
+package events
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Sink recibe los eventos, con el nombre y los datos que usa la interfaz gráfica.
+type Sink interface {
+	Emit(name string, data ...interface{})
+}
+
+// Logger recibe los mensajes de log. *log.Logger lo implementa.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Wails entrega los eventos a la interfaz y los mensajes al log de Wails.
+type Wails struct {
+	ctx context.Context
+}
+
+// NewWails usa el contexto que Wails pasa en OnStartup.
+func NewWails(ctx context.Context) *Wails {
+	return &Wails{ctx: ctx}
+}
+
+func (w *Wails) Emit(name string, data ...interface{}) {
+	runtime.EventsEmit(w.ctx, name, data...)
+}
+
+func (w *Wails) Printf(format string, args ...interface{}) {
+	runtime.LogPrintf(w.ctx, format, args...)
+}
+
+// Event es un evento recibido por Channel.
+type Event struct {
+	Name string
+	Data []interface{}
+}
+
+// Channel entrega los eventos por un canal, para que las pruebas puedan esperar
+// los que les interesan. Emit bloquea si el canal está lleno, así que quien lo
+// use tiene que leerlo o crearlo con espacio suficiente. Es solo un Sink: los
+// mensajes de log van al Logger que se elija aparte.
+type Channel struct {
+	Events chan Event
+}
+
+// NewChannel crea un Channel con un canal de capacidad size.
+func NewChannel(size int) *Channel {
+	return &Channel{Events: make(chan Event, size)}
+}
+
+func (c *Channel) Emit(name string, data ...interface{}) {
+	c.Events <- Event{Name: name, Data: data}
+}
+
+// Stdout escribe cada evento como una línea de texto, para usar sin interfaz.
+// Los mensajes de log solo se escriben si verbose es true.
+type Stdout struct {
+	mu      sync.Mutex
+	w       io.Writer
+	verbose bool
+}
+
+// NewStdout escribe en w (normalmente os.Stdout).
+func NewStdout(w io.Writer, verbose bool) *Stdout {
+	return &Stdout{w: w, verbose: verbose}
+}
+
+func (s *Stdout) Emit(name string, data ...interface{}) {
+	values := make([]string, len(data))
+	for i, d := range data {
+		values[i] = fmt.Sprint(d)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, "%s: %s\n", name, strings.Join(values, " "))
+}
+
+func (s *Stdout) Printf(format string, args ...interface{}) {
+	if !s.verbose {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, format+"\n", args...)
+}
+
+// Func permite usar una función como Sink.
+type Func func(name string, data ...interface{})
+
+func (f Func) Emit(name string, data ...interface{}) {
+	f(name, data...)
+}
+
+// Discard descarta los eventos y los mensajes de log.
+var Discard discard
+
+type discard struct{}
+
+func (discard) Emit(string, ...interface{})   {}
+func (discard) Printf(string, ...interface{}) {}
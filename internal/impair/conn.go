@@ -0,0 +1,231 @@
+package impair
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/NeichS/final-redes-wails/internal/events"
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+)
+
+// Protocol indica cómo reconocer y dañar los segmentos de datos de cada transporte.
+type Protocol int
+
+const (
+	TCP Protocol = iota
+	UDP
+)
+
+// isSegment indica si el mensaje b es un segmento de datos.
+func (p Protocol) isSegment(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	if p == UDP {
+		return b[0] == protocol.UDPTypeData
+	}
+	return b[0] == protocol.TypeSegment || b[0] == protocol.TypeCheckedSegment
+}
+
+// damage invierte un bit de los datos del segmento b, elegido con rng, sin tocar
+// el encabezado para que el receptor lo pueda leer y detectar el error con el CRC.
+func (p Protocol) damage(b []byte, rng *rand.Rand) []byte {
+	var segment interface {
+		protocol.Frame
+		data() []byte
+	}
+	if p == UDP {
+		segment = &udpData{}
+	} else {
+		segment = &tcpSegment{}
+	}
+	if err := segment.UnmarshalBinary(b); err != nil {
+		return b
+	}
+	flipBit(segment.data(), rng)
+	damaged, err := segment.MarshalBinary()
+	if err != nil {
+		return b
+	}
+	return damaged
+}
+
+// flipBit invierte un bit de data elegido con rng, para simular un error de
+// transmisión.
+func flipBit(data []byte, rng *rand.Rand) {
+	if len(data) == 0 {
+		return
+	}
+	bit := rng.IntN(len(data) * 8)
+	data[bit/8] ^= 1 << (bit % 8)
+}
+
+type tcpSegment struct{ protocol.Segment }
+
+func (s *tcpSegment) data() []byte { return s.Data }
+
+type udpData struct{ protocol.UDPData }
+
+func (d *udpData) data() []byte { return d.Data }
+
+// Tiempo máximo que Close espera que se entregue lo que está en tránsito.
+const closeTimeout = 5 * time.Second
+
+// Conn es una conexión con las imperfecciones aplicadas a lo que se escribe
+// (NewSender) o a lo que se lee (NewReceiver).
+type Conn struct {
+	net.Conn
+	link  *link
+	proto Protocol
+	// in es por donde llegan los frames, en las conexiones de NewReceiver
+	in *io.PipeReader
+}
+
+// NewSender aplica las imperfecciones de imp a los mensajes que se escriben en
+// conn. Cada Write tiene que ser un mensaje completo: un frame TCP o un datagrama.
+func NewSender(conn net.Conn, imp *Impairment, proto Protocol) *Conn {
+	deliver := func(p packet) error {
+		_, err := conn.Write(p.data)
+		return err
+	}
+	return &Conn{Conn: conn, link: newLink(imp, deliver, proto.damage), proto: proto}
+}
+
+// NewReceiver aplica las imperfecciones de imp a los frames TCP que se leen de conn.
+func NewReceiver(conn net.Conn, imp *Impairment) *Conn {
+	pr, pw := io.Pipe()
+	deliver := func(p packet) error {
+		if p.err != nil {
+			return pw.CloseWithError(p.err)
+		}
+		_, err := pw.Write(p.data)
+		return err
+	}
+	in := newLink(imp, deliver, TCP.damage)
+	go func() {
+		var raw bytes.Buffer
+		for {
+			raw.Reset()
+			// ReadFrame lee exactamente un frame, que queda copiado en raw
+			if _, err := protocol.ReadFrame(io.TeeReader(conn, &raw)); err != nil {
+				in.send(packet{err: err}, false)
+				in.drain()
+				return
+			}
+			frame := bytes.Clone(raw.Bytes())
+			if err := in.send(packet{data: frame}, TCP.isSegment(frame)); err != nil {
+				return
+			}
+		}
+	}()
+	return &Conn{Conn: conn, link: in, proto: TCP, in: pr}
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if c.in == nil {
+		return c.Conn.Read(b)
+	}
+	return c.in.Read(b)
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	if c.in != nil {
+		return c.Conn.Write(b)
+	}
+	// El mensaje puede quedar en tránsito después de que Write vuelve
+	if err := c.link.send(packet{data: bytes.Clone(b)}, c.proto.isSegment(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close cierra la conexión. Lo que se escribió y sigue en tránsito se entrega
+// antes, salvo que tarde más de closeTimeout.
+func (c *Conn) Close() error {
+	if c.in == nil {
+		if stopped := c.link.drain(); stopped != nil {
+			select {
+			case <-stopped:
+			case <-time.After(closeTimeout):
+			}
+		}
+	}
+	c.link.close()
+	if c.in != nil {
+		c.in.Close()
+	}
+	return c.Conn.Close()
+}
+
+// PacketConn es un socket UDP con las imperfecciones aplicadas a los datagramas
+// que se leen.
+type PacketConn struct {
+	net.PacketConn
+	in      *link
+	packets chan packet
+	closed  chan struct{}
+}
+
+// NewPacketReceiver aplica las imperfecciones de imp a los datagramas que se leen
+// de conn. Si el enlace falla, logger registra una sola vez que se descartan los
+// datagramas.
+func NewPacketReceiver(conn net.PacketConn, imp *Impairment, logger events.Logger) *PacketConn {
+	pc := &PacketConn{PacketConn: conn, packets: make(chan packet, 64), closed: make(chan struct{})}
+	pc.in = newLink(imp, func(p packet) error {
+		select {
+		case pc.packets <- p:
+			return nil
+		case <-pc.closed:
+			return net.ErrClosed
+		}
+	}, UDP.damage)
+	go func() {
+		buffer := make([]byte, protocol.MaxDatagramSize)
+		failed := false
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				pc.in.send(packet{err: err}, false)
+				if errors.Is(err, net.ErrClosed) {
+					pc.in.drain()
+					return
+				}
+				continue
+			}
+			datagram := bytes.Clone(buffer[:n])
+			if err := pc.in.send(packet{data: datagram, addr: addr}, UDP.isSegment(datagram)); err != nil && !failed && logger != nil {
+				// El error del enlace se repite con cada datagrama que sigue
+				logger.Printf("impair: link failed, dropping datagrams: %v", err)
+				failed = true
+			}
+		}
+	}()
+	return pc
+}
+
+func (pc *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	var p packet
+	select {
+	case p = <-pc.packets:
+	case <-pc.closed:
+		return 0, nil, net.ErrClosed
+	}
+	if p.err != nil {
+		return 0, nil, p.err
+	}
+	return copy(b, p.data), p.addr, nil
+}
+
+func (pc *PacketConn) Close() error {
+	select {
+	case <-pc.closed:
+	default:
+		close(pc.closed)
+	}
+	pc.in.close()
+	return pc.PacketConn.Close()
+}
@@ -0,0 +1,168 @@
+// Package impair simula un enlace imperfecto entre emisor y receptor: pérdidas
+// al azar y en ráfagas, demora fija y variable, duplicados, desorden, errores de
+// bits y un límite de ancho de banda. Se aplica envolviendo la conexión de
+// cualquiera de los dos extremos (ver NewSender, NewReceiver y NewPacketReceiver)
+// y se puede ajustar mientras hay transferencias en curso.
+//
+// Solo los segmentos de datos sufren pérdidas, duplicados, desorden y errores;
+// el resto de los mensajes (headers, ACKs, trailers) no tiene retransmisión en el
+// protocolo, así que comparten la demora y el ancho de banda del enlace pero
+// llegan siempre, en orden y sin dañar.
+//
+// Para que una demostración o una prueba se repita igual, un Scenario describe
+// una línea de tiempo de imperfecciones con una semilla fija (ver LoadScenario).
+package impair
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Config describe las imperfecciones del enlace. El valor cero es un enlace ideal.
+type Config struct {
+	// LossPercent es la probabilidad (0-100) de perder cada segmento.
+	LossPercent float64 `json:"lossPercent"`
+	// BurstPercent es la probabilidad (0-100) de que empiece una ráfaga de
+	// pérdidas, en la que se pierden BurstLength segmentos seguidos.
+	BurstPercent float64 `json:"burstPercent"`
+	BurstLength  int     `json:"burstLength"`
+	// DelayMs es la demora fija de cada mensaje y JitterMs cuánto puede variar,
+	// para más o para menos, la de cada segmento.
+	DelayMs  int `json:"delayMs"`
+	JitterMs int `json:"jitterMs"`
+	// DuplicatePercent es la probabilidad (0-100) de que un segmento llegue dos veces.
+	DuplicatePercent float64 `json:"duplicatePercent"`
+	// ReorderPercent es la probabilidad (0-100) de que un segmento se demore lo
+	// suficiente para llegar después de los que se enviaron a continuación.
+	ReorderPercent float64 `json:"reorderPercent"`
+	// CorruptPercent es la probabilidad (0-100) de que un segmento llegue con un
+	// bit invertido.
+	CorruptPercent float64 `json:"corruptPercent"`
+	// BandwidthKbps limita la velocidad del enlace en kbit/s; 0 es sin límite.
+	BandwidthKbps int `json:"bandwidthKbps"`
+}
+
+// Límites que acepta Validate.
+const (
+	maxDelayMs     = 10000
+	maxBurstLength = 1000
+)
+
+// Validate comprueba que los valores estén dentro de rangos razonables.
+func (c Config) Validate() error {
+	percents := []struct {
+		name  string
+		value float64
+	}{
+		{"pérdida", c.LossPercent},
+		{"ráfagas", c.BurstPercent},
+		{"duplicados", c.DuplicatePercent},
+		{"desorden", c.ReorderPercent},
+		{"errores de bits", c.CorruptPercent},
+	}
+	for _, p := range percents {
+		if p.value < 0 || p.value > 100 {
+			return fmt.Errorf("el porcentaje de %s debe estar entre 0 y 100", p.name)
+		}
+	}
+	if c.BurstPercent > 0 && (c.BurstLength < 1 || c.BurstLength > maxBurstLength) {
+		return fmt.Errorf("el largo de las ráfagas debe estar entre 1 y %d segmentos", maxBurstLength)
+	}
+	if c.DelayMs < 0 || c.DelayMs > maxDelayMs || c.JitterMs < 0 || c.JitterMs > maxDelayMs {
+		return fmt.Errorf("la demora y su variación deben estar entre 0 y %d ms", maxDelayMs)
+	}
+	if c.BandwidthKbps < 0 {
+		return fmt.Errorf("el ancho de banda no puede ser negativo")
+	}
+	return nil
+}
+
+// ideal indica si la configuración no altera el tráfico.
+func (c Config) ideal() bool {
+	return c == Config{}
+}
+
+// Impairment guarda la configuración vigente, compartida por todas las conexiones
+// de un extremo. El valor cero es un enlace ideal.
+type Impairment struct {
+	mu  sync.RWMutex
+	cfg Config
+	// down pierde todos los segmentos y corrupt los daña a todos; son los atajos
+	// de las teclas D y C de la interfaz
+	down    bool
+	corrupt bool
+	// scenario, si hay, se reproduce en cada conexión
+	scenario *Scenario
+}
+
+// Set reemplaza la configuración; se aplica a los segmentos que se envíen desde ahora.
+func (i *Impairment) Set(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	i.cfg = cfg
+	i.mu.Unlock()
+	return nil
+}
+
+// Config devuelve la configuración vigente.
+func (i *Impairment) Config() Config {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.cfg
+}
+
+// SetDown simula una caída del enlace: mientras está activa se pierden todos los segmentos.
+func (i *Impairment) SetDown(down bool) {
+	i.mu.Lock()
+	i.down = down
+	i.mu.Unlock()
+}
+
+func (i *Impairment) Down() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.down
+}
+
+// SetCorrupting hace que todos los segmentos lleguen con un bit invertido.
+func (i *Impairment) SetCorrupting(corrupt bool) {
+	i.mu.Lock()
+	i.corrupt = corrupt
+	i.mu.Unlock()
+}
+
+func (i *Impairment) Corrupting() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.corrupt
+}
+
+// SetScenario reproduce sc en las conexiones; nil vuelve a la configuración sola.
+// Las conexiones abiertas empiezan el escenario de nuevo con su próximo mensaje.
+func (i *Impairment) SetScenario(sc *Scenario) {
+	i.mu.Lock()
+	i.scenario = sc
+	i.mu.Unlock()
+}
+
+// Scenario devuelve el escenario vigente, o nil.
+func (i *Impairment) Scenario() *Scenario {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.scenario
+}
+
+// linkState es todo lo que hace falta para decidir el destino de un mensaje.
+type linkState struct {
+	cfg           Config
+	down, corrupt bool
+	scenario      *Scenario
+}
+
+func (i *Impairment) state() linkState {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return linkState{i.cfg, i.down, i.corrupt, i.scenario}
+}
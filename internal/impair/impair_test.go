@@ -0,0 +1,339 @@
+package impair
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+)
+
+func TestConfigValidate(t *testing.T) {
+	valid := []Config{
+		{},
+		{LossPercent: 100, CorruptPercent: 0.5, DelayMs: 200, JitterMs: 50},
+		{BurstPercent: 1, BurstLength: 10, BandwidthKbps: 512},
+	}
+	for _, cfg := range valid {
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validate(%+v) = %v, se esperaba nil", cfg, err)
+		}
+	}
+	invalid := []Config{
+		{LossPercent: -1},
+		{DuplicatePercent: 101},
+		{BurstPercent: 5},
+		{DelayMs: -5},
+		{JitterMs: maxDelayMs + 1},
+		{BandwidthKbps: -1},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, se esperaba un error", cfg)
+		}
+	}
+}
+
+// collector junta lo que entrega un link.
+type collector struct {
+	mu      sync.Mutex
+	packets [][]byte
+}
+
+func (c *collector) deliver(p packet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.packets = append(c.packets, p.data)
+	return nil
+}
+
+func (c *collector) got() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte(nil), c.packets...)
+}
+
+func newTestLink(t *testing.T, cfg Config) (*link, *collector) {
+	t.Helper()
+	imp := &Impairment{}
+	if err := imp.Set(cfg); err != nil {
+		t.Fatal(err)
+	}
+	c := &collector{}
+	l := newLink(imp, c.deliver, UDP.damage)
+	t.Cleanup(l.close)
+	return l, c
+}
+
+// flush espera que se entregue todo lo que está en tránsito.
+func flush(t *testing.T, l *link) {
+	t.Helper()
+	if stopped := l.drain(); stopped != nil {
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("el enlace no terminó de entregar")
+		}
+	}
+}
+
+func segment(seq uint32) []byte {
+	b, _ := (&protocol.UDPData{Seq: seq, CRC: protocol.SegmentCRC(seq, []byte("datos")), Data: []byte("datos")}).MarshalBinary()
+	return b
+}
+
+func TestLinkIdealDeliversInline(t *testing.T) {
+	l, c := newTestLink(t, Config{})
+	for seq := uint32(1); seq <= 3; seq++ {
+		if err := l.send(packet{data: segment(seq)}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Sin imperfecciones no hay goroutine de entrega: todo llegó ya
+	if got := len(c.got()); got != 3 {
+		t.Fatalf("se entregaron %d mensajes, se esperaban 3", got)
+	}
+}
+
+func TestLinkLossKeepsControlMessages(t *testing.T) {
+	l, c := newTestLink(t, Config{LossPercent: 100})
+	control := []byte{protocol.UDPTypeEnd, 0, 0, 0, 1}
+	l.send(packet{data: segment(1)}, true)
+	l.send(packet{data: control}, false)
+	l.send(packet{data: segment(2)}, true)
+	flush(t, l)
+
+	got := c.got()
+	if len(got) != 1 || string(got[0]) != string(control) {
+		t.Fatalf("se entregó %v, se esperaba solo el mensaje de control", got)
+	}
+}
+
+func TestLinkBurstLoss(t *testing.T) {
+	l, c := newTestLink(t, Config{BurstPercent: 100, BurstLength: 3})
+	for seq := uint32(1); seq <= 6; seq++ {
+		l.send(packet{data: segment(seq)}, true)
+	}
+	flush(t, l)
+	if got := len(c.got()); got != 0 {
+		t.Fatalf("se entregaron %d segmentos durante las ráfagas, se esperaban 0", got)
+	}
+}
+
+func TestLinkDuplicateAndCorrupt(t *testing.T) {
+	l, c := newTestLink(t, Config{DuplicatePercent: 100, CorruptPercent: 100})
+	l.send(packet{data: segment(7)}, true)
+	flush(t, l)
+
+	got := c.got()
+	if len(got) != 2 {
+		t.Fatalf("se entregaron %d copias, se esperaban 2", len(got))
+	}
+	for _, b := range got {
+		var data protocol.UDPData
+		if err := data.UnmarshalBinary(b); err != nil {
+			t.Fatalf("el segmento dañado no se puede leer: %v", err)
+		}
+		if data.Seq != 7 || data.Valid() {
+			t.Errorf("segmento %d con CRC válido = %v, se esperaba el 7 con el CRC inválido", data.Seq, data.Valid())
+		}
+	}
+}
+
+func TestLinkControlMessagesKeepOrder(t *testing.T) {
+	l, c := newTestLink(t, Config{DelayMs: 2, JitterMs: 5, ReorderPercent: 50})
+	// Antes y después de cada mensaje de control van segmentos que se pueden
+	// desordenar entre sí, pero nunca pasar ni ser pasados por el control
+	var want []int
+	for round := 0; round < 5; round++ {
+		for seq := 0; seq < 5; seq++ {
+			l.send(packet{data: segment(uint32(round*10 + seq))}, true)
+		}
+		l.send(packet{data: []byte{protocol.UDPTypeEnd, byte(round)}}, false)
+		want = append(want, round)
+	}
+	flush(t, l)
+
+	round := 0
+	for _, b := range c.got() {
+		if b[0] == protocol.UDPTypeEnd {
+			if int(b[1]) != want[round] {
+				t.Fatalf("llegó el control %d, se esperaba el %d", b[1], want[round])
+			}
+			round++
+			continue
+		}
+		var data protocol.UDPData
+		data.UnmarshalBinary(b)
+		if int(data.Seq)/10 != round {
+			t.Fatalf("el segmento %d llegó después del control %d", data.Seq, round-1)
+		}
+	}
+	if round != len(want) {
+		t.Fatalf("llegaron %d mensajes de control, se esperaban %d", round, len(want))
+	}
+}
+
+func TestLinkBandwidth(t *testing.T) {
+	// 10 mensajes de 1000 bytes a 800 kbit/s son 100 ms
+	l, c := newTestLink(t, Config{BandwidthKbps: 800})
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		l.send(packet{data: make([]byte, 1000)}, false)
+	}
+	flush(t, l)
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("la entrega tardó %v, se esperaban al menos 100ms", elapsed)
+	}
+	if got := len(c.got()); got != 10 {
+		t.Errorf("se entregaron %d mensajes, se esperaban 10", got)
+	}
+}
+
+func newScenarioLink(t *testing.T, sc *Scenario) (*link, *collector) {
+	t.Helper()
+	l, c := newTestLink(t, Config{})
+	l.imp.SetScenario(sc)
+	return l, c
+}
+
+// seqs devuelve los números de secuencia de los segmentos entregados.
+func seqs(packets [][]byte) []uint32 {
+	var got []uint32
+	for _, b := range packets {
+		var data protocol.UDPData
+		if data.UnmarshalBinary(b) == nil {
+			got = append(got, data.Seq)
+		}
+	}
+	return got
+}
+
+func TestScenarioDropAndEvery(t *testing.T) {
+	l, c := newScenarioLink(t, &Scenario{Steps: []Step{
+		{FromSegment: 3, ToSegment: 5, Drop: true},
+		{Every: 4, Corrupt: true},
+	}})
+	for seq := uint32(1); seq <= 8; seq++ {
+		l.send(packet{data: segment(seq)}, true)
+	}
+	flush(t, l)
+
+	want := []uint32{1, 2, 6, 7, 8}
+	if got := seqs(c.got()); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("se entregaron los segmentos %v, se esperaban %v", got, want)
+	}
+	for _, b := range c.got() {
+		var data protocol.UDPData
+		data.UnmarshalBinary(b)
+		if corrupt := data.Seq == 8; data.Valid() == corrupt {
+			t.Errorf("segmento %d con CRC válido = %v", data.Seq, data.Valid())
+		}
+	}
+}
+
+func TestScenarioTimeline(t *testing.T) {
+	l, c := newScenarioLink(t, &Scenario{Steps: []Step{
+		{FromMs: 50, Config: &Config{LossPercent: 100}},
+	}})
+	l.send(packet{data: segment(1)}, true)
+	time.Sleep(60 * time.Millisecond)
+	l.send(packet{data: segment(2)}, true)
+	flush(t, l)
+
+	if got := seqs(c.got()); fmt.Sprint(got) != "[1]" {
+		t.Fatalf("se entregaron los segmentos %v, se esperaba solo el 1", got)
+	}
+}
+
+// Con la misma semilla las pérdidas al azar tienen que ser las mismas.
+func TestScenarioSeedIsDeterministic(t *testing.T) {
+	run := func(seed uint64) []uint32 {
+		l, c := newScenarioLink(t, &Scenario{Seed: seed, Steps: []Step{
+			{Config: &Config{LossPercent: 30, DuplicatePercent: 10}},
+		}})
+		for seq := uint32(1); seq <= 200; seq++ {
+			l.send(packet{data: segment(seq)}, true)
+		}
+		flush(t, l)
+		return seqs(c.got())
+	}
+	first := fmt.Sprint(run(7))
+	if again := fmt.Sprint(run(7)); again != first {
+		t.Fatalf("la misma semilla entregó\n%s\ny después\n%s", first, again)
+	}
+	if other := fmt.Sprint(run(8)); other == first {
+		t.Errorf("semillas distintas entregaron los mismos segmentos")
+	}
+}
+
+// Con la misma semilla los segmentos dañados tienen que llegar iguales byte a
+// byte: el bit que se invierte también sale del generador del enlace.
+func TestScenarioSeedDamagesSameBits(t *testing.T) {
+	run := func(seed uint64) [][]byte {
+		l, c := newScenarioLink(t, &Scenario{Seed: seed, Steps: []Step{
+			{Config: &Config{CorruptPercent: 50}},
+		}})
+		for seq := uint32(1); seq <= 100; seq++ {
+			l.send(packet{data: segment(seq)}, true)
+		}
+		flush(t, l)
+		return c.got()
+	}
+	first := run(7)
+	again := run(7)
+	if len(again) != len(first) {
+		t.Fatalf("la misma semilla entregó %d y después %d segmentos", len(first), len(again))
+	}
+	for i := range first {
+		if !bytes.Equal(first[i], again[i]) {
+			t.Fatalf("segmento %d: la misma semilla entregó\n%x\ny después\n%x", i, first[i], again[i])
+		}
+	}
+	if other := run(8); fmt.Sprint(other) == fmt.Sprint(first) {
+		t.Errorf("semillas distintas dañaron los mismos bits")
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	sc, err := LoadScenario(write("ok.json", `{
+		"name": "clase 3",
+		"seed": 42,
+		"steps": [
+			{"fromSegment": 100, "toSegment": 150, "drop": true},
+			{"fromMs": 3000, "config": {"delayMs": 500}},
+			{"every": 50, "corrupt": true}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Seed != 42 || len(sc.Steps) != 3 || sc.Steps[1].Config.DelayMs != 500 {
+		t.Errorf("se leyó %+v", sc)
+	}
+
+	invalid := map[string]string{
+		"campo.json":  `{"steps": [{"dorp": true}]}`,
+		"accion.json": `{"steps": [{"fromMs": 10}]}`,
+		"rango.json":  `{"steps": [{"fromSegment": 10, "toSegment": 5, "drop": true}]}`,
+		"config.json": `{"steps": [{"config": {"lossPercent": 200}}]}`,
+	}
+	for name, content := range invalid {
+		if _, err := LoadScenario(write(name, content)); err == nil {
+			t.Errorf("%s: LoadScenario no devolvió un error", name)
+		}
+	}
+}
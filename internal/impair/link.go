@@ -0,0 +1,289 @@
+package impair
+
+import (
+	"bytes"
+	"container/heap"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// Demora extra mínima de un segmento desordenado, para que lo alcancen los
+// siguientes aunque el enlace no tenga demora configurada.
+const minReorderDelay = 20 * time.Millisecond
+
+// packet es un mensaje en tránsito por el enlace simulado.
+type packet struct {
+	data []byte
+	// addr es el origen del datagrama, en el receptor UDP
+	addr net.Addr
+	// err cierra el enlace al entregarse, después de los mensajes anteriores
+	err error
+	at  time.Time
+	seq uint64
+}
+
+// link entrega a deliver los mensajes que recibe send, con las imperfecciones de
+// imp. Mientras el enlace es ideal y no hay nada en tránsito, send entrega en el
+// momento; si no, una goroutine entrega cada mensaje cuando corresponde, de a uno
+// y en orden de llegada.
+type link struct {
+	imp     *Impairment
+	deliver func(packet) error
+	// damage devuelve el segmento con un bit invertido, elegido con el rng del enlace
+	damage func([]byte, *rand.Rand) []byte
+
+	mu sync.Mutex
+	// queue tiene los mensajes en tránsito ordenados por hora de entrega
+	queue      packetQueue
+	seq        uint64
+	delivering bool
+	running    bool
+	// last es la hora de entrega más tardía programada; los mensajes que no se
+	// alteran nunca se entregan antes, así no pasan a los anteriores
+	last time.Time
+	// barrier es la hora de entrega del último mensaje que no se altera; ningún
+	// segmento posterior lo puede pasar
+	barrier time.Time
+	// free es cuándo termina de transmitirse lo ya enviado, con ancho de banda limitado
+	free time.Time
+	// burst es la cantidad de segmentos que todavía se pierden en la ráfaga actual
+	burst int
+	// rng decide las imperfecciones al azar; con un escenario usa su semilla
+	rng *rand.Rand
+	// scenario es el escenario que recorre el enlace, que empezó en start y va
+	// por el segmento count
+	scenario *Scenario
+	start    time.Time
+	count    int
+	err      error
+	// draining termina la goroutine de entrega cuando se vacía la cola
+	draining bool
+	// stopped se cierra cuando termina la goroutine de entrega
+	stopped chan struct{}
+	wake    chan struct{}
+	closed  chan struct{}
+}
+
+func newLink(imp *Impairment, deliver func(packet) error, damage func([]byte, *rand.Rand) []byte) *link {
+	return &link{
+		imp:     imp,
+		deliver: deliver,
+		damage:  damage,
+		wake:    make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+}
+
+// send hace pasar p por el enlace. segment indica si es un segmento de datos,
+// que puede perderse, duplicarse, desordenarse o dañarse. Devuelve el error de
+// una entrega anterior, si la hubo.
+func (l *link) send(p packet, segment bool) error {
+	st := l.imp.state()
+
+	l.mu.Lock()
+	if l.err != nil {
+		err := l.err
+		l.mu.Unlock()
+		return err
+	}
+	if st.scenario == nil && st.cfg.ideal() && !st.down && !st.corrupt && len(l.queue) == 0 && !l.delivering {
+		l.mu.Unlock()
+		return l.deliver(p)
+	}
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.rng == nil || st.scenario != l.scenario {
+		// Con un escenario nuevo el enlace lo empieza desde el principio
+		l.scenario = st.scenario
+		l.rng = newRand(st.scenario)
+		l.start = now
+		l.count = 0
+	}
+	if segment {
+		l.count++
+	}
+	f := fate{cfg: st.cfg}
+	if l.scenario != nil {
+		f = l.scenario.at(st.cfg, now.Sub(l.start), l.count, segment)
+	}
+	cfg := f.cfg
+
+	// El ancho de banda lo ocupan también los segmentos que después se pierden
+	sent := now
+	if cfg.BandwidthKbps > 0 {
+		sent = maxTime(now, l.free).Add(time.Duration(len(p.data)) * 8 * time.Millisecond / time.Duration(cfg.BandwidthKbps))
+		l.free = sent
+	}
+	p.at = sent.Add(time.Duration(cfg.DelayMs) * time.Millisecond)
+
+	if segment {
+		if f.drop || l.lost(cfg, st.down) {
+			return nil
+		}
+		if f.corrupt || st.corrupt || l.chance(cfg.CorruptPercent) {
+			p.data = l.damage(bytes.Clone(p.data), l.rng)
+		}
+		if cfg.JitterMs > 0 {
+			jitter := time.Duration(l.rng.IntN(2*cfg.JitterMs+1)-cfg.JitterMs) * time.Millisecond
+			p.at = maxTime(p.at.Add(jitter), sent)
+		}
+		p.at = maxTime(p.at, l.barrier)
+		if l.chance(cfg.ReorderPercent) {
+			p.at = p.at.Add(max(time.Duration(cfg.DelayMs+cfg.JitterMs)*time.Millisecond, minReorderDelay))
+		}
+		l.push(p)
+		if f.duplicate || l.chance(cfg.DuplicatePercent) {
+			l.push(p)
+		}
+		return nil
+	}
+
+	p.at = maxTime(p.at, l.last)
+	l.barrier = p.at
+	l.push(p)
+	return nil
+}
+
+// lost decide si se pierde el próximo segmento.
+func (l *link) lost(cfg Config, down bool) bool {
+	if down {
+		return true
+	}
+	if l.burst > 0 {
+		l.burst--
+		return true
+	}
+	if l.chance(cfg.BurstPercent) {
+		l.burst = cfg.BurstLength - 1
+		return true
+	}
+	return l.chance(cfg.LossPercent)
+}
+
+// push pone p en tránsito; se llama con mu tomado.
+func (l *link) push(p packet) {
+	l.seq++
+	p.seq = l.seq
+	heap.Push(&l.queue, p)
+	l.last = maxTime(l.last, p.at)
+	if !l.running {
+		l.running = true
+		l.stopped = make(chan struct{})
+		go l.run(l.stopped)
+	}
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run entrega los mensajes en tránsito a medida que les llega la hora.
+func (l *link) run(stopped chan struct{}) {
+	defer close(stopped)
+	for {
+		l.mu.Lock()
+		var wait time.Duration = time.Hour
+		if len(l.queue) > 0 {
+			wait = time.Until(l.queue[0].at)
+		}
+		if len(l.queue) == 0 && l.draining {
+			l.running = false
+			l.mu.Unlock()
+			return
+		}
+		if len(l.queue) > 0 && wait <= 0 {
+			p := heap.Pop(&l.queue).(packet)
+			l.delivering = true
+			l.mu.Unlock()
+
+			err := l.deliver(p)
+
+			l.mu.Lock()
+			l.delivering = false
+			if err != nil && l.err == nil {
+				l.err = err
+			}
+			l.mu.Unlock()
+			continue
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-l.wake:
+		case <-l.closed:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// drain termina el enlace después de entregar lo que está en tránsito. Devuelve
+// un canal que se cierra cuando termina la entrega, o nil si no había nada.
+func (l *link) drain() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.draining = true
+	if l.err == nil {
+		l.err = net.ErrClosed
+	}
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	if !l.running {
+		return nil
+	}
+	return l.stopped
+}
+
+// close descarta lo que está en tránsito.
+func (l *link) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.closed:
+	default:
+		close(l.closed)
+		l.queue = nil
+		if l.err == nil {
+			l.err = net.ErrClosed
+		}
+	}
+}
+
+// chance devuelve true con probabilidad percent/100; se llama con mu tomado.
+func (l *link) chance(percent float64) bool {
+	return percent > 0 && l.rng.Float64()*100 < percent
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// packetQueue ordena los mensajes por hora de entrega y, a igual hora, por orden de envío.
+type packetQueue []packet
+
+func (q packetQueue) Len() int { return len(q) }
+func (q packetQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+func (q packetQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *packetQueue) Push(x any)   { *q = append(*q, x.(packet)) }
+func (q *packetQueue) Pop() any {
+	old := *q
+	p := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return p
+}
@@ -0,0 +1,140 @@
+package impair
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+)
+
+// Scenario es una línea de tiempo de imperfecciones que se reproduce igual en
+// cada ejecución: las acciones sobre segmentos puntuales son fijas y las
+// probabilidades usan un generador inicializado con Seed.
+//
+// Cada conexión que pasa por el simulador recorre el escenario desde el
+// principio: el tiempo se cuenta desde su primer mensaje y los segmentos de
+// datos se numeran desde 1 en el orden en que se envían, retransmisiones
+// incluidas. El socket UDP del receptor es uno solo para todos los envíos, así
+// que su línea de tiempo empieza con el primer mensaje después de cargar el
+// escenario.
+type Scenario struct {
+	Name  string `json:"name,omitempty"`
+	Seed  uint64 `json:"seed"`
+	Steps []Step `json:"steps"`
+}
+
+// Step es un tramo del escenario. Está activo mientras se cumplen todos los
+// límites que tiene; un límite en cero no restringe nada.
+type Step struct {
+	// FromMs y ToMs limitan el paso a los milisegundos [FromMs, ToMs) desde el
+	// primer mensaje de la conexión.
+	FromMs int `json:"fromMs,omitempty"`
+	ToMs   int `json:"toMs,omitempty"`
+	// FromSegment y ToSegment limitan el paso a los segmentos [FromSegment, ToSegment].
+	FromSegment int `json:"fromSegment,omitempty"`
+	ToSegment   int `json:"toSegment,omitempty"`
+	// Every aplica Drop, Corrupt y Duplicate solo a los segmentos cuyo número es
+	// múltiplo de Every.
+	Every int `json:"every,omitempty"`
+
+	Drop      bool `json:"drop,omitempty"`
+	Corrupt   bool `json:"corrupt,omitempty"`
+	Duplicate bool `json:"duplicate,omitempty"`
+	// Config reemplaza la configuración del simulador mientras el paso está
+	// activo; si hay varios, vale el último de la lista.
+	Config *Config `json:"config,omitempty"`
+}
+
+// LoadScenario lee y valida un escenario en JSON.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Un campo mal escrito cambiaría el escenario sin avisar
+	dec.DisallowUnknownFields()
+	var sc Scenario
+	if err := dec.Decode(&sc); err != nil {
+		return nil, fmt.Errorf("escenario %s: %w", path, err)
+	}
+	if err := sc.Validate(); err != nil {
+		return nil, fmt.Errorf("escenario %s: %w", path, err)
+	}
+	return &sc, nil
+}
+
+// Validate comprueba que cada paso tenga límites coherentes y haga algo.
+func (sc *Scenario) Validate() error {
+	for i, st := range sc.Steps {
+		n := i + 1
+		if st.FromMs < 0 || st.ToMs < 0 || st.FromSegment < 0 || st.ToSegment < 0 || st.Every < 0 {
+			return fmt.Errorf("paso %d: los límites no pueden ser negativos", n)
+		}
+		if st.ToMs > 0 && st.ToMs <= st.FromMs {
+			return fmt.Errorf("paso %d: toMs debe ser mayor que fromMs", n)
+		}
+		if st.ToSegment > 0 && st.ToSegment < st.FromSegment {
+			return fmt.Errorf("paso %d: toSegment no puede ser menor que fromSegment", n)
+		}
+		if !st.Drop && !st.Corrupt && !st.Duplicate && st.Config == nil {
+			return fmt.Errorf("paso %d: no tiene ninguna acción (drop, corrupt, duplicate o config)", n)
+		}
+		if st.Config != nil {
+			if err := st.Config.Validate(); err != nil {
+				return fmt.Errorf("paso %d: %w", n, err)
+			}
+		}
+	}
+	return nil
+}
+
+// active indica si el paso se aplica en el instante elapsed y al segmento n.
+func (st *Step) active(elapsed time.Duration, n int) bool {
+	ms := int(elapsed / time.Millisecond)
+	if ms < st.FromMs || (st.ToMs > 0 && ms >= st.ToMs) {
+		return false
+	}
+	if n < st.FromSegment || (st.ToSegment > 0 && n > st.ToSegment) {
+		return false
+	}
+	return true
+}
+
+// fate es lo que el escenario decide para un mensaje.
+type fate struct {
+	cfg                      Config
+	drop, corrupt, duplicate bool
+}
+
+// at devuelve la configuración vigente y las acciones para el mensaje que sale
+// en elapsed. n es el número del segmento, o el del último segmento si el
+// mensaje no es un segmento.
+func (sc *Scenario) at(cfg Config, elapsed time.Duration, n int, segment bool) fate {
+	f := fate{cfg: cfg}
+	for i := range sc.Steps {
+		st := &sc.Steps[i]
+		if !st.active(elapsed, n) {
+			continue
+		}
+		if st.Config != nil {
+			f.cfg = *st.Config
+		}
+		if segment && (st.Every <= 1 || n%st.Every == 0) {
+			f.drop = f.drop || st.Drop
+			f.corrupt = f.corrupt || st.Corrupt
+			f.duplicate = f.duplicate || st.Duplicate
+		}
+	}
+	return f
+}
+
+// newRand devuelve el generador de un enlace: fijo si hay escenario y al azar si no.
+func newRand(sc *Scenario) *rand.Rand {
+	if sc != nil {
+		return rand.New(rand.NewPCG(sc.Seed, sc.Seed))
+	}
+	return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
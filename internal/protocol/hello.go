@@ -0,0 +1,158 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// Versiones del protocolo. La versión 1 corresponde a los pares que no hacen
+// handshake y mandan el header directamente.
+const (
+	VersionLegacy  byte = 1
+	CurrentVersion byte = 2
+)
+
+// Funcionalidades opcionales que cada extremo anuncia en el HELLO. Solo se usan
+// las que ambos soportan.
+const (
+	FeatureWindow uint32 = 1 << iota
+	FeatureCompression
+	FeatureHashAlgorithms
+	FeatureResume
+	// FeatureOffer indica que el cliente anuncia la lista de archivos antes de
+	// enviarlos, para que el receptor la acepte o la rechace de una vez.
+	FeatureOffer
+	// FeatureFileSize indica que los headers informan el tamaño del archivo.
+	FeatureFileSize
+	// FeatureTrailer indica que el checksum no viaja en el header sino en un
+	// Trailer después del último segmento, calculado mientras se envía.
+	FeatureTrailer
+	// FeatureSegmentCRC indica que cada segmento lleva un CRC32 y que el receptor
+	// pide de inmediato los que llegan dañados.
+	FeatureSegmentCRC
+	// FeatureVerify indica que el receptor informa con un Verify si cada archivo
+	// pasó la verificación final, para que el emisor pueda reintentarlo.
+	FeatureVerify
+	// FeatureFileAttributes indica que los headers informan la fecha de
+	// modificación y los permisos del archivo, que el receptor conserva.
+	FeatureFileAttributes
+)
+
+// SupportedFeatures son las funcionalidades que implementa esta versión.
+const SupportedFeatures = FeatureWindow | FeatureHashAlgorithms | FeatureResume | FeatureOffer | FeatureFileSize | FeatureTrailer | FeatureSegmentCRC | FeatureVerify | FeatureFileAttributes
+
+const (
+	helloFixedLen = 1 + 4 + 2 + 1 // versión, funcionalidades, ventana máxima, largo del nombre
+	// MaxPeerNameLen es el largo máximo del nombre de un par.
+	MaxPeerNameLen = 255
+)
+
+// Hello abre la conexión TCP anunciando las capacidades del cliente; el servidor
+// responde con el mismo formato y tipo TypeHelloAck:
+// [1 tipo][2 largo del payload][1 versión][4 funcionalidades][2 ventana máxima][1 nameLen][nombre]
+type Hello struct {
+	Type      byte
+	Version   byte
+	Features  uint32
+	MaxWindow uint16
+	PeerName  string
+}
+
+func (h *Hello) MarshalBinary() ([]byte, error) {
+	if h.Type != TypeHello && h.Type != TypeHelloAck {
+		return nil, fmt.Errorf("tipo de hello desconocido: %d", h.Type)
+	}
+	if len(h.PeerName) > MaxPeerNameLen {
+		return nil, fmt.Errorf("nombre de par demasiado largo: %d", len(h.PeerName))
+	}
+	b := make([]byte, 0, ackPrefixLen+helloFixedLen+len(h.PeerName))
+	b = append(b, h.Type)
+	b = binary.BigEndian.AppendUint16(b, uint16(helloFixedLen+len(h.PeerName)))
+	b = append(b, h.Version)
+	b = binary.BigEndian.AppendUint32(b, h.Features)
+	b = binary.BigEndian.AppendUint16(b, h.MaxWindow)
+	b = append(b, byte(len(h.PeerName)))
+	return append(b, h.PeerName...), nil
+}
+
+func (h *Hello) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, TypeHello, TypeHelloAck); err != nil {
+		return err
+	}
+	if len(b) < ackPrefixLen {
+		return ErrShortFrame
+	}
+	length := int(binary.BigEndian.Uint16(b[1:3]))
+	if len(b) < ackPrefixLen+length {
+		return ErrShortFrame
+	}
+	if len(b) > ackPrefixLen+length {
+		return ErrTrailingData
+	}
+	payload := b[ackPrefixLen:]
+	if len(payload) < helloFixedLen {
+		return ErrShortFrame
+	}
+	nameLen := int(payload[7])
+	if len(payload) < helloFixedLen+nameLen {
+		return ErrShortFrame
+	}
+	if payload[0] == 0 {
+		return fmt.Errorf("versión de protocolo inválida: 0")
+	}
+	// Los bytes después del nombre quedan reservados para versiones futuras
+	*h = Hello{
+		Type:      b[0],
+		Version:   payload[0],
+		Features:  binary.BigEndian.Uint32(payload[1:5]),
+		MaxWindow: binary.BigEndian.Uint16(payload[5:7]),
+		PeerName:  string(payload[helloFixedLen : helloFixedLen+nameLen]),
+	}
+	return nil
+}
+
+// Session es el resultado de la negociación entre dos pares.
+type Session struct {
+	Version   byte
+	Features  uint32
+	MaxWindow uint16
+	PeerName  string
+}
+
+// Negotiate combina el HELLO propio con el del par: se usa la menor versión,
+// la intersección de funcionalidades y la menor ventana.
+func Negotiate(local, remote *Hello) Session {
+	session := Session{
+		Version:   min(local.Version, remote.Version),
+		Features:  local.Features & remote.Features,
+		MaxWindow: min(local.MaxWindow, remote.MaxWindow),
+		PeerName:  remote.PeerName,
+	}
+	if session.MaxWindow == 0 {
+		session.MaxWindow = 1
+	}
+	return session
+}
+
+// LegacySession describe a un par que no hizo handshake: sin funcionalidades opcionales.
+func LegacySession() Session {
+	return Session{Version: VersionLegacy, MaxWindow: 1}
+}
+
+// Has indica si la funcionalidad quedó habilitada para ambos extremos.
+func (s Session) Has(feature uint32) bool {
+	return s.Features&feature != 0
+}
+
+// LocalPeerName devuelve el nombre con el que este equipo se presenta en el HELLO.
+func LocalPeerName() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "desconocido"
+	}
+	if len(name) > MaxPeerNameLen {
+		name = name[:MaxPeerNameLen]
+	}
+	return name
+}
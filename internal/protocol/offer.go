@@ -0,0 +1,134 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	offerFixedLen      = 1 + 4 // tipo, cantidad de archivos
+	offerEntryFixedLen = 8 + 2 // tamaño, nameLen
+	// MaxOfferFiles es la cantidad máxima de archivos que se aceptan en una oferta.
+	MaxOfferFiles = 10000
+)
+
+// OfferedFile es un archivo anunciado en una oferta.
+type OfferedFile struct {
+	Name string
+	Size uint64
+}
+
+// Offer anuncia los archivos que el cliente va a enviar, antes del primer header.
+// El servidor responde con un Ack de tipo TypeAckOffer o con un Reject:
+// [1 tipo][4 cantidad]{[8 tamaño][2 nameLen][nombre]}...
+type Offer struct {
+	Files []OfferedFile
+}
+
+func (o *Offer) MarshalBinary() ([]byte, error) {
+	if len(o.Files) == 0 || len(o.Files) > MaxOfferFiles {
+		return nil, fmt.Errorf("cantidad de archivos inválida: %d", len(o.Files))
+	}
+	size := offerFixedLen
+	for _, f := range o.Files {
+		if len(f.Name) == 0 || len(f.Name) > MaxNameLen {
+			return nil, fmt.Errorf("largo de nombre inválido: %d", len(f.Name))
+		}
+		size += offerEntryFixedLen + len(f.Name)
+	}
+	b := make([]byte, 0, size)
+	b = append(b, TypeOffer)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(o.Files)))
+	for _, f := range o.Files {
+		b = binary.BigEndian.AppendUint64(b, f.Size)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(f.Name)))
+		b = append(b, f.Name...)
+	}
+	return b, nil
+}
+
+func (o *Offer) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, TypeOffer); err != nil {
+		return err
+	}
+	if len(b) < offerFixedLen {
+		return ErrShortFrame
+	}
+	count, err := offerCount(b[1:offerFixedLen])
+	if err != nil {
+		return err
+	}
+	files := make([]OfferedFile, 0, count)
+	rest := b[offerFixedLen:]
+	for i := uint32(0); i < count; i++ {
+		if len(rest) < offerEntryFixedLen {
+			return ErrShortFrame
+		}
+		nameLen, err := offerNameLen(rest[8:offerEntryFixedLen])
+		if err != nil {
+			return err
+		}
+		end := offerEntryFixedLen + int(nameLen)
+		if len(rest) < end {
+			return ErrShortFrame
+		}
+		files = append(files, OfferedFile{
+			Name: string(rest[offerEntryFixedLen:end]),
+			Size: binary.BigEndian.Uint64(rest[:8]),
+		})
+		rest = rest[end:]
+	}
+	if len(rest) > 0 {
+		return ErrTrailingData
+	}
+	o.Files = files
+	return nil
+}
+
+// offerCount valida la cantidad de archivos declarada en la oferta.
+func offerCount(b []byte) (uint32, error) {
+	count := binary.BigEndian.Uint32(b)
+	if count == 0 || count > MaxOfferFiles {
+		return 0, fmt.Errorf("cantidad de archivos inválida: %d", count)
+	}
+	return count, nil
+}
+
+// offerNameLen valida el largo de nombre de una entrada de la oferta.
+func offerNameLen(b []byte) (uint16, error) {
+	nameLen := binary.BigEndian.Uint16(b)
+	if nameLen == 0 || nameLen > MaxNameLen {
+		return 0, fmt.Errorf("largo de nombre inválido: %d", nameLen)
+	}
+	return nameLen, nil
+}
+
+// readOffer lee una oferta entrada por entrada, validando cada largo antes de
+// reservar memoria.
+func readOffer(r io.Reader) ([]byte, error) {
+	b, err := readN(r, nil, offerFixedLen-1)
+	if err != nil {
+		return nil, err
+	}
+	count, err := offerCount(b)
+	if err != nil {
+		return nil, err
+	}
+	entry := make([]byte, offerEntryFixedLen+MaxNameLen)
+	for i := uint32(0); i < count; i++ {
+		if _, err := io.ReadFull(r, entry[:offerEntryFixedLen]); err != nil {
+			return nil, err
+		}
+		nameLen, err := offerNameLen(entry[8:offerEntryFixedLen])
+		if err != nil {
+			return nil, err
+		}
+		end := offerEntryFixedLen + int(nameLen)
+		if _, err := io.ReadFull(r, entry[offerEntryFixedLen:end]); err != nil {
+			return nil, err
+		}
+		b = append(b, entry[:end]...)
+	}
+	return b, nil
+}
@@ -0,0 +1,248 @@
+// Package protocol define las PDUs que intercambian cliente y servidor, tanto en
+// el stream TCP como en los datagramas UDP. Toda codificación y decodificación
+// pasa por acá para que ambos extremos no puedan desincronizarse.
+package protocol
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Tipos de frame del stream TCP.
+const (
+	TypeSegment        byte = 0x00
+	TypeHeader         byte = 0x01
+	TypeSizedHeader    byte = 0x02
+	TypeTrailer        byte = 0x03
+	TypeCheckedSegment byte = 0x04
+	TypeAttrHeader     byte = 0x05
+	TypeAckHeader      byte = 0x10
+	TypeAckSegment     byte = 0x11
+	TypeReject         byte = 0x12
+	TypeAckOffer       byte = 0x13
+	TypeVerify         byte = 0x14
+	TypeHello          byte = 0x20
+	TypeHelloAck       byte = 0x21
+	TypeOffer          byte = 0x30
+)
+
+// Tipos de paquete UDP.
+const (
+	UDPTypeStart byte = iota + 1
+	UDPTypeData
+	UDPTypeEnd
+	UDPTypeStartAck
+	UDPTypeNak
+	UDPTypeComplete
+	UDPTypeReject
+	UDPTypeAck
+)
+
+// Modos de ARQ que el emisor TCP anuncia en el header de cada archivo.
+const (
+	ARQStopAndWait byte = iota
+	ARQGoBackN
+	ARQSelectiveRepeat
+)
+
+// Modos de transferencia UDP que se anuncian en el paquete de inicio.
+const (
+	UDPBestEffort byte = iota
+	UDPReliable
+)
+
+// Motivos por los que el receptor rechaza un archivo.
+const (
+	RejectInvalidName byte = iota + 1
+	// RejectDeclined indica que el usuario del receptor no aceptó la transferencia
+	// (o no respondió a tiempo).
+	RejectDeclined
+	// RejectInvalidHeader indica que los datos del header no son coherentes entre sí.
+	RejectInvalidHeader
+	// RejectUnsupportedHash indica que el receptor no conoce el algoritmo de hash.
+	RejectUnsupportedHash
+	// RejectStorage indica que el receptor no pudo crear el archivo en su carpeta
+	// de descarga.
+	RejectStorage
+)
+
+// Resultados de la verificación final de un archivo que informa el receptor.
+const (
+	VerifyOK byte = iota
+	// VerifySizeMismatch indica que el archivo recibido no tiene el tamaño declarado.
+	VerifySizeMismatch
+	// VerifyChecksumMismatch indica que el checksum de los datos recibidos no
+	// coincide con el del emisor.
+	VerifyChecksumMismatch
+	// VerifyStoreFailed indica que el archivo llegó bien pero no se pudo guardar
+	// con su nombre definitivo.
+	VerifyStoreFailed
+)
+
+// Límites de tamaño que se validan al decodificar.
+const (
+	// SegmentSize es la cantidad de bytes útiles que viajan en cada segmento TCP.
+	SegmentSize = 1014
+	// UDPSegmentSize es la cantidad de bytes útiles de cada datagrama de datos.
+	UDPSegmentSize = 1024
+	// MaxWindowSize es el tamaño máximo de ventana que admite el header (uint16).
+	MaxWindowSize = 65535
+	// MaxNameLen es el largo máximo aceptado para un nombre de archivo.
+	MaxNameLen = 4096
+	// MaxChecksumLen es el largo máximo aceptado para un checksum.
+	MaxChecksumLen = 256
+	// MaxHashNameLen es el largo máximo del nombre de un algoritmo de hash.
+	MaxHashNameLen = 32
+	// MaxSegmentData es el máximo de datos que se acepta en un segmento TCP.
+	MaxSegmentData = 64 * 1024
+	// MaxDatagramSize es el tamaño del buffer de lectura UDP.
+	MaxDatagramSize = 2048
+	// MaxRejectMessageLen es el largo máximo del mensaje que acompaña a un rechazo
+	// o al resultado de una verificación.
+	MaxRejectMessageLen = 1024
+)
+
+var (
+	// ErrShortFrame indica que el frame tiene menos bytes que los que declara.
+	ErrShortFrame = errors.New("frame incompleto")
+	// ErrTrailingData indica que sobran bytes después del frame.
+	ErrTrailingData = errors.New("bytes sobrantes al final del frame")
+)
+
+// Frame es cualquier PDU del protocolo.
+type Frame interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// NormalizeWindow ajusta un tamaño de ventana pedido por el usuario al rango válido.
+func NormalizeWindow(size int) uint16 {
+	if size < 1 {
+		return 1
+	}
+	if size > MaxWindowSize {
+		return MaxWindowSize
+	}
+	return uint16(size)
+}
+
+// ReadFrame lee exactamente un frame del stream TCP y lo decodifica.
+func ReadFrame(r io.Reader) (Frame, error) {
+	typ := make([]byte, 1)
+	if _, err := io.ReadFull(r, typ); err != nil {
+		return nil, err
+	}
+
+	var (
+		frame Frame
+		raw   []byte
+		err   error
+	)
+	switch typ[0] {
+	case TypeHeader, TypeSizedHeader, TypeAttrHeader:
+		frame = &Header{}
+		raw, err = readHeader(r, typ[0])
+	case TypeSegment, TypeCheckedSegment:
+		frame = &Segment{}
+		raw, err = readSegment(r, typ[0])
+	case TypeAckHeader, TypeAckSegment, TypeAckOffer:
+		frame = &Ack{}
+		raw, err = readLengthPrefixed(r)
+	case TypeHello, TypeHelloAck:
+		frame = &Hello{}
+		raw, err = readLengthPrefixed(r)
+	case TypeReject:
+		frame = &Reject{}
+		raw, err = readLengthPrefixed(r)
+	case TypeOffer:
+		frame = &Offer{}
+		raw, err = readOffer(r)
+	case TypeTrailer:
+		frame = &Trailer{}
+		raw, err = readLengthPrefixed(r)
+	case TypeVerify:
+		frame = &Verify{}
+		raw, err = readLengthPrefixed(r)
+	default:
+		return nil, fmt.Errorf("tipo de frame desconocido: %d", typ[0])
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	raw = append(typ, raw...)
+	if err := frame.UnmarshalBinary(raw); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// ParsePacket decodifica un datagrama UDP.
+func ParsePacket(b []byte) (Frame, error) {
+	if len(b) == 0 {
+		return nil, ErrShortFrame
+	}
+	var frame Frame
+	switch b[0] {
+	case UDPTypeStart:
+		frame = &UDPStart{}
+	case UDPTypeData:
+		frame = &UDPData{}
+	case UDPTypeEnd:
+		frame = &UDPEnd{}
+	case UDPTypeStartAck:
+		frame = &UDPStartAck{}
+	case UDPTypeNak:
+		frame = &UDPNak{}
+	case UDPTypeComplete:
+		frame = &UDPComplete{}
+	case UDPTypeReject:
+		frame = &UDPReject{}
+	case UDPTypeAck:
+		frame = &UDPAck{}
+	default:
+		return nil, fmt.Errorf("tipo de paquete UDP desconocido: %d", b[0])
+	}
+	if err := frame.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// readN lee n bytes más de los ya leídos en prefix.
+func readN(r io.Reader, prefix []byte, n uint64) ([]byte, error) {
+	buf := make([]byte, uint64(len(prefix))+n)
+	copy(buf, prefix)
+	if _, err := io.ReadFull(r, buf[len(prefix):]); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readLengthPrefixed lee un frame cuyo payload está precedido por un largo Uint16.
+func readLengthPrefixed(r io.Reader) ([]byte, error) {
+	prefix := make([]byte, 2)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+	return readN(r, prefix, uint64(binary.BigEndian.Uint16(prefix)))
+}
+
+// expectType valida el byte de tipo de un frame.
+func expectType(b []byte, types ...byte) error {
+	if len(b) == 0 {
+		return ErrShortFrame
+	}
+	for _, t := range types {
+		if b[0] == t {
+			return nil
+		}
+	}
+	return fmt.Errorf("tipo de frame inesperado: %d", b[0])
+}
@@ -0,0 +1,244 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestTCPFramesRoundTrip(t *testing.T) {
+	frames := []Frame{
+		&Header{Reps: 3, ARQMode: ARQSelectiveRepeat, Window: 8, Name: "informe.pdf", Checksum: "d41d8cd98f00b204e9800998ecf8427e"},
+		&Header{Reps: 3, ARQMode: ARQGoBackN, Window: 4, Name: "informe.pdf", Checksum: "00", Size: 3000, HasSize: true},
+		&Header{Reps: 1, Name: "datos.csv", Checksum: "ab12", Size: 10, HasSize: true, HashAlgorithm: "sha256"},
+		&Header{Reps: 1, Window: 2, Name: "script.sh", Size: 40, HasSize: true, HashAlgorithm: "sha1", ModTime: 1700000000123456789, Perm: 0755, HasAttrs: true},
+		&Segment{Seq: 2, Data: []byte("hola mundo")},
+		&Segment{Seq: 0, Data: []byte{}},
+		&Segment{Seq: 5, Data: []byte("con crc"), CRC: SegmentCRC(5, []byte("con crc")), HasCRC: true},
+		&Trailer{Checksum: "d41d8cd98f00b204e9800998ecf8427e"},
+		&Trailer{},
+		&Ack{Type: TypeAckHeader},
+		&Ack{Type: TypeAckSegment, Seq: 41, Status: AckStatusDuplicate},
+		&Ack{Type: TypeAckHeader, Status: AckStatusRenamed, Name: "informe (1).pdf"},
+		&Hello{Type: TypeHello, Version: CurrentVersion, Features: FeatureWindow | FeatureResume, MaxWindow: 16, PeerName: "laptop"},
+		&Reject{Reason: RejectInvalidName, Message: "nombre inválido"},
+		&Offer{Files: []OfferedFile{{Name: "informe.pdf", Size: 123456}, {Name: "vacío.txt"}}},
+		&Ack{Type: TypeAckOffer},
+		&Verify{Result: VerifyOK},
+		&Verify{Result: VerifyChecksumMismatch, Message: "el archivo llegó dañado"},
+	}
+
+	var stream bytes.Buffer
+	for _, f := range frames {
+		b, err := f.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary(%T): %v", f, err)
+		}
+		stream.Write(b)
+	}
+
+	for _, want := range frames {
+		got, err := ReadFrame(&stream)
+		if err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadFrame = %#v, want %#v", got, want)
+		}
+	}
+	if _, err := ReadFrame(&stream); err != io.EOF {
+		t.Errorf("ReadFrame on empty stream = %v, want io.EOF", err)
+	}
+}
+
+func TestUDPPacketsRoundTrip(t *testing.T) {
+	packets := []Frame{
+		&UDPStart{TotalSegments: 10, Size: 10000, Mode: UDPReliable, Name: "foto.png", Checksum: "abc"},
+		&UDPStart{TotalSegments: 1, Size: 5, HashAlgorithm: "xxh64", Name: "nota.txt", Checksum: "0123"},
+		&UDPStart{TotalSegments: 1, Size: 7, ModTime: 1700000000123456789, Perm: 0640, Name: "clave.pem"},
+		&UDPData{Seq: 7, CRC: SegmentCRC(7, []byte{1, 2, 3}), Data: []byte{1, 2, 3}},
+		&UDPEnd{Seq: 11},
+		&UDPEnd{Seq: 2, Checksum: "9e107d9d372bb682"},
+		&UDPStartAck{},
+		&UDPStartAck{Status: AckStatusRenamed, Name: "foto (1).png"},
+		&UDPComplete{},
+		&UDPNak{Missing: []uint32{4, 5, 9, 30}},
+		&UDPReject{Reason: RejectInvalidName, Message: "nombre inválido"},
+		&UDPAck{Seq: 42},
+	}
+	for _, want := range packets {
+		b, err := want.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary(%T): %v", want, err)
+		}
+		got, err := ParsePacket(b)
+		if err != nil {
+			t.Fatalf("ParsePacket(%T): %v", want, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParsePacket = %#v, want %#v", got, want)
+		}
+	}
+}
+
+func TestStrictLengthValidation(t *testing.T) {
+	segment, _ := (&Segment{Seq: 1, Data: []byte("abc")}).MarshalBinary()
+	if err := new(Segment).UnmarshalBinary(segment[:len(segment)-1]); !errors.Is(err, ErrShortFrame) {
+		t.Errorf("truncated segment: got %v, want ErrShortFrame", err)
+	}
+	if err := new(Segment).UnmarshalBinary(append(segment, 0)); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("segment with trailing data: got %v, want ErrTrailingData", err)
+	}
+
+	complete, _ := (&UDPComplete{}).MarshalBinary()
+	if _, err := ParsePacket(append(complete, 0)); !errors.Is(err, ErrTrailingData) {
+		t.Errorf("UDP complete with trailing data: got %v, want ErrTrailingData", err)
+	}
+
+	// Lo que sigue a la secuencia del FIN es el checksum, y tiene el mismo límite
+	end, _ := (&UDPEnd{Seq: 1}).MarshalBinary()
+	if _, err := ParsePacket(append(end, make([]byte, MaxChecksumLen+1)...)); err == nil {
+		t.Error("UDP end with oversized checksum was accepted")
+	}
+
+	// Un header que declara un nombre gigante se rechaza sin intentar leerlo
+	huge := []byte{TypeHeader, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 1}
+	if _, err := ReadFrame(bytes.NewReader(huge)); err == nil {
+		t.Error("header with oversized name was accepted")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	client := &Hello{Type: TypeHello, Version: 3, Features: FeatureWindow | FeatureResume, MaxWindow: 32, PeerName: "cliente"}
+	server := &Hello{Type: TypeHelloAck, Version: CurrentVersion, Features: FeatureWindow | FeatureCompression, MaxWindow: 8, PeerName: "servidor"}
+
+	got := Negotiate(client, server)
+	want := Session{Version: CurrentVersion, Features: FeatureWindow, MaxWindow: 8, PeerName: "servidor"}
+	if got != want {
+		t.Errorf("Negotiate = %+v, want %+v", got, want)
+	}
+	if got.Has(FeatureResume) {
+		t.Error("feature supported by only one peer was enabled")
+	}
+}
+
+func FuzzReadFrame(f *testing.F) {
+	for _, seed := range []Frame{
+		&Header{Reps: 1, Name: "a.txt", Checksum: "00"},
+		&Header{Reps: 1, Name: "a.txt", Checksum: "00", Size: 10, HasSize: true},
+		&Segment{Seq: 1, Data: []byte("xyz")},
+		&Segment{Seq: 1, Data: []byte("xyz"), CRC: 1, HasCRC: true},
+		&Trailer{Checksum: "00"},
+		&Verify{Result: VerifySizeMismatch, Message: "x"},
+		&Ack{Type: TypeAckSegment, Seq: 3},
+		&Hello{Type: TypeHelloAck, Version: CurrentVersion, MaxWindow: 1},
+		&Offer{Files: []OfferedFile{{Name: "c.txt", Size: 10}}},
+	} {
+		b, _ := seed.MarshalBinary()
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		frame, err := ReadFrame(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		encoded, err := frame.MarshalBinary()
+		if err != nil {
+			t.Fatalf("decoded frame %#v does not re-encode: %v", frame, err)
+		}
+		again, err := ReadFrame(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("re-encoded frame does not decode: %v", err)
+		}
+		if !reflect.DeepEqual(frame, again) {
+			t.Fatalf("round trip mismatch: %#v != %#v", frame, again)
+		}
+	})
+}
+
+func FuzzParsePacket(f *testing.F) {
+	for _, seed := range []Frame{
+		&UDPStart{TotalSegments: 2, Name: "b.bin"},
+		&UDPData{Seq: 1, Data: []byte("data")},
+		&UDPEnd{Seq: 3},
+		&UDPEnd{Seq: 3, Checksum: "ab"},
+		&UDPNak{Missing: []uint32{1, 3}},
+		&UDPAck{Seq: 1},
+	} {
+		b, _ := seed.MarshalBinary()
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet, err := ParsePacket(data)
+		if err != nil {
+			return
+		}
+		encoded, err := packet.MarshalBinary()
+		if err != nil {
+			t.Fatalf("decoded packet %#v does not re-encode: %v", packet, err)
+		}
+		again, err := ParsePacket(encoded)
+		if err != nil {
+			t.Fatalf("re-encoded packet does not decode: %v", err)
+		}
+		if !reflect.DeepEqual(packet, again) {
+			t.Fatalf("round trip mismatch: %#v != %#v", packet, again)
+		}
+	})
+}
+
+func TestSegments(t *testing.T) {
+	tests := []struct {
+		size uint64
+		want uint32
+	}{
+		{0, 0},
+		{1, 1},
+		{SegmentSize, 1},
+		{SegmentSize + 1, 2},
+		{10 * SegmentSize, 10},
+	}
+	for _, tt := range tests {
+		if got := Segments(tt.size, SegmentSize); got != tt.want {
+			t.Errorf("Segments(%d) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestSegmentCRC(t *testing.T) {
+	data := []byte("datos del segmento")
+	segment := &Segment{Seq: 3, Data: data, CRC: SegmentCRC(3, data), HasCRC: true}
+	if !segment.Valid() {
+		t.Fatal("segment with matching CRC reported as corrupt")
+	}
+
+	b, _ := segment.MarshalBinary()
+	b[len(b)-2] ^= 0x01 // un bit del último byte de datos
+	var damaged Segment
+	if err := damaged.UnmarshalBinary(b); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if damaged.Valid() {
+		t.Error("segment with a flipped bit passed the CRC check")
+	}
+
+	// El CRC también cubre la secuencia
+	moved := &Segment{Seq: 4, Data: data, CRC: segment.CRC, HasCRC: true}
+	if moved.Valid() {
+		t.Error("segment with a different sequence passed the CRC check")
+	}
+
+	if !(&Segment{Seq: 1, Data: data}).Valid() {
+		t.Error("segment without CRC reported as corrupt")
+	}
+
+	packet := &UDPData{Seq: 9, CRC: SegmentCRC(9, data), Data: append([]byte(nil), data...)}
+	packet.Data[0] ^= 0x80
+	if packet.Valid() {
+		t.Error("UDP data with a flipped bit passed the CRC check")
+	}
+}
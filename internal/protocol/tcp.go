@@ -0,0 +1,503 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Códigos de estado que acompañan a cada confirmación.
+const (
+	AckStatusOK byte = iota
+	AckStatusDuplicate
+	// AckStatusResume en la confirmación del header indica que el servidor ya tiene
+	// los segmentos anteriores a Seq y la transferencia continúa desde ahí.
+	AckStatusResume
+	// AckStatusSkipped indica que el receptor ya tiene el archivo (o decidió no
+	// reemplazarlo) y el emisor debe pasar al siguiente sin enviar datos.
+	AckStatusSkipped
+	// AckStatusRenamed indica que ya existía un archivo con ese nombre y el nuevo
+	// se guarda con el nombre que viaja en la confirmación.
+	AckStatusRenamed
+	// AckStatusOverwritten indica que el archivo reemplaza a uno existente.
+	AckStatusOverwritten
+	// AckStatusPending solo se usa en UDP: el receptor todavía está decidiendo
+	// qué hacer con el archivo y el emisor debe seguir esperando.
+	AckStatusPending
+	// AckStatusCorrupt en la confirmación de un segmento indica que llegó con el
+	// CRC incorrecto y el emisor debe reenviarlo sin esperar al temporizador.
+	AckStatusCorrupt
+)
+
+const (
+	headerFixedLen  = 1 + 4 + 4 + 4 + 1 + 2 // tipo, reps, nameLen, checksumLen, modo, ventana
+	headerExtLen    = 8 + 1                 // tamaño y hashLen, en TypeSizedHeader y TypeAttrHeader
+	headerAttrLen   = 8 + 4                 // fecha y permisos, solo en TypeAttrHeader
+	segmentFixedLen = 1 + 4 + 4             // tipo, secuencia, largo
+	segmentCRCLen   = 4                     // CRC32, solo en TypeCheckedSegment
+	ackPrefixLen    = 1 + 2                 // tipo, largo del payload
+	ackPayloadLen   = 4 + 1                 // secuencia, estado
+	headerEndByte   = 0
+	segmentEndByte  = 1
+)
+
+// Header es el frame de control que precede a cada archivo:
+// [1 tipo][4 reps][8 tamaño][1 hashLen][8 fecha][4 permisos][4 nameLen][4 checksumLen][1 modo ARQ][2 ventana][algoritmo][nombre][checksum][1 fin=0]
+// El tamaño y el algoritmo de hash solo viajan si ambos extremos negociaron
+// FeatureFileSize (tipo TypeSizedHeader); los pares anteriores usan TypeHeader,
+// sin esos campos, y verifican siempre con MD5. Un algoritmo distinto de MD5
+// requiere además FeatureHashAlgorithms. La fecha y los permisos solo viajan
+// con FeatureFileAttributes (tipo TypeAttrHeader), que requiere el tamaño.
+type Header struct {
+	Reps     uint32
+	ARQMode  byte
+	Window   uint16
+	Name     string
+	Checksum string
+	// Size es el tamaño del archivo en bytes; HasSize indica si el emisor lo informó.
+	Size    uint64
+	HasSize bool
+	// HashAlgorithm es el algoritmo con el que se calculó Checksum; vacío es MD5.
+	HashAlgorithm string
+	// ModTime es la fecha de modificación en nanosegundos desde la época Unix y
+	// Perm los permisos del archivo; HasAttrs indica si el emisor los informó.
+	ModTime  int64
+	Perm     uint32
+	HasAttrs bool
+}
+
+func (h *Header) MarshalBinary() ([]byte, error) {
+	if len(h.Name) == 0 || len(h.Name) > MaxNameLen {
+		return nil, fmt.Errorf("largo de nombre inválido: %d", len(h.Name))
+	}
+	if len(h.Checksum) > MaxChecksumLen {
+		return nil, fmt.Errorf("largo de checksum inválido: %d", len(h.Checksum))
+	}
+	if len(h.HashAlgorithm) > MaxHashNameLen {
+		return nil, fmt.Errorf("nombre de algoritmo demasiado largo: %d", len(h.HashAlgorithm))
+	}
+	if !h.HasSize && h.HashAlgorithm != "" {
+		return nil, fmt.Errorf("el header sin tamaño no admite otro algoritmo que MD5")
+	}
+	if !h.HasSize && h.HasAttrs {
+		return nil, fmt.Errorf("el header sin tamaño no admite fecha ni permisos")
+	}
+	b := make([]byte, 0, headerFixedLen+headerExtLen+headerAttrLen+len(h.HashAlgorithm)+len(h.Name)+len(h.Checksum)+1)
+	if h.HasSize {
+		typ := TypeSizedHeader
+		if h.HasAttrs {
+			typ = TypeAttrHeader
+		}
+		b = append(b, typ)
+		b = binary.BigEndian.AppendUint32(b, h.Reps)
+		b = binary.BigEndian.AppendUint64(b, h.Size)
+		b = append(b, byte(len(h.HashAlgorithm)))
+		if h.HasAttrs {
+			b = binary.BigEndian.AppendUint64(b, uint64(h.ModTime))
+			b = binary.BigEndian.AppendUint32(b, h.Perm)
+		}
+	} else {
+		b = append(b, TypeHeader)
+		b = binary.BigEndian.AppendUint32(b, h.Reps)
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(h.Name)))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(h.Checksum)))
+	b = append(b, h.ARQMode)
+	b = binary.BigEndian.AppendUint16(b, h.Window)
+	b = append(b, h.HashAlgorithm...)
+	b = append(b, h.Name...)
+	b = append(b, h.Checksum...)
+	return append(b, headerEndByte), nil
+}
+
+func (h *Header) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, TypeHeader, TypeSizedHeader, TypeAttrHeader); err != nil {
+		return err
+	}
+	fixedLen := headerFixedLenFor(b[0])
+	if len(b) < fixedLen {
+		return ErrShortFrame
+	}
+	hashLen, nameLen, checksumLen, err := headerLengths(b)
+	if err != nil {
+		return err
+	}
+	total := fixedLen + int(hashLen) + int(nameLen) + int(checksumLen) + 1
+	if len(b) < total {
+		return ErrShortFrame
+	}
+	if len(b) > total {
+		return ErrTrailingData
+	}
+	if b[total-1] != headerEndByte {
+		return fmt.Errorf("header inválido: falta el byte de fin")
+	}
+	// Los campos posteriores al tamaño quedan desplazados en el header con tamaño
+	off := fixedLen - headerFixedLen
+	if b[off+13] > ARQSelectiveRepeat {
+		return fmt.Errorf("modo de ARQ desconocido: %d", b[off+13])
+	}
+	name := fixedLen + int(hashLen)
+	checksum := name + int(nameLen)
+	*h = Header{
+		Reps:          binary.BigEndian.Uint32(b[1:5]),
+		ARQMode:       b[off+13],
+		Window:        binary.BigEndian.Uint16(b[off+14 : off+16]),
+		HashAlgorithm: string(b[fixedLen:name]),
+		Name:          string(b[name:checksum]),
+		Checksum:      string(b[checksum : total-1]),
+	}
+	if b[0] != TypeHeader {
+		h.Size = binary.BigEndian.Uint64(b[5:13])
+		h.HasSize = true
+	}
+	if b[0] == TypeAttrHeader {
+		h.ModTime = int64(binary.BigEndian.Uint64(b[14:22]))
+		h.Perm = binary.BigEndian.Uint32(b[22:26])
+		h.HasAttrs = true
+	}
+	return nil
+}
+
+// headerFixedLenFor devuelve el largo de la parte fija de cada tipo de header.
+func headerFixedLenFor(typ byte) int {
+	switch typ {
+	case TypeSizedHeader:
+		return headerFixedLen + headerExtLen
+	case TypeAttrHeader:
+		return headerFixedLen + headerExtLen + headerAttrLen
+	}
+	return headerFixedLen
+}
+
+// headerLengths valida los largos declarados en la parte fija del header.
+func headerLengths(b []byte) (hashLen byte, nameLen, checksumLen uint32, err error) {
+	off := headerFixedLenFor(b[0]) - headerFixedLen
+	if off > 0 {
+		hashLen = b[13]
+	}
+	nameLen = binary.BigEndian.Uint32(b[off+5 : off+9])
+	checksumLen = binary.BigEndian.Uint32(b[off+9 : off+13])
+	if hashLen > MaxHashNameLen {
+		return 0, 0, 0, fmt.Errorf("nombre de algoritmo demasiado largo: %d", hashLen)
+	}
+	if nameLen == 0 || nameLen > MaxNameLen {
+		return 0, 0, 0, fmt.Errorf("largo de nombre inválido: %d", nameLen)
+	}
+	if checksumLen > MaxChecksumLen {
+		return 0, 0, 0, fmt.Errorf("largo de checksum inválido: %d", checksumLen)
+	}
+	return hashLen, nameLen, checksumLen, nil
+}
+
+func readHeader(r io.Reader, typ byte) ([]byte, error) {
+	fixed, err := readN(r, []byte{typ}, uint64(headerFixedLenFor(typ)-1))
+	if err != nil {
+		return nil, err
+	}
+	hashLen, nameLen, checksumLen, err := headerLengths(fixed)
+	if err != nil {
+		return nil, err
+	}
+	b, err := readN(r, fixed, uint64(hashLen)+uint64(nameLen)+uint64(checksumLen)+1)
+	if err != nil {
+		return nil, err
+	}
+	return b[1:], nil
+}
+
+// Segments devuelve cuántos segmentos de segmentSize bytes hacen falta para
+// enviar size bytes. Un archivo vacío no tiene segmentos.
+func Segments(size uint64, segmentSize int) uint32 {
+	return uint32((size + uint64(segmentSize) - 1) / uint64(segmentSize))
+}
+
+// Segment es un fragmento de datos del archivo:
+// [1 tipo][4 secuencia][4 largo][4 CRC32][datos][1 fin=1]
+// El CRC solo viaja si ambos extremos negociaron FeatureSegmentCRC (tipo
+// TypeCheckedSegment); los pares anteriores usan TypeSegment, sin ese campo.
+type Segment struct {
+	Seq  uint32
+	Data []byte
+	// CRC es el valor que calculó el emisor con SegmentCRC; HasCRC indica si viaja.
+	CRC    uint32
+	HasCRC bool
+}
+
+// SegmentCRC calcula el CRC32 (IEEE) de un segmento. Cubre también el número de
+// secuencia, para que un segmento dañado no se confunda con otro.
+func SegmentCRC(seq uint32, data []byte) uint32 {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], seq)
+	return crc32.Update(crc32.ChecksumIEEE(b[:]), crc32.IEEETable, data)
+}
+
+// Valid indica si el CRC del segmento coincide con su contenido. Un segmento sin
+// CRC siempre es válido.
+func (s *Segment) Valid() bool {
+	return !s.HasCRC || s.CRC == SegmentCRC(s.Seq, s.Data)
+}
+
+func (s *Segment) MarshalBinary() ([]byte, error) {
+	if len(s.Data) > MaxSegmentData {
+		return nil, fmt.Errorf("segmento demasiado grande: %d bytes", len(s.Data))
+	}
+	b := make([]byte, 0, segmentFixedLen+segmentCRCLen+len(s.Data)+1)
+	if s.HasCRC {
+		b = append(b, TypeCheckedSegment)
+	} else {
+		b = append(b, TypeSegment)
+	}
+	b = binary.BigEndian.AppendUint32(b, s.Seq)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s.Data)))
+	if s.HasCRC {
+		b = binary.BigEndian.AppendUint32(b, s.CRC)
+	}
+	b = append(b, s.Data...)
+	return append(b, segmentEndByte), nil
+}
+
+func (s *Segment) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, TypeSegment, TypeCheckedSegment); err != nil {
+		return err
+	}
+	fixedLen := segmentFixedLenFor(b[0])
+	if len(b) < fixedLen {
+		return ErrShortFrame
+	}
+	dataLen := binary.BigEndian.Uint32(b[5:9])
+	if dataLen > MaxSegmentData {
+		return fmt.Errorf("segmento demasiado grande: %d bytes", dataLen)
+	}
+	total := fixedLen + int(dataLen) + 1
+	if len(b) < total {
+		return ErrShortFrame
+	}
+	if len(b) > total {
+		return ErrTrailingData
+	}
+	if b[total-1] != segmentEndByte {
+		return fmt.Errorf("segmento inválido: falta el byte de fin")
+	}
+	*s = Segment{
+		Seq:    binary.BigEndian.Uint32(b[1:5]),
+		Data:   make([]byte, dataLen),
+		HasCRC: b[0] == TypeCheckedSegment,
+	}
+	if s.HasCRC {
+		s.CRC = binary.BigEndian.Uint32(b[segmentFixedLen:fixedLen])
+	}
+	copy(s.Data, b[fixedLen:total-1])
+	return nil
+}
+
+// segmentFixedLenFor devuelve el largo de la parte fija de un segmento según su tipo.
+func segmentFixedLenFor(typ byte) int {
+	if typ == TypeCheckedSegment {
+		return segmentFixedLen + segmentCRCLen
+	}
+	return segmentFixedLen
+}
+
+func readSegment(r io.Reader, typ byte) ([]byte, error) {
+	fixed, err := readN(r, []byte{typ}, uint64(segmentFixedLenFor(typ)-1))
+	if err != nil {
+		return nil, err
+	}
+	dataLen := binary.BigEndian.Uint32(fixed[5:9])
+	if dataLen > MaxSegmentData {
+		return nil, fmt.Errorf("segmento demasiado grande: %d bytes", dataLen)
+	}
+	b, err := readN(r, fixed, uint64(dataLen)+1)
+	if err != nil {
+		return nil, err
+	}
+	return b[1:], nil
+}
+
+// Trailer cierra los datos de un archivo con el checksum que el emisor calculó
+// mientras lo enviaba, si se negoció FeatureTrailer. Se envía cuando todos los
+// segmentos están confirmados: [1 tipo][2 largo del payload][checksum]
+type Trailer struct {
+	Checksum string
+}
+
+func (t *Trailer) MarshalBinary() ([]byte, error) {
+	if len(t.Checksum) > MaxChecksumLen {
+		return nil, fmt.Errorf("largo de checksum inválido: %d", len(t.Checksum))
+	}
+	b := make([]byte, 0, ackPrefixLen+len(t.Checksum))
+	b = append(b, TypeTrailer)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(t.Checksum)))
+	return append(b, t.Checksum...), nil
+}
+
+func (t *Trailer) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, TypeTrailer); err != nil {
+		return err
+	}
+	if len(b) < ackPrefixLen {
+		return ErrShortFrame
+	}
+	length := int(binary.BigEndian.Uint16(b[1:3]))
+	if length > MaxChecksumLen {
+		return fmt.Errorf("largo de checksum inválido: %d", length)
+	}
+	if len(b) < ackPrefixLen+length {
+		return ErrShortFrame
+	}
+	if len(b) > ackPrefixLen+length {
+		return ErrTrailingData
+	}
+	t.Checksum = string(b[ackPrefixLen:])
+	return nil
+}
+
+// Ack es la confirmación que el servidor envía por cada header y segmento, y al
+// aceptar una oferta de archivos:
+// [1 tipo][2 largo del payload][4 secuencia][1 estado][nombre opcional]
+// El largo permite agregar campos en el futuro sin romper a los lectores actuales.
+// El nombre solo viaja con AckStatusRenamed y es el nombre con el que se guardó el archivo.
+type Ack struct {
+	Type   byte
+	Seq    uint32
+	Status byte
+	Name   string
+}
+
+func (a *Ack) MarshalBinary() ([]byte, error) {
+	if a.Type != TypeAckHeader && a.Type != TypeAckSegment && a.Type != TypeAckOffer {
+		return nil, fmt.Errorf("tipo de confirmación desconocido: %d", a.Type)
+	}
+	if len(a.Name) > MaxNameLen {
+		return nil, fmt.Errorf("largo de nombre inválido: %d", len(a.Name))
+	}
+	b := make([]byte, 0, ackPrefixLen+ackPayloadLen+len(a.Name))
+	b = append(b, a.Type)
+	b = binary.BigEndian.AppendUint16(b, uint16(ackPayloadLen+len(a.Name)))
+	b = binary.BigEndian.AppendUint32(b, a.Seq)
+	b = append(b, a.Status)
+	return append(b, a.Name...), nil
+}
+
+func (a *Ack) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, TypeAckHeader, TypeAckSegment, TypeAckOffer); err != nil {
+		return err
+	}
+	if len(b) < ackPrefixLen {
+		return ErrShortFrame
+	}
+	length := int(binary.BigEndian.Uint16(b[1:3]))
+	if length < ackPayloadLen {
+		return fmt.Errorf("confirmación demasiado corta: %d bytes", length)
+	}
+	if length > ackPayloadLen+MaxNameLen {
+		return fmt.Errorf("largo de nombre inválido: %d", length-ackPayloadLen)
+	}
+	if len(b) < ackPrefixLen+length {
+		return ErrShortFrame
+	}
+	if len(b) > ackPrefixLen+length {
+		return ErrTrailingData
+	}
+	*a = Ack{
+		Type:   b[0],
+		Seq:    binary.BigEndian.Uint32(b[3:7]),
+		Status: b[7],
+		Name:   string(b[ackPrefixLen+ackPayloadLen:]),
+	}
+	return nil
+}
+
+// Reject responde a un header en lugar del ACK cuando el receptor no acepta el archivo:
+// [1 tipo][2 largo del payload][1 motivo][mensaje]
+type Reject struct {
+	Reason  byte
+	Message string
+}
+
+func (r *Reject) MarshalBinary() ([]byte, error) {
+	if len(r.Message) > MaxRejectMessageLen {
+		return nil, fmt.Errorf("mensaje de rechazo demasiado largo: %d", len(r.Message))
+	}
+	b := make([]byte, 0, ackPrefixLen+1+len(r.Message))
+	b = append(b, TypeReject)
+	b = binary.BigEndian.AppendUint16(b, uint16(1+len(r.Message)))
+	b = append(b, r.Reason)
+	return append(b, r.Message...), nil
+}
+
+func (r *Reject) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, TypeReject); err != nil {
+		return err
+	}
+	if len(b) < ackPrefixLen {
+		return ErrShortFrame
+	}
+	length := int(binary.BigEndian.Uint16(b[1:3]))
+	if length < 1 {
+		return fmt.Errorf("rechazo sin motivo")
+	}
+	if length-1 > MaxRejectMessageLen {
+		return fmt.Errorf("mensaje de rechazo demasiado largo: %d", length-1)
+	}
+	if len(b) < ackPrefixLen+length {
+		return ErrShortFrame
+	}
+	if len(b) > ackPrefixLen+length {
+		return ErrTrailingData
+	}
+	*r = Reject{
+		Reason:  b[3],
+		Message: string(b[4:]),
+	}
+	return nil
+}
+
+// Verify informa el resultado de la verificación final de un archivo, si se
+// negoció FeatureVerify. El receptor lo envía después de comparar el checksum,
+// y el emisor lo espera antes de pasar al siguiente archivo:
+// [1 tipo][2 largo del payload][1 resultado][mensaje]
+type Verify struct {
+	Result  byte
+	Message string
+}
+
+func (v *Verify) MarshalBinary() ([]byte, error) {
+	if len(v.Message) > MaxRejectMessageLen {
+		return nil, fmt.Errorf("mensaje de verificación demasiado largo: %d", len(v.Message))
+	}
+	b := make([]byte, 0, ackPrefixLen+1+len(v.Message))
+	b = append(b, TypeVerify)
+	b = binary.BigEndian.AppendUint16(b, uint16(1+len(v.Message)))
+	b = append(b, v.Result)
+	return append(b, v.Message...), nil
+}
+
+func (v *Verify) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, TypeVerify); err != nil {
+		return err
+	}
+	if len(b) < ackPrefixLen {
+		return ErrShortFrame
+	}
+	length := int(binary.BigEndian.Uint16(b[1:3]))
+	if length < 1 {
+		return fmt.Errorf("verificación sin resultado")
+	}
+	if length-1 > MaxRejectMessageLen {
+		return fmt.Errorf("mensaje de verificación demasiado largo: %d", length-1)
+	}
+	if len(b) < ackPrefixLen+length {
+		return ErrShortFrame
+	}
+	if len(b) > ackPrefixLen+length {
+		return ErrTrailingData
+	}
+	*v = Verify{
+		Result:  b[3],
+		Message: string(b[4:]),
+	}
+	return nil
+}
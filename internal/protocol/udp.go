@@ -0,0 +1,352 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	udpStartFixedLen = 1 + 4 + 8 + 1 + 4 + 4 + 1 + 8 + 4 // tipo, segmentos, tamaño, hashLen, nameLen, checksumLen, modo, fecha, permisos
+	udpSeqLen        = 1 + 4                             // tipo, secuencia
+	udpDataFixedLen  = udpSeqLen + 4                     // tipo, secuencia, CRC32
+	// MaxNakSegments es la cantidad de segmentos que puede describir un único NAK (bitmap de 1000 bytes).
+	MaxNakSegments = 8 * 1000
+)
+
+// UDPStart abre una transferencia UDP:
+// [1 tipo][4 segmentos][8 tamaño][1 hashLen][4 nameLen][4 checksumLen][1 modo][8 fecha][4 permisos][algoritmo][nombre][checksum]
+// Un algoritmo vacío es MD5. La fecha de modificación va en nanosegundos desde
+// la época Unix; en cero, igual que los permisos, no se conoce.
+type UDPStart struct {
+	TotalSegments uint32
+	Size          uint64
+	Mode          byte
+	ModTime       int64
+	Perm          uint32
+	HashAlgorithm string
+	Name          string
+	Checksum      string
+}
+
+func (p *UDPStart) MarshalBinary() ([]byte, error) {
+	if len(p.Name) == 0 || len(p.Name) > MaxNameLen {
+		return nil, fmt.Errorf("largo de nombre inválido: %d", len(p.Name))
+	}
+	if len(p.Checksum) > MaxChecksumLen {
+		return nil, fmt.Errorf("largo de checksum inválido: %d", len(p.Checksum))
+	}
+	if len(p.HashAlgorithm) > MaxHashNameLen {
+		return nil, fmt.Errorf("nombre de algoritmo demasiado largo: %d", len(p.HashAlgorithm))
+	}
+	b := make([]byte, 0, udpStartFixedLen+len(p.HashAlgorithm)+len(p.Name)+len(p.Checksum))
+	b = append(b, UDPTypeStart)
+	b = binary.BigEndian.AppendUint32(b, p.TotalSegments)
+	b = binary.BigEndian.AppendUint64(b, p.Size)
+	b = append(b, byte(len(p.HashAlgorithm)))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(p.Name)))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(p.Checksum)))
+	b = append(b, p.Mode)
+	b = binary.BigEndian.AppendUint64(b, uint64(p.ModTime))
+	b = binary.BigEndian.AppendUint32(b, p.Perm)
+	b = append(b, p.HashAlgorithm...)
+	b = append(b, p.Name...)
+	return append(b, p.Checksum...), nil
+}
+
+func (p *UDPStart) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, UDPTypeStart); err != nil {
+		return err
+	}
+	if len(b) < udpStartFixedLen {
+		return ErrShortFrame
+	}
+	hashLen := b[13]
+	nameLen := binary.BigEndian.Uint32(b[14:18])
+	checksumLen := binary.BigEndian.Uint32(b[18:22])
+	if hashLen > MaxHashNameLen {
+		return fmt.Errorf("nombre de algoritmo demasiado largo: %d", hashLen)
+	}
+	if nameLen == 0 || nameLen > MaxNameLen {
+		return fmt.Errorf("largo de nombre inválido: %d", nameLen)
+	}
+	if checksumLen > MaxChecksumLen {
+		return fmt.Errorf("largo de checksum inválido: %d", checksumLen)
+	}
+	total := udpStartFixedLen + int(hashLen) + int(nameLen) + int(checksumLen)
+	if len(b) < total {
+		return ErrShortFrame
+	}
+	if len(b) > total {
+		return ErrTrailingData
+	}
+	if b[22] > UDPReliable {
+		return fmt.Errorf("modo UDP desconocido: %d", b[22])
+	}
+	name := udpStartFixedLen + int(hashLen)
+	checksum := name + int(nameLen)
+	*p = UDPStart{
+		TotalSegments: binary.BigEndian.Uint32(b[1:5]),
+		Size:          binary.BigEndian.Uint64(b[5:13]),
+		Mode:          b[22],
+		ModTime:       int64(binary.BigEndian.Uint64(b[23:31])),
+		Perm:          binary.BigEndian.Uint32(b[31:35]),
+		HashAlgorithm: string(b[udpStartFixedLen:name]),
+		Name:          string(b[name:checksum]),
+		Checksum:      string(b[checksum:total]),
+	}
+	return nil
+}
+
+// UDPData transporta un fragmento del archivo: [1 tipo][4 secuencia][4 CRC32][datos]
+// El CRC se calcula con SegmentCRC; un fragmento dañado se descarta y se pide de nuevo.
+type UDPData struct {
+	Seq  uint32
+	CRC  uint32
+	Data []byte
+}
+
+// Valid indica si el CRC del fragmento coincide con su contenido.
+func (p *UDPData) Valid() bool {
+	return p.CRC == SegmentCRC(p.Seq, p.Data)
+}
+
+func (p *UDPData) MarshalBinary() ([]byte, error) {
+	if udpDataFixedLen+len(p.Data) > MaxDatagramSize {
+		return nil, fmt.Errorf("datagrama demasiado grande: %d bytes", len(p.Data))
+	}
+	b := make([]byte, 0, udpDataFixedLen+len(p.Data))
+	b = append(b, UDPTypeData)
+	b = binary.BigEndian.AppendUint32(b, p.Seq)
+	b = binary.BigEndian.AppendUint32(b, p.CRC)
+	return append(b, p.Data...), nil
+}
+
+func (p *UDPData) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, UDPTypeData); err != nil {
+		return err
+	}
+	if len(b) < udpDataFixedLen {
+		return ErrShortFrame
+	}
+	if len(b) > MaxDatagramSize {
+		return fmt.Errorf("datagrama demasiado grande: %d bytes", len(b))
+	}
+	p.Seq = binary.BigEndian.Uint32(b[1:5])
+	p.CRC = binary.BigEndian.Uint32(b[5:9])
+	p.Data = make([]byte, len(b)-udpDataFixedLen)
+	copy(p.Data, b[udpDataFixedLen:])
+	return nil
+}
+
+// UDPEnd cierra el envío de datos: [1 tipo][4 secuencia][checksum]
+// El checksum es opcional: el emisor lo calcula mientras envía y lo manda acá
+// cuando no viajó en el paquete de inicio.
+type UDPEnd struct {
+	Seq      uint32
+	Checksum string
+}
+
+func (p *UDPEnd) MarshalBinary() ([]byte, error) {
+	if len(p.Checksum) > MaxChecksumLen {
+		return nil, fmt.Errorf("largo de checksum inválido: %d", len(p.Checksum))
+	}
+	b := make([]byte, 0, udpSeqLen+len(p.Checksum))
+	b = append(b, UDPTypeEnd)
+	b = binary.BigEndian.AppendUint32(b, p.Seq)
+	return append(b, p.Checksum...), nil
+}
+
+func (p *UDPEnd) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, UDPTypeEnd); err != nil {
+		return err
+	}
+	if len(b) < udpSeqLen {
+		return ErrShortFrame
+	}
+	if len(b)-udpSeqLen > MaxChecksumLen {
+		return fmt.Errorf("largo de checksum inválido: %d", len(b)-udpSeqLen)
+	}
+	*p = UDPEnd{
+		Seq:      binary.BigEndian.Uint32(b[1:5]),
+		Checksum: string(b[udpSeqLen:]),
+	}
+	return nil
+}
+
+// UDPAck confirma un fragmento recibido sin errores en el modo fiable:
+// [1 tipo][4 secuencia]. No reemplaza al NAK, que sigue pidiendo los faltantes;
+// le sirve al emisor para medir el RTT y regular el ritmo de envío.
+type UDPAck struct {
+	Seq uint32
+}
+
+func (p *UDPAck) MarshalBinary() ([]byte, error) {
+	return binary.BigEndian.AppendUint32([]byte{UDPTypeAck}, p.Seq), nil
+}
+
+func (p *UDPAck) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, UDPTypeAck); err != nil {
+		return err
+	}
+	if len(b) < udpSeqLen {
+		return ErrShortFrame
+	}
+	if len(b) > udpSeqLen {
+		return ErrTrailingData
+	}
+	p.Seq = binary.BigEndian.Uint32(b[1:5])
+	return nil
+}
+
+// UDPStartAck confirma el paquete de inicio: [1 tipo][1 estado][nombre]
+// El estado y el nombre son opcionales y usan los mismos códigos que la
+// confirmación del header TCP; un paquete de un solo byte equivale a AckStatusOK.
+// En el modo simple solo se envía si el estado no es AckStatusOK.
+type UDPStartAck struct {
+	Status byte
+	Name   string
+}
+
+func (p *UDPStartAck) MarshalBinary() ([]byte, error) {
+	if p.Status == AckStatusOK && p.Name == "" {
+		return []byte{UDPTypeStartAck}, nil
+	}
+	if len(p.Name) > MaxNameLen {
+		return nil, fmt.Errorf("largo de nombre inválido: %d", len(p.Name))
+	}
+	b := make([]byte, 0, 2+len(p.Name))
+	b = append(b, UDPTypeStartAck, p.Status)
+	return append(b, p.Name...), nil
+}
+
+func (p *UDPStartAck) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, UDPTypeStartAck); err != nil {
+		return err
+	}
+	if len(b) == 1 {
+		*p = UDPStartAck{}
+		return nil
+	}
+	if len(b)-2 > MaxNameLen {
+		return fmt.Errorf("largo de nombre inválido: %d", len(b)-2)
+	}
+	*p = UDPStartAck{
+		Status: b[1],
+		Name:   string(b[2:]),
+	}
+	return nil
+}
+
+// UDPComplete confirma que el archivo llegó completo en el modo fiable: [1 tipo]
+type UDPComplete struct{}
+
+func (p *UDPComplete) MarshalBinary() ([]byte, error) {
+	return []byte{UDPTypeComplete}, nil
+}
+
+func (p *UDPComplete) UnmarshalBinary(b []byte) error {
+	return unmarshalEmpty(b, UDPTypeComplete)
+}
+
+func unmarshalEmpty(b []byte, typ byte) error {
+	if err := expectType(b, typ); err != nil {
+		return err
+	}
+	if len(b) > 1 {
+		return ErrTrailingData
+	}
+	return nil
+}
+
+// UDPReject responde al paquete de inicio cuando el receptor no acepta el archivo:
+// [1 tipo][1 motivo][mensaje]
+type UDPReject struct {
+	Reason  byte
+	Message string
+}
+
+func (p *UDPReject) MarshalBinary() ([]byte, error) {
+	if len(p.Message) > MaxRejectMessageLen {
+		return nil, fmt.Errorf("mensaje de rechazo demasiado largo: %d", len(p.Message))
+	}
+	b := make([]byte, 0, 2+len(p.Message))
+	b = append(b, UDPTypeReject, p.Reason)
+	return append(b, p.Message...), nil
+}
+
+func (p *UDPReject) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, UDPTypeReject); err != nil {
+		return err
+	}
+	if len(b) < 2 {
+		return ErrShortFrame
+	}
+	if len(b)-2 > MaxRejectMessageLen {
+		return ErrTrailingData
+	}
+	*p = UDPReject{
+		Reason:  b[1],
+		Message: string(b[2:]),
+	}
+	return nil
+}
+
+// UDPNak informa los segmentos faltantes: [1 tipo][4 primer faltante][bitmap]
+// donde el bit i del bitmap indica que falta el segmento primero+i. Si la lista
+// no entra en un solo NAK se describen solo los primeros MaxNakSegments.
+type UDPNak struct {
+	Missing []uint32
+}
+
+func (p *UDPNak) MarshalBinary() ([]byte, error) {
+	if len(p.Missing) == 0 {
+		return nil, fmt.Errorf("NAK sin segmentos faltantes")
+	}
+	first := p.Missing[0]
+	b := binary.BigEndian.AppendUint32([]byte{UDPTypeNak}, first)
+	var bitmap []byte
+	for _, seq := range p.Missing {
+		if seq < first {
+			return nil, fmt.Errorf("NAK desordenado: %d antes que %d", first, seq)
+		}
+		offset := seq - first
+		if offset >= MaxNakSegments {
+			break
+		}
+		for uint32(len(bitmap)) <= offset/8 {
+			bitmap = append(bitmap, 0)
+		}
+		bitmap[offset/8] |= 1 << (offset % 8)
+	}
+	return append(b, bitmap...), nil
+}
+
+func (p *UDPNak) UnmarshalBinary(b []byte) error {
+	if err := expectType(b, UDPTypeNak); err != nil {
+		return err
+	}
+	if len(b) < udpSeqLen+1 {
+		return ErrShortFrame
+	}
+	if len(b) > udpSeqLen+MaxNakSegments/8 {
+		return ErrTrailingData
+	}
+	first := binary.BigEndian.Uint32(b[1:5])
+	var missing []uint32
+	for i, bits := range b[udpSeqLen:] {
+		for bit := 0; bit < 8; bit++ {
+			if bits&(1<<bit) != 0 {
+				if uint64(first)+uint64(i*8+bit) > math.MaxUint32 {
+					return fmt.Errorf("NAK inválido: el bitmap excede el rango de secuencias")
+				}
+				missing = append(missing, first+uint32(i*8+bit))
+			}
+		}
+	}
+	if len(missing) == 0 || missing[0] != first {
+		return fmt.Errorf("NAK inválido: el bitmap no marca el primer segmento")
+	}
+	p.Missing = missing
+	return nil
+}
@@ -3,66 +3,218 @@ package server
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
 	"net"
+	"strconv"
 	"sync"
+	"syscall"
+	"time"
+
+	"github.com/NeichS/final-redes-wails/internal/events"
+	"github.com/NeichS/final-redes-wails/internal/impair"
 )
 
 type Server struct {
-	ctx         context.Context
+	// events y logger reciben los eventos para la interfaz y los mensajes de log
+	events      events.Sink
+	logger      events.Logger
 	tcpListener net.Listener
 	udpConn     *net.UDPConn
 	mu          sync.Mutex
 	isListening bool
 	connsMu     sync.Mutex
 	activeConns map[net.Conn]struct{}
-	downtime    bool
-	downtimeMu  sync.RWMutex
+	// impairment simula un enlace imperfecto para los segmentos que llegan
+	impairment impair.Impairment
+	settingsMu sync.Mutex
+	receiveDir string
+	// Política de colisiones, aceptación automática y qué hacer con los
+	// archivos dañados, protegidas por settingsMu
+	collisionPolicy string
+	autoAccept      bool
+	mismatchAction  string
+	promptsMu       sync.Mutex
+	prompts         map[string]pendingPrompt
+	promptSeq       uint64
+	approvalsMu     sync.Mutex
+	approvals       map[string]time.Time
+	// approvalWait reemplaza a approvalTimeout si no es cero (en las pruebas)
+	approvalWait time.Duration
 }
 
+// ToggleDowntime simula una caída del enlace: mientras está activa se pierden
+// todos los segmentos de datos que llegan.
 func (s *Server) ToggleDowntime(active bool) {
-	s.downtimeMu.Lock()
-	defer s.downtimeMu.Unlock()
-	s.downtime = active
+	s.impairment.SetDown(active)
 	if active {
-		log.Println("Server Downtime started")
+		s.logf("Server Downtime started")
 	} else {
-		log.Println("Server Downtime ended")
+		s.logf("Server Downtime ended")
 	}
 }
 
 func (s *Server) IsDowntime() bool {
-	s.downtimeMu.RLock()
-	defer s.downtimeMu.RUnlock()
-	return s.downtime
+	return s.impairment.Down()
+}
+
+// ToggleCorruption activa la simulación de errores de bits: mientras está activa
+// se invierte un bit de cada segmento de datos que llega, antes de verificar su CRC.
+func (s *Server) ToggleCorruption(active bool) {
+	s.impairment.SetCorrupting(active)
+	if active {
+		s.logf("Server bit error simulation started")
+	} else {
+		s.logf("Server bit error simulation ended")
+	}
+}
+
+func (s *Server) IsCorrupting() bool {
+	return s.impairment.Corrupting()
+}
+
+// SetImpairment configura el simulador de red que se aplica a los segmentos que
+// llegan. Se puede cambiar durante una transferencia.
+func (s *Server) SetImpairment(cfg impair.Config) error {
+	if err := s.impairment.Set(cfg); err != nil {
+		return err
+	}
+	s.logf("Server impairment: %+v", cfg)
+	return nil
+}
+
+// GetImpairment devuelve la configuración del simulador de red.
+func (s *Server) GetImpairment() impair.Config {
+	return s.impairment.Config()
 }
 
+// LoadScenario carga un escenario en JSON (ver impair.Scenario) que se reproduce
+// sobre los segmentos que llegan, además de la configuración del simulador.
+func (s *Server) LoadScenario(path string) error {
+	sc, err := impair.LoadScenario(path)
+	if err != nil {
+		return err
+	}
+	s.impairment.SetScenario(sc)
+	s.logf("Server scenario loaded: %s (%d steps, seed %d)", path, len(sc.Steps), sc.Seed)
+	return nil
+}
+
+// ClearScenario deja de reproducir el escenario cargado.
+func (s *Server) ClearScenario() {
+	s.impairment.SetScenario(nil)
+	s.logf("Server scenario cleared")
+}
+
+// NewServer crea un Server que informa sus eventos a sink y sus mensajes a logger,
+// para usarlo fuera de la interfaz gráfica.
+func NewServer(sink events.Sink, logger events.Logger) *Server {
+	return &Server{events: sink, logger: logger}
+}
+
+// StartContext recibe el contexto de Wails. Si el Server no se creó con NewServer,
+// los eventos van a la interfaz.
 func (s *Server) StartContext(ctx context.Context) {
-	s.ctx = ctx
+	if s.events == nil {
+		w := events.NewWails(ctx)
+		s.events, s.logger = w, w
+	}
+}
+
+// emit envía un evento a la interfaz.
+func (s *Server) emit(name string, data ...interface{}) {
+	if s.events != nil {
+		s.events.Emit(name, data...)
+	}
 }
 
-func (s *Server) ReceiveFileHandler() (string, error) {
+// logf registra un mensaje en el log de la aplicación.
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf(format, args...)
+	}
+}
+
+// ListenConfig indica dónde escuchan los servidores. Un puerto 0 deja que el
+// sistema operativo elija uno libre.
+type ListenConfig struct {
+	Address string
+	TCPPort int
+	UDPPort int
+}
+
+// ListenInfo informa los puertos efectivamente abiertos.
+type ListenInfo struct {
+	Address string
+	TCPPort int
+	UDPPort int
+}
+
+func (s *Server) ReceiveFileHandler(cfg ListenConfig) (ListenInfo, error) {
+	if err := validatePort(cfg.TCPPort); err != nil {
+		return ListenInfo{}, err
+	}
+	if err := validatePort(cfg.UDPPort); err != nil {
+		return ListenInfo{}, err
+	}
+
 	s.mu.Lock()
 	if s.isListening {
 		s.mu.Unlock()
-		return "", errors.New("los servidores ya están escuchando")
+		return ListenInfo{}, errors.New("los servidores ya están escuchando")
 	}
 	s.isListening = true
 	s.mu.Unlock()
 
-	tcpListener, err := net.Listen("tcp", ":8080")
+	tcpListener, err := net.Listen("tcp", net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.TCPPort)))
 	if err != nil {
 		s.StopServerHandler()
-		return "", err
+		return ListenInfo{}, listenError("TCP", cfg.TCPPort, err)
 	}
 	s.tcpListener = tcpListener
+
+	// El puerto UDP se abre antes de devolver, así nunca quedamos escuchando a medias
+	udpAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.UDPPort)))
+	if err != nil {
+		s.StopServerHandler()
+		return ListenInfo{}, err
+	}
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		s.StopServerHandler()
+		return ListenInfo{}, listenError("UDP", cfg.UDPPort, err)
+	}
+	s.udpConn = udpConn
+
+	s.connsMu.Lock()
 	s.activeConns = make(map[net.Conn]struct{})
-	log.Println("Servidor TCP escuchando en :8080")
+	s.connsMu.Unlock()
+
+	info := ListenInfo{
+		Address: cfg.Address,
+		TCPPort: tcpListener.Addr().(*net.TCPAddr).Port,
+		UDPPort: udpConn.LocalAddr().(*net.UDPAddr).Port,
+	}
+	s.logf("TCP server listening on %s", tcpListener.Addr())
+	s.logf("UDP server listening on %s", udpConn.LocalAddr())
 	go s.acceptLoop()
+	go s.startUDPServer(udpConn)
+
+	return info, nil
+}
 
-	go s.startUDPServer()
+func validatePort(port int) error {
+	if port < 0 || port > 65535 {
+		return fmt.Errorf("puerto inválido: %d", port)
+	}
+	return nil
+}
 
-	return "Servidores TCP y UDP iniciados en puerto 8080", nil
+// listenError traduce el error de bind a un mensaje claro para la interfaz.
+func listenError(protocol string, port int, err error) error {
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return fmt.Errorf("el puerto %s %d ya está en uso", protocol, port)
+	}
+	return fmt.Errorf("no se pudo escuchar en el puerto %s %d: %w", protocol, port, err)
 }
 
 func (s *Server) StopServerHandler() {
@@ -70,10 +222,11 @@ func (s *Server) StopServerHandler() {
 	defer s.mu.Unlock()
 
 	if s.isListening {
-		log.Println("Deteniendo servidores...")
+		s.logf("Stopping servers...")
 		s.isListening = false
 		if s.tcpListener != nil {
 			s.tcpListener.Close()
+			s.tcpListener = nil
 		}
 
 		s.connsMu.Lock()
@@ -97,13 +250,13 @@ func (s *Server) acceptLoop() {
 			s.mu.Lock()
 			if !s.isListening {
 				s.mu.Unlock()
-				log.Println("Servidor detenido correctamente.")
+				s.logf("Server stopped cleanly.")
 				return // Salimos del bucle y de la goroutine
 			}
 			s.mu.Unlock()
-			log.Printf("Error al aceptar la conexión: %v", err)
+			s.logf("Error accepting connection: %v", err)
 			continue
 		}
-		go s.handleConnection(conn, s.ctx)
+		go s.handleConnection(conn)
 	}
 }
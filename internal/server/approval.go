@@ -0,0 +1,128 @@
+package server
+
+import (
+	"net"
+	"time"
+
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+	"github.com/NeichS/final-redes-wails/internal/shared"
+)
+
+// approvalEvent es el evento con el que se consulta al usuario.
+const approvalEvent = "incoming-transfer-request"
+
+// Respuestas posibles a un evento "incoming-transfer-request".
+const (
+	transferAccept = "accept"
+	transferReject = "reject"
+)
+
+// Tiempo que se espera la respuesta del usuario antes de rechazar la transferencia.
+const approvalTimeout = 60 * time.Second
+
+// Tiempo durante el que un archivo aceptado no se vuelve a consultar, para que
+// una transferencia interrumpida pueda reanudarse sin preguntar de nuevo.
+const approvalTTL = 10 * time.Minute
+
+// declinedMessage es el motivo que se le informa al emisor.
+const declinedMessage = "el receptor rechazó la transferencia"
+
+// SetAutoAccept indica si se aceptan las transferencias sin consultar al usuario.
+// Por defecto se consulta cada una.
+func (s *Server) SetAutoAccept(enabled bool) {
+	s.settingsMu.Lock()
+	s.autoAccept = enabled
+	s.settingsMu.Unlock()
+}
+
+// GetAutoAccept devuelve si las transferencias se aceptan sin consultar.
+func (s *Server) GetAutoAccept() bool {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	return s.autoAccept
+}
+
+// AcceptTransfer responde que sí a un evento "incoming-transfer-request".
+func (s *Server) AcceptTransfer(id string) error {
+	return s.answerPrompt(approvalEvent, id, transferAccept)
+}
+
+// RejectTransfer responde que no a un evento "incoming-transfer-request".
+func (s *Server) RejectTransfer(id string) error {
+	return s.answerPrompt(approvalEvent, id, transferReject)
+}
+
+// approveTransfer decide si se reciben los archivos que ofrece sender. Si hace
+// falta le pregunta al usuario y bloquea hasta que responde o vence el plazo,
+// que cuenta como rechazo.
+func (s *Server) approveTransfer(sender, peerName string, files []protocol.OfferedFile) bool {
+	if s.GetAutoAccept() || s.approved(sender, files) {
+		return true
+	}
+
+	list := make([]map[string]interface{}, 0, len(files))
+	var total uint64
+	for _, f := range files {
+		meta := shared.RemoteMetadata(f.Name, int64(f.Size), "", "")
+		list = append(list, map[string]interface{}{"name": f.Name, "size": f.Size, "mimeType": meta.MIMEType()})
+		total += f.Size
+	}
+	answer, ok := s.prompt(approvalEvent, map[string]interface{}{
+		"sender":    sender,
+		"peerName":  peerName,
+		"files":     list,
+		"totalSize": total,
+	}, s.approvalTimeout())
+	if !ok || answer != transferAccept {
+		return false
+	}
+
+	expires := time.Now().Add(approvalTTL)
+	s.approvalsMu.Lock()
+	if s.approvals == nil {
+		s.approvals = make(map[string]time.Time)
+	}
+	for _, f := range files {
+		s.approvals[approvalKey(sender, f.Name)] = expires
+	}
+	s.approvalsMu.Unlock()
+	return true
+}
+
+func (s *Server) approvalTimeout() time.Duration {
+	if s.approvalWait > 0 {
+		return s.approvalWait
+	}
+	return approvalTimeout
+}
+
+// approved indica si el usuario ya aceptó hace poco todos estos archivos de sender.
+func (s *Server) approved(sender string, files []protocol.OfferedFile) bool {
+	s.approvalsMu.Lock()
+	defer s.approvalsMu.Unlock()
+	now := time.Now()
+	for key, expires := range s.approvals {
+		if now.After(expires) {
+			delete(s.approvals, key)
+		}
+	}
+	for _, f := range files {
+		if _, ok := s.approvals[approvalKey(sender, f.Name)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func approvalKey(sender, name string) string {
+	return sender + "\x00" + name
+}
+
+// hostOf devuelve la IP de una dirección "host:puerto".
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+	"github.com/NeichS/final-redes-wails/internal/shared"
+)
+
+// Políticas para los archivos que llegan con el nombre de uno que ya existe.
+const (
+	CollisionOverwrite     = "overwrite"
+	CollisionRename        = "rename"
+	CollisionSkipIdentical = "skip-identical"
+	CollisionAsk           = "ask"
+)
+
+// collisionEvent es el evento con el que se consulta al usuario.
+const collisionEvent = "file-collision"
+
+// collisionSkip es la respuesta "no recibir" de la política CollisionAsk.
+const collisionSkip = "skip"
+
+// Tiempo que se espera la respuesta del usuario antes de renombrar el archivo.
+const collisionTimeout = 60 * time.Second
+
+// Cantidad máxima de nombres "archivo (n).ext" que se prueban al renombrar.
+const maxRenameAttempts = 10000
+
+// placement es el destino elegido para un archivo entrante. Status es el código
+// que se le informa al emisor; con AckStatusSkipped no hay archivo abierto. file
+// es el archivo temporal (ver partPath) y path el nombre definitivo.
+type placement struct {
+	file   *os.File
+	path   string
+	name   string
+	status byte
+	// existing es el archivo con el que se compara el contenido al terminar la
+	// recepción, cuando la política es CollisionSkipIdentical y el checksum
+	// todavía no se conocía (ver discardIfIdentical).
+	existing string
+}
+
+// SetCollisionPolicy elige qué hacer cuando llega un archivo que ya existe.
+func (s *Server) SetCollisionPolicy(policy string) error {
+	switch policy {
+	case CollisionOverwrite, CollisionRename, CollisionSkipIdentical, CollisionAsk:
+	default:
+		return fmt.Errorf("política de colisión desconocida: %q", policy)
+	}
+	s.settingsMu.Lock()
+	s.collisionPolicy = policy
+	s.settingsMu.Unlock()
+	return nil
+}
+
+// GetCollisionPolicy devuelve la política actual; por defecto se sobrescribe,
+// como hacían las versiones anteriores.
+func (s *Server) GetCollisionPolicy() string {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	if s.collisionPolicy == "" {
+		return CollisionOverwrite
+	}
+	return s.collisionPolicy
+}
+
+// ResolveCollision responde a un evento "file-collision" con "overwrite",
+// "rename" o "skip".
+func (s *Server) ResolveCollision(id string, action string) error {
+	switch action {
+	case CollisionOverwrite, CollisionRename, collisionSkip:
+	default:
+		return fmt.Errorf("acción desconocida: %q", action)
+	}
+	return s.answerPrompt(collisionEvent, id, action)
+}
+
+// placeFile crea el archivo temporal de destino aplicando la política de
+// colisiones. Con la política CollisionAsk bloquea hasta que el usuario responde.
+// algorithm y checksum describen el archivo entrante.
+func (s *Server) placeFile(dir, name, algorithm, checksum string) (placement, error) {
+	path := filepath.Join(dir, name)
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		// Un .part que quedó de una recepción anterior se pisa
+		file, err := os.Create(partPath(path))
+		if err != nil {
+			return placement{}, err
+		}
+		return placement{file: file, path: path, name: name, status: protocol.AckStatusOK}, nil
+	} else if err != nil {
+		return placement{}, err
+	}
+	if checksum == "" && s.GetCollisionPolicy() == CollisionSkipIdentical {
+		// El checksum llega al final de los datos: se recibe con otro nombre y
+		// la copia se descarta después si resulta idéntica
+		place, err := createRenamed(dir, name)
+		place.existing = path
+		return place, err
+	}
+	return applyCollision(dir, name, s.collisionAction(dir, name, algorithm, checksum))
+}
+
+// needsAnswer indica si placeFile va a tener que consultar al usuario.
+func (s *Server) needsAnswer(dir, name string) bool {
+	if s.GetCollisionPolicy() != CollisionAsk {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(dir, name))
+	return err == nil
+}
+
+// collisionAction decide qué hacer con un archivo que ya existe.
+func (s *Server) collisionAction(dir, name, algorithm, checksum string) string {
+	switch policy := s.GetCollisionPolicy(); policy {
+	case CollisionSkipIdentical:
+		if sameChecksum(filepath.Join(dir, name), algorithm, checksum) {
+			return collisionSkip
+		}
+		// Mismo nombre pero otro contenido: conservamos los dos
+		return CollisionRename
+	case CollisionAsk:
+		return s.askCollision(dir, name)
+	default:
+		return policy
+	}
+}
+
+// askCollision le pregunta al usuario qué hacer; si no contesta a tiempo se
+// renombra, que no pierde ningún archivo.
+func (s *Server) askCollision(dir, name string) string {
+	answer, ok := s.prompt(collisionEvent, map[string]interface{}{
+		"fileName": name,
+		"dir":      dir,
+	}, collisionTimeout)
+	if !ok {
+		return CollisionRename
+	}
+	return answer
+}
+
+// applyCollision ejecuta la acción elegida para un archivo que ya existe.
+func applyCollision(dir, name, action string) (placement, error) {
+	switch action {
+	case collisionSkip:
+		return placement{path: filepath.Join(dir, name), name: name, status: protocol.AckStatusSkipped}, nil
+	case CollisionOverwrite:
+		// El archivo existente se reemplaza recién cuando el nuevo se verifica
+		path := filepath.Join(dir, name)
+		file, err := os.Create(partPath(path))
+		if err != nil {
+			return placement{}, err
+		}
+		return placement{file: file, path: path, name: name, status: protocol.AckStatusOverwritten}, nil
+	default:
+		return createRenamed(dir, name)
+	}
+}
+
+// createRenamed crea el archivo temporal de "nombre (n).ext" con el primer n
+// libre. Crear el .part de forma exclusiva reserva el nombre mientras se recibe.
+func createRenamed(dir, name string) (placement, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 1; n <= maxRenameAttempts; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, n, ext)
+		path := filepath.Join(dir, candidate)
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			continue
+		}
+		file, err := os.OpenFile(partPath(path), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return placement{file: file, path: path, name: candidate, status: protocol.AckStatusRenamed}, nil
+		}
+		if !os.IsExist(err) {
+			return placement{}, err
+		}
+	}
+	return placement{}, fmt.Errorf("no hay un nombre libre para %s", name)
+}
+
+// discardIfIdentical borra el archivo recibido, todavía sin verificar, si tiene
+// el mismo contenido que el que ya existía con ese nombre. Devuelve si lo borró.
+func (s *Server) discardIfIdentical(p placement, algorithm, checksum string) bool {
+	if p.existing == "" || !sameChecksum(p.existing, algorithm, checksum) {
+		return false
+	}
+	if err := os.Remove(partPath(p.path)); err != nil {
+		s.logf("Error removing duplicate %s: %v", partPath(p.path), err)
+		return false
+	}
+	return true
+}
+
+// sameChecksum indica si el archivo en path tiene el checksum indicado,
+// calculado con algorithm.
+func sameChecksum(path, algorithm, checksum string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	calculated, err := shared.Checksum(file, algorithm)
+	return err == nil && calculated == checksum
+}
+
+// collisionMessage describe para el usuario lo que pasó con un archivo repetido.
+func collisionMessage(p placement, original string) string {
+	switch p.status {
+	case protocol.AckStatusSkipped:
+		return fmt.Sprintf("%s ya existe, no se recibió de nuevo.", original)
+	case protocol.AckStatusRenamed:
+		return fmt.Sprintf("%s ya existía, se guarda como %s.", original, p.name)
+	case protocol.AckStatusOverwritten:
+		return fmt.Sprintf("%s reemplaza al archivo existente.", original)
+	}
+	return ""
+}
+
+// collisionLog es el equivalente de collisionMessage para el log.
+func collisionLog(p placement, original string) string {
+	switch p.status {
+	case protocol.AckStatusSkipped:
+		return fmt.Sprintf("%s already exists, skipped", original)
+	case protocol.AckStatusRenamed:
+		return fmt.Sprintf("%s already exists, saving as %s", original, p.name)
+	case protocol.AckStatusOverwritten:
+		return fmt.Sprintf("%s overwrites the existing file", original)
+	}
+	return ""
+}
+
+// duplicateMessage describe un archivo descartado por discardIfIdentical.
+func duplicateMessage(original string) string {
+	return fmt.Sprintf("%s ya existía con el mismo contenido, se descartó la copia.", original)
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NeichS/final-redes-wails/internal/events"
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+	"github.com/NeichS/final-redes-wails/internal/shared"
+)
+
+const existingContent = "contenido original"
+
+// collisionDir crea una carpeta de descarga donde ya existe informe.txt.
+func collisionDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "informe.txt"), []byte(existingContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func newPolicyServer(t *testing.T, policy string) *Server {
+	t.Helper()
+	s := NewServer(events.Discard, events.Discard)
+	if err := s.SetCollisionPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func checksumOf(t *testing.T, content string) string {
+	t.Helper()
+	sum, err := shared.Checksum(strings.NewReader(content), "md5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sum
+}
+
+// checkPlacement comprueba el destino elegido y que el archivo existente siga
+// intacto: ninguna política lo toca antes de verificar el archivo nuevo.
+func checkPlacement(t *testing.T, dir string, place placement, status byte, name string) {
+	t.Helper()
+	if place.file != nil {
+		t.Cleanup(func() { place.file.Close() })
+	}
+	if place.status != status || place.name != name {
+		t.Errorf("estado %d, nombre %q; se esperaban %d y %q", place.status, place.name, status, name)
+	}
+	if place.path != filepath.Join(dir, name) {
+		t.Errorf("ruta %q, se esperaba %q", place.path, filepath.Join(dir, name))
+	}
+	if status != protocol.AckStatusSkipped {
+		if place.file == nil || place.file.Name() != partPath(place.path) {
+			t.Errorf("no se abrió el archivo temporal %s", partPath(place.path))
+		}
+	} else if place.file != nil {
+		t.Errorf("un archivo omitido abrió %s", place.file.Name())
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "informe.txt")); err != nil || string(got) != existingContent {
+		t.Errorf("el archivo existente cambió: %q, %v", got, err)
+	}
+}
+
+func TestCollisionWithoutExistingFile(t *testing.T) {
+	dir := collisionDir(t)
+	place, err := newPolicyServer(t, CollisionRename).placeFile(dir, "nuevo.txt", "md5", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPlacement(t, dir, place, protocol.AckStatusOK, "nuevo.txt")
+}
+
+func TestCollisionOverwrite(t *testing.T) {
+	dir := collisionDir(t)
+	place, err := newPolicyServer(t, CollisionOverwrite).placeFile(dir, "informe.txt", "md5", checksumOf(t, "otro"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPlacement(t, dir, place, protocol.AckStatusOverwritten, "informe.txt")
+}
+
+func TestCollisionRename(t *testing.T) {
+	dir := collisionDir(t)
+	s := newPolicyServer(t, CollisionRename)
+	// Cada archivo repetido toma el siguiente número libre, mientras se recibe
+	// el anterior o después de terminado
+	for _, want := range []string{"informe (1).txt", "informe (2).txt"} {
+		place, err := s.placeFile(dir, "informe.txt", "md5", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPlacement(t, dir, place, protocol.AckStatusRenamed, want)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "informe (3).txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	place, err := s.placeFile(dir, "informe.txt", "md5", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPlacement(t, dir, place, protocol.AckStatusRenamed, "informe (4).txt")
+
+	// Sin extensión el número va al final
+	os.WriteFile(filepath.Join(dir, "LEAME"), nil, 0644)
+	place, err = s.placeFile(dir, "LEAME", "md5", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPlacement(t, dir, place, protocol.AckStatusRenamed, "LEAME (1)")
+}
+
+func TestCollisionSkipIdentical(t *testing.T) {
+	dir := collisionDir(t)
+	s := newPolicyServer(t, CollisionSkipIdentical)
+
+	place, err := s.placeFile(dir, "informe.txt", "md5", checksumOf(t, existingContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPlacement(t, dir, place, protocol.AckStatusSkipped, "informe.txt")
+
+	// Otro contenido con el mismo nombre: se conservan los dos
+	place, err = s.placeFile(dir, "informe.txt", "md5", checksumOf(t, "otro"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPlacement(t, dir, place, protocol.AckStatusRenamed, "informe (1).txt")
+}
+
+// Con el checksum en el trailer el archivo se recibe con otro nombre y se
+// compara con el existente al terminar.
+func TestCollisionSkipIdenticalAfterReception(t *testing.T) {
+	dir := collisionDir(t)
+	s := newPolicyServer(t, CollisionSkipIdentical)
+	for _, tc := range []struct {
+		content string
+		discard bool
+	}{
+		{existingContent, true},
+		{"otro contenido", false},
+	} {
+		place, err := s.placeFile(dir, "informe.txt", "md5", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPlacement(t, dir, place, protocol.AckStatusRenamed, "informe (1).txt")
+		if place.existing != filepath.Join(dir, "informe.txt") {
+			t.Fatalf("existing = %q, se esperaba el archivo existente", place.existing)
+		}
+		if _, err := place.file.WriteString(tc.content); err != nil {
+			t.Fatal(err)
+		}
+		place.file.Close()
+
+		if got := s.discardIfIdentical(place, "md5", checksumOf(t, tc.content)); got != tc.discard {
+			t.Errorf("%q: discardIfIdentical = %v, se esperaba %v", tc.content, got, tc.discard)
+		}
+		_, err = os.Stat(partPath(place.path))
+		if kept := err == nil; kept == tc.discard {
+			t.Errorf("%q: el archivo temporal se conservó = %v", tc.content, kept)
+		}
+		os.Remove(partPath(place.path))
+	}
+}
+
+func TestSetCollisionPolicyRejectsUnknown(t *testing.T) {
+	s := NewServer(events.Discard, events.Discard)
+	if err := s.SetCollisionPolicy("append"); err == nil {
+		t.Error("SetCollisionPolicy aceptó una política desconocida")
+	}
+	if got := s.GetCollisionPolicy(); got != CollisionOverwrite {
+		t.Errorf("política %q, se esperaba %q por defecto", got, CollisionOverwrite)
+	}
+}
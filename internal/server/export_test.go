@@ -0,0 +1,9 @@
+package server
+
+import "time"
+
+// SetApprovalTimeout acorta la espera de la respuesta del usuario, para probar
+// qué pasa cuando vence sin esperar un minuto.
+func SetApprovalTimeout(s *Server, d time.Duration) {
+	s.approvalWait = d
+}
@@ -0,0 +1,823 @@
+package server_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	client "github.com/NeichS/final-redes-wails/internal/client"
+	"github.com/NeichS/final-redes-wails/internal/congestion"
+	"github.com/NeichS/final-redes-wails/internal/events"
+	"github.com/NeichS/final-redes-wails/internal/impair"
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+	sv "github.com/NeichS/final-redes-wails/internal/server"
+	"github.com/NeichS/final-redes-wails/internal/stats"
+)
+
+// Tiempo máximo que se espera un evento después de terminar el envío.
+const eventTimeout = 10 * time.Second
+
+type testFile struct {
+	name string
+	size int
+}
+
+// testFiles son los archivos que se envían en cada prueba: vacío, de exactamente
+// un segmento, de varios MB y con un nombre con caracteres no ASCII.
+var testFiles = []testFile{
+	{"vacío.txt", 0},
+	{"segmento.bin", protocol.SegmentSize},
+	{"grande.bin", 3 << 20},
+	{"informe año ñandú ✓.pdf", 5000},
+}
+
+func TestLoopbackTransfers(t *testing.T) {
+	cases := []struct {
+		name string
+		info client.FileSenderInfo
+	}{
+		{"TCP Stop-and-Wait", client.FileSenderInfo{TCP: true}},
+		{"TCP Go-Back-N", client.FileSenderInfo{TCP: true, WindowSize: 8}},
+		{"TCP Selective Repeat", client.FileSenderInfo{TCP: true, WindowSize: 8, SelectiveRepeat: true}},
+		{"TCP SHA-256", client.FileSenderInfo{TCP: true, WindowSize: 4, HashAlgorithm: "sha256"}},
+		// El modo best-effort puede perder datagramas aun en loopback, así que
+		// solo se prueba el UDP fiable
+		{"UDP fiable", client.FileSenderInfo{ReliableUDP: true}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			transfer(t, tc.info, testFiles, link{}, link{})
+		})
+	}
+}
+
+// Con el simulador de red activo en un extremo los archivos tienen que llegar
+// igual, gracias a las retransmisiones. Se usan archivos chicos porque cada
+// segmento perdido cuesta un timeout.
+func TestLoopbackImpairedTransfers(t *testing.T) {
+	files := []testFile{{"chico.bin", 3000}, {"mediano.bin", 64 << 10}}
+	lossy := link{cfg: impair.Config{LossPercent: 3, DuplicatePercent: 2, ReorderPercent: 2, CorruptPercent: 3, DelayMs: 1, JitterMs: 2}}
+	cases := []struct {
+		name           string
+		info           client.FileSenderInfo
+		sender, server link
+	}{
+		{"TCP Selective Repeat, emisor", client.FileSenderInfo{TCP: true, WindowSize: 8, SelectiveRepeat: true}, lossy, link{}},
+		// En Go-Back-N cada segmento desordenado descarta el resto de la ventana
+		// hasta el timeout, y esas retransmisiones no sirven para medir el RTT, así
+		// que acá se prueban sobre todo los errores de bits
+		{"TCP Go-Back-N, receptor", client.FileSenderInfo{TCP: true, WindowSize: 8}, link{}, link{cfg: impair.Config{LossPercent: 1, DuplicatePercent: 2, CorruptPercent: 5}}},
+		{"UDP fiable, emisor", client.FileSenderInfo{ReliableUDP: true}, lossy, link{}},
+		{"UDP fiable, receptor", client.FileSenderInfo{ReliableUDP: true}, link{}, lossy},
+		{"TCP con ancho de banda limitado", client.FileSenderInfo{TCP: true, WindowSize: 4}, link{cfg: impair.Config{BandwidthKbps: 8000, DelayMs: 5}}, link{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			transfer(t, tc.info, files, tc.sender, tc.server)
+		})
+	}
+}
+
+// link son las imperfecciones de un extremo: la configuración del simulador y,
+// opcionalmente, un escenario en JSON.
+type link struct {
+	cfg      impair.Config
+	scenario string
+}
+
+// impairable es lo que tienen en común Server y Client para configurar el simulador.
+type impairable interface {
+	SetImpairment(impair.Config) error
+	LoadScenario(string) error
+}
+
+func (l link) apply(t *testing.T, end impairable) {
+	t.Helper()
+	if err := end.SetImpairment(l.cfg); err != nil {
+		t.Fatal(err)
+	}
+	if l.scenario == "" {
+		return
+	}
+	path := filepath.Join(t.TempDir(), "escenario.json")
+	if err := os.WriteFile(path, []byte(l.scenario), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := end.LoadScenario(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Un escenario con semilla hace que las retransmisiones se repitan igual en cada
+// ejecución: con Stop-and-Wait, dañar uno de cada tres segmentos enviados
+// (retransmisiones incluidas) en un archivo de 10 segmentos daña los envíos 3,
+// 6, 9 y 12, y el receptor cuenta exactamente 4 retransmisiones.
+func TestLoopbackScenario(t *testing.T) {
+	files := []testFile{{"diez.bin", 10 * protocol.SegmentSize}}
+	sender := link{scenario: `{"seed": 1, "steps": [{"every": 3, "corrupt": true}]}`}
+	for run := 1; run <= 2; run++ {
+		server, senderEvents := transfer(t, client.FileSenderInfo{TCP: true}, files, sender, link{})
+		progress := server.all("receiving-file-progress")
+		last := progress[len(progress)-1].(map[string]interface{})
+		if arqs := last["arqs"]; arqs != uint32(4) {
+			t.Errorf("ejecución %d: el receptor contó %v retransmisiones, se esperaban 4", run, arqs)
+		}
+		// Las estadísticas de cada lado ven los mismos segmentos dañados
+		received := server.wait(t, "receiving-file-summary", nil).(stats.Snapshot)
+		sent := senderEvents.wait(t, "sending-file-summary", nil).(stats.Snapshot)
+		if received.Corrupt != 4 || sent.Retransmissions != 4 {
+			t.Errorf("ejecución %d: el receptor contó %d segmentos dañados y el emisor %d retransmisiones, se esperaban 4", run, received.Corrupt, sent.Retransmissions)
+		}
+		if !sent.Done || sent.Bytes != uint64(files[0].size) || sent.RTTAvgMs <= 0 {
+			t.Errorf("ejecución %d: resumen del emisor %+v", run, sent)
+		}
+	}
+
+	// Las pérdidas también se repiten: el UDP fiable tiene que recuperar un
+	// tramo perdido y segmentos dañados en el receptor
+	server := link{scenario: `{"seed": 7, "steps": [
+		{"fromSegment": 20, "toSegment": 30, "drop": true},
+		{"every": 25, "corrupt": true},
+		{"config": {"lossPercent": 2}}
+	]}`}
+	_, senderEvents := transfer(t, client.FileSenderInfo{ReliableUDP: true}, []testFile{{"mediano.bin", 64 << 10}}, link{}, server)
+	// Los ACKs perdidos no impiden contar como entregado todo el archivo
+	if sent := senderEvents.wait(t, "sending-file-summary", nil).(stats.Snapshot); sent.Bytes != 64<<10 || sent.Retransmissions == 0 {
+		t.Errorf("resumen del emisor UDP %+v, se esperaban 65536 bytes y retransmisiones", sent)
+	}
+}
+
+// Cada algoritmo de control de congestión tiene que completar el envío sobre un
+// enlace con pérdidas, y los que tienen ventana la informan en el progreso.
+func TestLoopbackCongestionControl(t *testing.T) {
+	files := []testFile{{"mediano.bin", 256 << 10}}
+	lossy := link{cfg: impair.Config{LossPercent: 2, DelayMs: 2, JitterMs: 1}}
+	for _, algorithm := range congestion.Algorithms() {
+		cases := []struct {
+			name string
+			info client.FileSenderInfo
+		}{
+			{"UDP fiable", client.FileSenderInfo{ReliableUDP: true}},
+			{"TCP Selective Repeat", client.FileSenderInfo{TCP: true, WindowSize: 64, SelectiveRepeat: true}},
+		}
+		for _, tc := range cases {
+			t.Run(algorithm+", "+tc.name, func(t *testing.T) {
+				tc.info.CongestionControl = algorithm
+				_, sender := transfer(t, tc.info, files, lossy, link{})
+				progress := sender.all("sending-file-progress")
+				last := progress[len(progress)-1].(map[string]interface{})
+				cwnd, ok := last["cwnd"].(int)
+				switch {
+				case algorithm == congestion.Fixed && !tc.info.TCP:
+					if ok {
+						t.Errorf("sin ventana de congestión el progreso informa cwnd = %d", cwnd)
+					}
+				case !ok || cwnd < 1 || cwnd > 64:
+					t.Errorf("el progreso informa cwnd = %v, se esperaba una ventana entre 1 y 64", last["cwnd"])
+				}
+			})
+		}
+	}
+}
+
+// Un segmento que llega dañado cuenta como pérdida también en TCP: la ventana
+// de Reno se achica aunque no venza ningún temporizador.
+func TestLoopbackTCPCorruptionReducesWindow(t *testing.T) {
+	files := []testFile{{"dañado.bin", 200 * protocol.SegmentSize}}
+	sender := link{scenario: `{"seed": 1, "steps": [{"every": 40, "corrupt": true}]}`}
+	info := client.FileSenderInfo{TCP: true, WindowSize: 64, SelectiveRepeat: true, CongestionControl: congestion.Reno}
+	_, senderEvents := transfer(t, info, files, sender, link{})
+
+	reduced := false
+	previous := 0
+	for _, p := range senderEvents.all("sending-file-progress") {
+		cwnd := p.(map[string]interface{})["cwnd"].(int)
+		if cwnd < previous {
+			reduced = true
+		}
+		previous = cwnd
+	}
+	summary := senderEvents.wait(t, "sending-file-summary", nil).(stats.Snapshot)
+	if !reduced && summary.Timeouts == 0 {
+		t.Error("la ventana de congestión no se redujo con los segmentos dañados")
+	}
+}
+
+// Sin aceptación automática cada envío se le consulta al receptor: si lo
+// rechaza o no contesta a tiempo, el emisor recibe RejectDeclined y no se guarda
+// nada.
+func TestLoopbackApproval(t *testing.T) {
+	paths := writeTestFiles(t, []testFile{{"oferta.bin", 3 * protocol.SegmentSize}})
+	offered := []protocol.OfferedFile{{Name: "oferta.bin", Size: 3 * protocol.SegmentSize}}
+
+	// promptID espera la consulta al usuario y devuelve su id.
+	promptID := func(t *testing.T, server *recorder) string {
+		t.Helper()
+		data := server.wait(t, "incoming-transfer-request", nil).(map[string]interface{})
+		return data["id"].(string)
+	}
+	// send envía en segundo plano, porque SendFileHandler espera la respuesta
+	send := func(fi client.FileSenderInfo, info sv.ListenInfo) (*recorder, chan error) {
+		c, sender := newClient(t)
+		fi.Address, fi.Paths = "127.0.0.1", paths
+		fi.Port = strconv.Itoa(info.UDPPort)
+		if fi.TCP {
+			fi.Port = strconv.Itoa(info.TCPPort)
+		}
+		done := make(chan error, 1)
+		go func() {
+			_, err := c.SendFileHandler(fi)
+			done <- err
+		}()
+		return sender, done
+	}
+	checkEmpty := func(t *testing.T, dir string) {
+		t.Helper()
+		if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+			t.Errorf("la carpeta de descarga tiene %d entradas, se esperaba vacía", len(entries))
+		}
+	}
+
+	t.Run("aceptado", func(t *testing.T) {
+		srv, info, server, dir := listen(t, link{}, false)
+		sender, done := send(client.FileSenderInfo{TCP: true}, info)
+		if err := srv.AcceptTransfer(promptID(t, server)); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("SendFileHandler: %v", err)
+		}
+		results := sender.wait(t, "transfer-results", nil).([]client.FileResult)
+		if len(results) != 1 || results[0].Status != client.FileVerified {
+			t.Errorf("resultados %+v, se esperaba oferta.bin verificado", results)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "oferta.bin")); err != nil {
+			t.Errorf("el archivo aceptado no se guardó: %v", err)
+		}
+	})
+
+	t.Run("rechazado por TCP", func(t *testing.T) {
+		srv, info, server, dir := listen(t, link{}, false)
+		reply := make(chan protocol.Frame, 1)
+		go func() { reply <- rawOffer(info.TCPPort, offered) }()
+		if err := srv.RejectTransfer(promptID(t, server)); err != nil {
+			t.Fatal(err)
+		}
+		checkDeclined(t, <-reply)
+		checkEmpty(t, dir)
+
+		// El cliente lo informa y no envía nada
+		srv, info, server, dir = listen(t, link{}, false)
+		sender, done := send(client.FileSenderInfo{TCP: true}, info)
+		if err := srv.RejectTransfer(promptID(t, server)); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-done; err == nil {
+			t.Error("SendFileHandler no devolvió error después del rechazo")
+		}
+		sender.wait(t, "client-error", func(msg string) bool { return strings.Contains(msg, "rechazó la transferencia") })
+		checkEmpty(t, dir)
+	})
+
+	t.Run("rechazado por UDP", func(t *testing.T) {
+		srv, info, server, dir := listen(t, link{}, false)
+		sender, done := send(client.FileSenderInfo{ReliableUDP: true}, info)
+		if err := srv.RejectTransfer(promptID(t, server)); err != nil {
+			t.Fatal(err)
+		}
+		<-done
+		// El cliente describe así solo un UDPReject con RejectDeclined
+		sender.wait(t, "client-error", func(msg string) bool { return strings.Contains(msg, "el receptor rechazó el archivo") })
+		checkEmpty(t, dir)
+	})
+
+	t.Run("sin respuesta", func(t *testing.T) {
+		srv, info, server, dir := listen(t, link{}, false)
+		sv.SetApprovalTimeout(srv, 200*time.Millisecond)
+		reply := rawOffer(info.TCPPort, offered)
+		checkDeclined(t, reply)
+		id := promptID(t, server)
+		server.wait(t, "prompt-expired", func(expired string) bool { return expired == id })
+		if err := srv.AcceptTransfer(id); err == nil {
+			t.Error("se pudo aceptar una consulta vencida")
+		}
+		checkEmpty(t, dir)
+	})
+}
+
+// Un archivo que no coincide con el checksum del header va a cuarentena o se
+// borra, según la configuración, y nunca aparece con su nombre definitivo.
+func TestLoopbackChecksumMismatch(t *testing.T) {
+	data := bytes.Repeat([]byte("contenido que no es el anunciado "), 100)
+	for _, tc := range []struct {
+		action      string
+		quarantined bool
+	}{
+		{sv.MismatchQuarantine, true},
+		{sv.MismatchDelete, false},
+	} {
+		t.Run(tc.action, func(t *testing.T) {
+			srv, info, server, dir := listen(t, link{}, true)
+			if err := srv.SetMismatchAction(tc.action); err != nil {
+				t.Fatal(err)
+			}
+			header := &protocol.Header{
+				Name:    "dañado.bin",
+				Reps:    protocol.Segments(uint64(len(data)), protocol.SegmentSize),
+				Size:    uint64(len(data)),
+				HasSize: true,
+				// El MD5 de otro contenido
+				Checksum: strings.Repeat("0", 32),
+				ARQMode:  protocol.ARQStopAndWait,
+				Window:   1,
+			}
+			verify, ok := rawSend(t, info.TCPPort, header, data).(*protocol.Verify)
+			if !ok || verify.Result != protocol.VerifyChecksumMismatch {
+				t.Fatalf("el receptor respondió %+v, se esperaba VerifyChecksumMismatch", verify)
+			}
+			server.wait(t, "server-error", func(msg string) bool { return strings.Contains(msg, "Error de checksum en dañado.bin") })
+
+			entries, _ := os.ReadDir(dir)
+			for _, e := range entries {
+				if e.Name() != "quarantine" {
+					t.Errorf("quedó %s en la carpeta de descarga", e.Name())
+				}
+			}
+			got, err := os.ReadFile(filepath.Join(dir, "quarantine", "dañado.bin"))
+			if tc.quarantined && (err != nil || !bytes.Equal(got, data)) {
+				t.Errorf("el archivo no quedó intacto en cuarentena: %v", err)
+			}
+			if !tc.quarantined && err == nil {
+				t.Error("el archivo dañado se movió a cuarentena en lugar de borrarse")
+			}
+		})
+	}
+}
+
+// Un inicio UDP que declara un archivo enorme se rechaza antes de reservar nada.
+func TestLoopbackUDPRejectsHugeFile(t *testing.T) {
+	_, info, _, dir := listen(t, link{}, true)
+	conn, err := net.Dial("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(info.UDPPort)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	size := uint64(4) << 40
+	start, err := (&protocol.UDPStart{
+		TotalSegments: protocol.Segments(size, protocol.UDPSegmentSize),
+		Size:          size,
+		Mode:          protocol.UDPReliable,
+		Name:          "enorme.bin",
+	}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(start); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(eventTimeout))
+	reply := make([]byte, protocol.MaxDatagramSize)
+	n, err := conn.Read(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := protocol.ParsePacket(reply[:n])
+	if reject, ok := packet.(*protocol.UDPReject); err != nil || !ok || reject.Reason != protocol.RejectInvalidHeader {
+		t.Fatalf("el receptor respondió %+v (%v), se esperaba un UDPReject con RejectInvalidHeader", packet, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("la carpeta de descarga tiene %d entradas, se esperaba vacía", len(entries))
+	}
+}
+
+// Si no se puede crear el archivo, el emisor recibe el motivo en lugar de un
+// corte de la conexión.
+func TestLoopbackStorageFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		info client.FileSenderInfo
+	}{
+		{"TCP", client.FileSenderInfo{TCP: true}},
+		{"UDP", client.FileSenderInfo{ReliableUDP: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			paths := writeTestFiles(t, []testFile{{"sin lugar.bin", 2 * protocol.SegmentSize}})
+			_, info, server, dir := listen(t, link{}, true)
+			// La carpeta de descarga pasa a ser un archivo: no se puede crear nada
+			if err := os.RemoveAll(dir); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dir, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			c, sender := newClient(t)
+			fi := tc.info
+			fi.Address, fi.Paths = "127.0.0.1", paths
+			fi.Port = strconv.Itoa(info.UDPPort)
+			if fi.TCP {
+				fi.Port = strconv.Itoa(info.TCPPort)
+			}
+			c.SendFileHandler(fi)
+
+			server.wait(t, "server-error", func(msg string) bool { return strings.Contains(msg, "No se pudo crear") })
+			if fi.TCP {
+				results := sender.wait(t, "transfer-results", nil).([]client.FileResult)
+				if len(results) != 1 || results[0].Status != client.FileRejected {
+					t.Errorf("resultados %+v, se esperaba el archivo rechazado", results)
+				}
+			} else {
+				sender.wait(t, "client-error", func(msg string) bool { return strings.Contains(msg, "el servidor rechazó el archivo") })
+			}
+		})
+	}
+}
+
+// Los mensajes de log de los dos extremos van al logger que recibieron, tanto
+// los de la transferencia como los del handshake y la verificación.
+func TestLoopbackLogger(t *testing.T) {
+	cases := []struct {
+		name           string
+		info           client.FileSenderInfo
+		server, sender []string
+	}{
+		{"TCP", client.FileSenderInfo{TCP: true}, []string{"Receiving file: log.bin", "Checksums match!"}, []string{"Handshake with", "Sending log.bin"}},
+		{"UDP", client.FileSenderInfo{ReliableUDP: true}, []string{"UDP: receiving 'log.bin'", "UDP: checksums match!"}, []string{"Reliable send of 'log.bin' completed"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			paths := writeTestFiles(t, []testFile{{"log.bin", 3 * protocol.SegmentSize}})
+			sink, serverLog := events.NewChannel(64), newLogCapture(t)
+			s := sv.NewServer(sink, serverLog)
+			dir := t.TempDir()
+			if err := s.SetReceiveDir(dir); err != nil {
+				t.Fatal(err)
+			}
+			s.SetAutoAccept(true)
+			info, err := s.ReceiveFileHandler(sv.ListenConfig{Address: "127.0.0.1"})
+			if err != nil {
+				t.Fatalf("ReceiveFileHandler: %v", err)
+			}
+			t.Cleanup(s.StopServerHandler)
+			server := record(sink)
+
+			senderLog := newLogCapture(t)
+			c := client.NewClient(events.Discard, senderLog)
+			fi := tc.info
+			fi.Address, fi.Paths = "127.0.0.1", paths
+			fi.Port = strconv.Itoa(info.UDPPort)
+			if fi.TCP {
+				fi.Port = strconv.Itoa(info.TCPPort)
+			}
+			if _, err := c.SendFileHandler(fi); err != nil {
+				t.Fatalf("SendFileHandler: %v", err)
+			}
+			server.wait(t, "reception-finished", func(msg string) bool { return strings.Contains(msg, "verificado") })
+
+			serverLog.check(t, "receptor", tc.server)
+			senderLog.check(t, "emisor", tc.sender)
+		})
+	}
+}
+
+// rawSend hace de emisor mínimo con Stop-and-Wait: negocia la sesión sin
+// checksum al final ni CRC por segmento, envía header y data, y devuelve la
+// respuesta del receptor después del último segmento.
+func rawSend(t *testing.T, port int, header *protocol.Header, data []byte) protocol.Frame {
+	t.Helper()
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(eventTimeout))
+	exchange := func(frame interface{ MarshalBinary() ([]byte, error) }) protocol.Frame {
+		t.Helper()
+		b, err := frame.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		reply, err := protocol.ReadFrame(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+	exchange(&protocol.Hello{Type: protocol.TypeHello, Version: protocol.CurrentVersion, Features: protocol.FeatureFileSize | protocol.FeatureVerify, MaxWindow: 1})
+	if ack, ok := exchange(header).(*protocol.Ack); !ok || ack.Status != protocol.AckStatusOK {
+		t.Fatalf("el receptor no aceptó el header: %+v", ack)
+	}
+	for seq := uint32(0); seq < header.Reps; seq++ {
+		end := min(int(seq+1)*protocol.SegmentSize, len(data))
+		exchange(&protocol.Segment{Seq: seq, Data: data[int(seq)*protocol.SegmentSize : end]})
+	}
+	reply, err := protocol.ReadFrame(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+// rawOffer hace de emisor mínimo: negocia la sesión por TCP, ofrece files y
+// devuelve la respuesta del receptor (o nil si no llegó ninguna).
+func rawOffer(port int, files []protocol.OfferedFile) protocol.Frame {
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(eventTimeout))
+	hello := &protocol.Hello{Type: protocol.TypeHello, Version: protocol.CurrentVersion, Features: protocol.SupportedFeatures, MaxWindow: 1}
+	for _, frame := range []interface{ MarshalBinary() ([]byte, error) }{hello, &protocol.Offer{Files: files}} {
+		b, err := frame.MarshalBinary()
+		if err != nil {
+			return nil
+		}
+		if _, err := conn.Write(b); err != nil {
+			return nil
+		}
+		reply, err := protocol.ReadFrame(conn)
+		if err != nil {
+			return nil
+		}
+		if _, ok := reply.(*protocol.Hello); !ok {
+			return reply
+		}
+	}
+	return nil
+}
+
+func checkDeclined(t *testing.T, reply protocol.Frame) {
+	t.Helper()
+	reject, ok := reply.(*protocol.Reject)
+	if !ok {
+		t.Fatalf("el receptor respondió %T a la oferta, se esperaba un Reject", reply)
+	}
+	if reject.Reason != protocol.RejectDeclined || reject.Message == "" {
+		t.Errorf("Reject{%d, %q}, se esperaba RejectDeclined (%d) con un motivo", reject.Reason, reject.Message, protocol.RejectDeclined)
+	}
+}
+
+// transfer envía files con fi entre un Server y un Client nuevos, con las
+// imperfecciones indicadas en cada extremo, y comprueba que lleguen intactos y
+// verificados. Devuelve los eventos del servidor y los del cliente.
+func transfer(t *testing.T, fi client.FileSenderInfo, files []testFile, senderLink, serverLink link) (*recorder, *recorder) {
+	t.Helper()
+	paths := writeTestFiles(t, files)
+	ports, server, dir := startServer(t, serverLink)
+	c, sender := newClient(t)
+	senderLink.apply(t, c)
+
+	fi.Address = "127.0.0.1"
+	fi.Port = strconv.Itoa(ports.TCPPort)
+	if !fi.TCP {
+		fi.Port = strconv.Itoa(ports.UDPPort)
+	}
+	fi.Paths = paths
+	if _, err := c.SendFileHandler(fi); err != nil {
+		t.Fatalf("SendFileHandler: %v", err)
+	}
+
+	for _, path := range paths {
+		name := filepath.Base(path)
+		server.wait(t, "reception-finished", func(msg string) bool {
+			return strings.Contains(msg, name) && strings.Contains(msg, "verificado")
+		})
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("archivo recibido: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: se recibieron %d bytes distintos de los %d enviados", name, len(got), len(want))
+		}
+		checkAttributes(t, path, filepath.Join(dir, name))
+	}
+	// Un archivo solo se da por recibido una vez verificado
+	for _, msg := range server.all("reception-finished") {
+		if !strings.Contains(msg.(string), "verificado") {
+			t.Errorf("reception-finished antes de verificar: %q", msg)
+		}
+	}
+
+	if fi.TCP {
+		results := sender.wait(t, "transfer-results", nil).([]client.FileResult)
+		if len(results) != len(paths) {
+			t.Fatalf("transfer-results tiene %d archivos, se esperaban %d", len(results), len(paths))
+		}
+		for _, r := range results {
+			if r.Status != client.FileVerified {
+				t.Errorf("%s: estado %q, se esperaba %q", r.Name, r.Status, client.FileVerified)
+			}
+		}
+	}
+
+	for _, name := range []string{"server-error", "client-error"} {
+		for _, r := range []*recorder{server, sender} {
+			if msgs := r.all(name); len(msgs) > 0 {
+				t.Errorf("eventos %s inesperados: %v", name, msgs)
+			}
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != len(paths) {
+		t.Errorf("la carpeta de descarga tiene %d entradas, se esperaban %d (¿quedaron archivos .part?)", len(entries), len(paths))
+	}
+	return server, sender
+}
+
+// checkAttributes comprueba que el archivo recibido conserve la fecha de
+// modificación y los permisos del enviado.
+func checkAttributes(t *testing.T, sent, received string) {
+	t.Helper()
+	want, err := os.Stat(sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.Stat(received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.ModTime().Equal(want.ModTime()) {
+		t.Errorf("%s: fecha %v, se esperaba %v", got.Name(), got.ModTime(), want.ModTime())
+	}
+	if got.Mode().Perm() != want.Mode().Perm() {
+		t.Errorf("%s: permisos %v, se esperaban %v", got.Name(), got.Mode().Perm(), want.Mode().Perm())
+	}
+}
+
+// testModTime es la fecha de modificación de los archivos enviados, distinta de
+// la que tendría un archivo recién escrito.
+var testModTime = time.Date(2021, 3, 14, 15, 9, 26, 535897932, time.UTC)
+
+// writeTestFiles crea los archivos files con contenido pseudoaleatorio, con
+// permisos 0640 y fecha testModTime.
+func writeTestFiles(t *testing.T, files []testFile) []string {
+	t.Helper()
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(1))
+	var paths []string
+	for _, f := range files {
+		data := make([]byte, f.size)
+		rng.Read(data)
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, data, 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, testModTime, testModTime); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// startServer escucha en puertos libres de loopback, con las imperfecciones de
+// l, y acepta todo sin preguntar. Devuelve los puertos, los eventos del
+// servidor y la carpeta de descarga.
+func startServer(t *testing.T, l link) (sv.ListenInfo, *recorder, string) {
+	t.Helper()
+	_, info, server, dir := listen(t, l, true)
+	return info, server, dir
+}
+
+// listen es como startServer, pero devuelve también el Server y, si autoAccept
+// es false, cada envío se le consulta al usuario.
+func listen(t *testing.T, l link, autoAccept bool) (*sv.Server, sv.ListenInfo, *recorder, string) {
+	t.Helper()
+	sink := events.NewChannel(64)
+	s := sv.NewServer(sink, newLogCapture(t))
+	l.apply(t, s)
+	dir := t.TempDir()
+	if err := s.SetReceiveDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	s.SetAutoAccept(autoAccept)
+	info, err := s.ReceiveFileHandler(sv.ListenConfig{Address: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("ReceiveFileHandler: %v", err)
+	}
+	t.Cleanup(s.StopServerHandler)
+	return s, info, record(sink), dir
+}
+
+func newClient(t *testing.T) (*client.Client, *recorder) {
+	sink := events.NewChannel(64)
+	return client.NewClient(sink, newLogCapture(t)), record(sink)
+}
+
+// logCapture es un events.Logger que guarda los mensajes.
+type logCapture struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+// newLogCapture crea un logCapture que muestra sus mensajes si t falla.
+func newLogCapture(t *testing.T) *logCapture {
+	l := &logCapture{}
+	t.Cleanup(func() {
+		if t.Failed() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			t.Log(strings.Join(l.lines, "\n"))
+		}
+	})
+	return l
+}
+
+func (l *logCapture) Printf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+// check comprueba que cada uno de want aparezca en algún mensaje de side.
+func (l *logCapture) check(t *testing.T, side string, want []string) {
+	t.Helper()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	all := strings.Join(l.lines, "\n")
+	for _, w := range want {
+		if !strings.Contains(all, w) {
+			t.Errorf("el log del %s no tiene %q:\n%s", side, w, all)
+		}
+	}
+}
+
+// recorder guarda los eventos de un events.Channel para consultarlos después.
+type recorder struct {
+	mu     sync.Mutex
+	events []events.Event
+	added  chan struct{}
+}
+
+func record(sink *events.Channel) *recorder {
+	r := &recorder{added: make(chan struct{}, 1)}
+	go func() {
+		for e := range sink.Events {
+			r.mu.Lock()
+			r.events = append(r.events, e)
+			r.mu.Unlock()
+			select {
+			case r.added <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return r
+}
+
+// wait espera un evento name cuyo primer dato, como texto, cumpla match (o
+// cualquiera si match es nil) y devuelve ese dato.
+func (r *recorder) wait(t *testing.T, name string, match func(string) bool) interface{} {
+	t.Helper()
+	deadline := time.After(eventTimeout)
+	for {
+		r.mu.Lock()
+		for _, e := range r.events {
+			if e.Name != name || len(e.Data) == 0 {
+				continue
+			}
+			if match == nil || match(fmt.Sprint(e.Data[0])) {
+				r.mu.Unlock()
+				return e.Data[0]
+			}
+		}
+		r.mu.Unlock()
+		select {
+		case <-r.added:
+		case <-deadline:
+			t.Fatalf("no llegó el evento %s esperado; se recibieron: %v", name, r.all(name))
+		}
+	}
+}
+
+// all devuelve los datos de todos los eventos name recibidos.
+func (r *recorder) all(name string) []interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var data []interface{}
+	for _, e := range r.events {
+		if e.Name == name && len(e.Data) > 0 {
+			data = append(data, e.Data[0])
+		}
+	}
+	return data
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+)
+
+// Carpeta de descarga cuando el usuario no eligió ninguna, relativa al directorio
+// de trabajo del proceso al momento de arrancar.
+const defaultReceiveDir = "receive"
+
+// Largo máximo de un nombre de archivo en los sistemas de archivos habituales.
+const maxFileNameLen = 255
+
+// Nombres de dispositivo que Windows no permite usar como archivo, con o sin extensión.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SetReceiveDir cambia la carpeta donde se guardan los archivos recibidos. Los
+// archivos que ya se están recibiendo terminan en la carpeta anterior.
+func (s *Server) SetReceiveDir(dir string) error {
+	if strings.TrimSpace(dir) == "" {
+		return fmt.Errorf("la carpeta de descarga no puede estar vacía")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return fmt.Errorf("no se pudo crear la carpeta %s: %w", abs, err)
+	}
+
+	s.settingsMu.Lock()
+	s.receiveDir = abs
+	s.settingsMu.Unlock()
+	return nil
+}
+
+// GetReceiveDir devuelve la ruta absoluta de la carpeta de descarga.
+func (s *Server) GetReceiveDir() string {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	if s.receiveDir == "" {
+		abs, err := filepath.Abs(defaultReceiveDir)
+		if err != nil {
+			return defaultReceiveDir
+		}
+		s.receiveDir = abs
+	}
+	return s.receiveDir
+}
+
+// sanitizeFileName valida el nombre que manda el cliente. Solo se acepta un
+// nombre simple: nada de rutas absolutas, separadores, ".." ni caracteres que
+// algún sistema de archivos interprete de forma especial.
+func sanitizeFileName(name string) (string, error) {
+	invalid := func(reason string) (string, error) {
+		return "", fmt.Errorf("nombre de archivo inválido %q: %s", name, reason)
+	}
+
+	if name == "" {
+		return invalid("está vacío")
+	}
+	if len(name) > maxFileNameLen {
+		return invalid("es demasiado largo")
+	}
+	if !utf8.ValidString(name) {
+		return invalid("no es UTF-8 válido")
+	}
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return invalid("es una ruta absoluta")
+	}
+	if name == "." || name == ".." {
+		return invalid("no es un nombre de archivo")
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return invalid("contiene separadores de ruta")
+	}
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, partSuffix) || (strings.HasPrefix(name, ".") && strings.HasSuffix(lower, progressSuffix)) {
+		// Pisaría el archivo temporal o el progreso de otra recepción
+		return invalid("es un archivo de control del servidor")
+	}
+	if strings.HasPrefix(name, ".") {
+		return invalid("empieza con un punto")
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return invalid("termina con un punto o un espacio")
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r) {
+			return invalid(fmt.Sprintf("contiene el carácter no permitido %q", r))
+		}
+	}
+	stem, _, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimSpace(stem))] {
+		return invalid("es un nombre reservado del sistema")
+	}
+	return name, nil
+}
+
+// receivePath devuelve la ruta donde se guarda un archivo recibido dentro de dir,
+// o un error si el nombre no es seguro.
+func receivePath(dir, name string) (string, error) {
+	clean, err := sanitizeFileName(name)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, clean)
+	// Doble control: la ruta final tiene que quedar dentro de la carpeta de descarga
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel != clean {
+		return "", fmt.Errorf("nombre de archivo inválido %q: sale de la carpeta de descarga", name)
+	}
+	return path, nil
+}
+
+// rejectMessage recorta el motivo de un rechazo al largo que admite el protocolo.
+func rejectMessage(message string) string {
+	if len(message) > protocol.MaxRejectMessageLen {
+		message = strings.ToValidUTF8(message[:protocol.MaxRejectMessageLen], "")
+	}
+	return message
+}
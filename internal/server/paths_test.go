@@ -0,0 +1,57 @@
+package server
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReceivePathRejectsUnsafeNames(t *testing.T) {
+	dir := t.TempDir()
+	unsafe := []struct {
+		name, why string
+	}{
+		{"../x", "sube a la carpeta de arriba"},
+		{"..", "es la carpeta de arriba"},
+		{"a/../../x", "sube con separadores"},
+		{"/etc/passwd", "ruta absoluta"},
+		{`C:\Windows\win.ini`, "ruta absoluta de Windows"},
+		{`\\servidor\recurso\x`, "ruta UNC"},
+		{`a\b`, "separador de Windows"},
+		{"a/b", "separador"},
+		{".bashrc", "empieza con un punto"},
+		{".informe.pdf.progress", "archivo de progreso del servidor"},
+		{"informe.pdf.part", "archivo temporal del servidor"},
+		{"informe.pdf.PART", "archivo temporal del servidor en mayúsculas"},
+		{"a\x00b", "carácter nulo"},
+		{"a\nb", "salto de línea"},
+		{"\x1b[31mrojo", "secuencia de escape"},
+		{"CON", "nombre reservado"},
+		{"con.txt", "nombre reservado con extensión"},
+		{"LPT1", "nombre reservado"},
+		{"", "vacío"},
+		{"nombre.", "termina con un punto"},
+		{"a:b", "carácter no permitido"},
+		{strings.Repeat("a", maxFileNameLen+1), "demasiado largo"},
+		{"\xff\xfe", "UTF-8 inválido"},
+	}
+	for _, tc := range unsafe {
+		if path, err := receivePath(dir, tc.name); err == nil {
+			t.Errorf("receivePath(%q) (%s) = %q, se esperaba un error", tc.name, tc.why, path)
+		}
+	}
+}
+
+func TestReceivePathStaysInsideDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"informe.pdf", "foto ñandú.jpg", "sin extensión", "a..b", "CONSOLA.txt", strings.Repeat("a", maxFileNameLen)} {
+		path, err := receivePath(dir, name)
+		if err != nil {
+			t.Errorf("receivePath(%q): %v", name, err)
+			continue
+		}
+		if filepath.Dir(path) != dir || filepath.Base(path) != name {
+			t.Errorf("receivePath(%q) = %q, se esperaba %q dentro de %q", name, path, name, dir)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// pendingPrompt es una consulta que espera la respuesta de la interfaz.
+type pendingPrompt struct {
+	event  string
+	answer chan string
+}
+
+// prompt emite una consulta a la interfaz y espera la respuesta hasta timeout.
+// La interfaz recibe en data un "id" que debe devolver con la respuesta, y el
+// evento "prompt-expired" con ese id si la consulta vence. Devuelve false si
+// nadie respondió a tiempo.
+func (s *Server) prompt(event string, data map[string]interface{}, timeout time.Duration) (string, bool) {
+	answer := make(chan string, 1)
+
+	s.promptsMu.Lock()
+	if s.prompts == nil {
+		s.prompts = make(map[string]pendingPrompt)
+	}
+	s.promptSeq++
+	id := strconv.FormatUint(s.promptSeq, 10)
+	s.prompts[id] = pendingPrompt{event: event, answer: answer}
+	s.promptsMu.Unlock()
+
+	defer func() {
+		s.promptsMu.Lock()
+		delete(s.prompts, id)
+		s.promptsMu.Unlock()
+	}()
+
+	data["id"] = id
+	data["timeout"] = int(timeout.Seconds())
+	s.emit(event, data)
+
+	select {
+	case a := <-answer:
+		return a, true
+	case <-time.After(timeout):
+		s.emit("prompt-expired", id)
+		return "", false
+	}
+}
+
+// answerPrompt entrega la respuesta de la interfaz a la consulta id, que tiene
+// que haberse emitido con el evento indicado.
+func (s *Server) answerPrompt(event, id, answer string) error {
+	s.promptsMu.Lock()
+	defer s.promptsMu.Unlock()
+	p, ok := s.prompts[id]
+	if !ok || p.event != event {
+		return fmt.Errorf("la consulta %s ya no está pendiente", id)
+	}
+	select {
+	case p.answer <- answer:
+	default:
+		// Ya se respondió; nos quedamos con la primera respuesta
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+)
+
+// Cada cuántos segmentos se guarda el progreso de una recepción TCP.
+const progressInterval = 100
+
+// transferProgress es el estado que se persiste junto a un archivo a medio recibir
+// para poder reanudarlo si se corta la conexión. Cuando el checksum viaja al
+// final, la fecha de modificación y el tamaño del original identifican el archivo.
+type transferProgress struct {
+	Name        string `json:"name"`
+	Checksum    string `json:"checksum"`
+	Reps        uint32 `json:"reps"`
+	Size        uint64 `json:"size,omitempty"`
+	ModTime     int64  `json:"modTime,omitempty"`
+	ExpectedSeq uint32 `json:"expectedSeq"`
+	// SavedAs es el nombre con el que se guarda el archivo, distinto de Name si
+	// se renombró; mientras se recibe lleva la extensión .part
+	SavedAs string `json:"savedAs,omitempty"`
+}
+
+// El progreso de cada recepción se guarda en un archivo oculto con esta extensión.
+const progressSuffix = ".progress"
+
+func progressPath(dir, fileName string) string {
+	return filepath.Join(dir, "."+fileName+progressSuffix)
+}
+
+// resumeOffset devuelve el segmento desde el cual se puede reanudar la recepción
+// del archivo descrito por el header y el nombre con el que se guarda, o 0 si no
+// hay nada que reanudar.
+func (s *Server) resumeOffset(dir string, header *protocol.Header) (uint32, string) {
+	data, err := os.ReadFile(progressPath(dir, header.Name))
+	if err != nil {
+		return 0, ""
+	}
+	var progress transferProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		s.logf("Ignoring corrupt progress file for %s: %v", header.Name, err)
+		return 0, ""
+	}
+	if header.Checksum == "" && header.ModTime == 0 {
+		// Sin checksum ni fecha no hay forma de saber si es el mismo archivo
+		return 0, ""
+	}
+	if progress.Checksum != header.Checksum || progress.ModTime != header.ModTime || progress.Reps != header.Reps || progress.Size != header.Size || progress.ExpectedSeq >= header.Reps {
+		// Es otro archivo con el mismo nombre: se recibe desde cero
+		return 0, ""
+	}
+	savedAs := progress.SavedAs
+	if savedAs == "" {
+		savedAs = header.Name
+	}
+	if _, err := sanitizeFileName(savedAs); err != nil {
+		return 0, ""
+	}
+
+	info, err := os.Stat(partPath(filepath.Join(dir, savedAs)))
+	if err != nil || info.Size() < int64(progress.ExpectedSeq)*protocol.SegmentSize {
+		return 0, ""
+	}
+	return progress.ExpectedSeq, savedAs
+}
+
+// saveProgress persiste cuántos segmentos contiguos del archivo ya están escritos.
+func (s *Server) saveProgress(dir string, header *protocol.Header, savedAs string, expectedSeq uint32) {
+	data, err := json.Marshal(transferProgress{
+		Name:        header.Name,
+		Checksum:    header.Checksum,
+		Reps:        header.Reps,
+		Size:        header.Size,
+		ModTime:     header.ModTime,
+		ExpectedSeq: expectedSeq,
+		SavedAs:     savedAs,
+	})
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(progressPath(dir, header.Name), data, 0644); err != nil {
+		s.logf("Error saving progress for %s: %v", header.Name, err)
+	}
+}
+
+func (s *Server) clearProgress(dir, fileName string) {
+	if err := os.Remove(progressPath(dir, fileName)); err != nil && !os.IsNotExist(err) {
+		s.logf("Error removing progress for %s: %v", fileName, err)
+	}
+}
+
+// openForResume abre el archivo temporal path descartando lo que esté más allá del
+// último segmento confirmado. Lo que queda se lee una vez para sumarlo a h, así
+// el checksum sigue calculándose a medida que llegan los segmentos.
+func openForResume(path string, offset uint32, h hash.Hash) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(offset) * protocol.SegmentSize
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	// Leer el prefijo deja el archivo posicionado al final
+	if _, err := io.CopyN(h, file, size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
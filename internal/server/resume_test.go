@@ -0,0 +1,74 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NeichS/final-redes-wails/internal/events"
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+)
+
+// interruptedReception deja en dir el archivo temporal y el progreso de una
+// recepción de header cortada después de expectedSeq segmentos.
+func interruptedReception(t *testing.T, s *Server, dir string, header *protocol.Header, expectedSeq uint32) {
+	t.Helper()
+	part := partPath(filepath.Join(dir, header.Name))
+	if err := os.WriteFile(part, make([]byte, int(expectedSeq)*protocol.SegmentSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.saveProgress(dir, header, header.Name, expectedSeq)
+}
+
+// trailerHeader es el header de un archivo con el checksum al final, que solo
+// se identifica por el tamaño y la fecha de modificación.
+func trailerHeader(modTime time.Time) *protocol.Header {
+	return &protocol.Header{
+		Name:     "informe.pdf",
+		Reps:     10,
+		Size:     10 * protocol.SegmentSize,
+		HasSize:  true,
+		ModTime:  modTime.UnixNano(),
+		Perm:     0644,
+		HasAttrs: true,
+	}
+}
+
+func TestResumeSameFile(t *testing.T) {
+	s := NewServer(events.Discard, events.Discard)
+	dir := t.TempDir()
+	modTime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	interruptedReception(t, s, dir, trailerHeader(modTime), 4)
+
+	offset, savedAs := s.resumeOffset(dir, trailerHeader(modTime))
+	if offset != 4 || savedAs != "informe.pdf" {
+		t.Errorf("resumeOffset = %d, %q; se esperaba reanudar desde 4 en informe.pdf", offset, savedAs)
+	}
+}
+
+// Al reconectarse con otro archivo del mismo nombre y tamaño no se reanuda:
+// se mezclaría el principio de uno con el final del otro.
+func TestResumeDifferentFileOfSameSize(t *testing.T) {
+	s := NewServer(events.Discard, events.Discard)
+	dir := t.TempDir()
+	interruptedReception(t, s, dir, trailerHeader(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)), 4)
+
+	other := trailerHeader(time.Date(2024, 5, 2, 9, 30, 0, 0, time.UTC))
+	if offset, _ := s.resumeOffset(dir, other); offset != 0 {
+		t.Errorf("resumeOffset = %d para otro archivo del mismo tamaño, se esperaba 0", offset)
+	}
+}
+
+// Sin checksum ni fecha en el header no hay con qué comparar.
+func TestResumeWithoutIdentity(t *testing.T) {
+	s := NewServer(events.Discard, events.Discard)
+	dir := t.TempDir()
+	header := trailerHeader(time.Time{})
+	header.ModTime, header.Perm, header.HasAttrs = 0, 0, false
+	interruptedReception(t, s, dir, header, 4)
+
+	if offset, _ := s.resumeOffset(dir, header); offset != 0 {
+		t.Errorf("resumeOffset = %d sin checksum ni fecha, se esperaba 0", offset)
+	}
+}
@@ -1,202 +1,483 @@
 package server
 
 import (
-	"context"
-	"crypto/md5"
-	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"os"
+	"path/filepath"
 
-	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"github.com/NeichS/final-redes-wails/internal/impair"
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+	"github.com/NeichS/final-redes-wails/internal/shared"
+	"github.com/NeichS/final-redes-wails/internal/stats"
 )
 
-func (s *Server) handleConnection(conn net.Conn, ctx context.Context) {
+func (s *Server) handleConnection(raw net.Conn) {
 	s.connsMu.Lock()
-	s.activeConns[conn] = struct{}{}
+	s.activeConns[raw] = struct{}{}
 	s.connsMu.Unlock()
 
+	// Los frames que llegan pasan por el simulador de red
+	conn := impair.NewReceiver(raw, &s.impairment)
 	defer func() {
 		s.connsMu.Lock()
-		delete(s.activeConns, conn)
+		delete(s.activeConns, raw)
 		s.connsMu.Unlock()
 		conn.Close()
 	}()
 
-	runtime.LogPrint(ctx, "Accepted new connection, waiting for files...")
+	s.logf("Accepted new connection, waiting for files...")
+
+	// Hasta que el cliente haga handshake lo tratamos como un par sin funcionalidades opcionales
+	session := protocol.LegacySession()
+	sender := hostOf(conn.RemoteAddr())
 
 	for {
-		msgType := make([]byte, 1)
-		_, err := io.ReadFull(conn, msgType)
+		frame, err := protocol.ReadFrame(conn)
 		if err != nil {
 			if err == io.EOF {
-				runtime.LogPrint(ctx, "Client closed connection cleanly.")
+				s.logf("Client closed connection cleanly.")
 			} else {
-				runtime.LogPrintf(ctx, "Error reading message type: %v", err)
+				s.logf("Error reading header: %v", err)
+				s.emit("server-error", "Error de sincronización con el cliente.")
 			}
 			return
 		}
 
-		if msgType[0] != 1 {
-			runtime.LogPrintf(ctx, "Invalid message type received. Expected header (1), got (%d)", msgType[0])
-			runtime.EventsEmit(s.ctx, "server-error", "Error de sincronización con el cliente.")
-			return
+		if hello, ok := frame.(*protocol.Hello); ok && hello.Type == protocol.TypeHello {
+			session, err = s.answerHello(conn, hello)
+			if err != nil {
+				s.logf("Error answering HELLO: %v", err)
+				return
+			}
+			s.logf("Handshake with %q: version %d, features %#x, window %d", session.PeerName, session.Version, session.Features, session.MaxWindow)
+			continue
 		}
 
-		headerFields := make([]byte, 12) // 4 bytes para reps + 4 para nameLen
-		_, err = io.ReadFull(conn, headerFields)
-		if err != nil {
-			runtime.LogPrintf(ctx, "Error reading header fields: %v", err)
+		if offer, ok := frame.(*protocol.Offer); ok {
+			// El cliente anuncia todos los archivos de una vez: se aceptan o se rechazan juntos
+			if !s.approveTransfer(sender, session.PeerName, offer.Files) {
+				s.logf("Transfer from %s declined", sender)
+				s.emit("server-error", fmt.Sprintf("Transferencia de %s rechazada.", sender))
+				s.sendReject(conn, protocol.RejectDeclined, declinedMessage)
+				return
+			}
+			s.sendAck(conn, protocol.TypeAckOffer, 0, protocol.AckStatusOK)
+			continue
+		}
+
+		header, ok := frame.(*protocol.Header)
+		if !ok {
+			s.logf("Invalid message received. Expected header, got %T", frame)
+			s.emit("server-error", "Error de sincronización con el cliente.")
 			return
 		}
-		reps := binary.BigEndian.Uint32(headerFields[0:4])
-		nameLen := binary.BigEndian.Uint32(headerFields[4:8])
-		checksumLen := binary.BigEndian.Uint32(headerFields[8:12])
+		reps := header.Reps
+		arqMode := header.ARQMode
+		window := uint32(header.Window)
+		if !session.Has(protocol.FeatureWindow) {
+			// Un par que no negoció ventanas solo puede usar Stop-and-Wait
+			arqMode = protocol.ARQStopAndWait
+			window = 1
+		}
+		fileName := header.Name
+		receivedChecksum := header.Checksum
 
-		payloadAndEndByte := make([]byte, nameLen+checksumLen+1)
-		_, err = io.ReadFull(conn, payloadAndEndByte)
+		// El nombre lo elige el cliente: si no es seguro rechazamos el archivo y
+		// seguimos esperando el siguiente
+		dir := s.GetReceiveDir()
+		filePath, err := receivePath(dir, fileName)
 		if err != nil {
-			runtime.LogPrintf(ctx, "Error reading header payload: %v", err)
-			return
+			s.logf("Rejecting file: %v", err)
+			s.emit("server-error", fmt.Sprintf("Archivo rechazado: %v", err))
+			s.sendReject(conn, protocol.RejectInvalidName, err.Error())
+			continue
 		}
 
-		if payloadAndEndByte[nameLen+checksumLen] != 0 {
-			runtime.LogPrint(ctx, "Invalid header: missing end byte.")
+		// Con el tamaño declarado la cantidad de segmentos queda determinada
+		if header.HasSize && reps != protocol.Segments(header.Size, protocol.SegmentSize) {
+			err := fmt.Errorf("el header de %s declara %d segmentos para %d bytes", fileName, reps, header.Size)
+			s.logf("Rejecting file: %v", err)
+			s.emit("server-error", fmt.Sprintf("Archivo rechazado: %v", err))
+			s.sendReject(conn, protocol.RejectInvalidHeader, err.Error())
 			continue
 		}
-		fileName := string(payloadAndEndByte[:nameLen])
-		receivedChecksum := string(payloadAndEndByte[nameLen : nameLen+checksumLen])
 
-		runtime.LogPrintf(ctx, "Receiving file: %s, Segments: %d", fileName, reps)
-		runtime.EventsEmit(s.ctx, "reception-started", fileName)
-		conn.Write([]byte("Header received for " + fileName))
+		// Sin algoritmo en el header el checksum es MD5
+		algorithm, err := shared.NormalizeHash(header.HashAlgorithm)
+		if err != nil {
+			s.logf("Rejecting file %s: %v", fileName, err)
+			s.emit("server-error", fmt.Sprintf("Archivo %s rechazado: %v", fileName, err))
+			s.sendReject(conn, protocol.RejectUnsupportedHash, err.Error())
+			continue
+		}
 
-		if err := os.MkdirAll("./receive", 0755); err != nil {
-			runtime.LogPrintf(ctx, "Error creating directory: %v", err)
+		// Un archivo que no vino en una oferta aceptada se consulta por separado. Sin
+		// tamaño en el header se estima a partir de la cantidad de segmentos.
+		offered := []protocol.OfferedFile{{Name: fileName, Size: uint64(reps) * protocol.SegmentSize}}
+		if header.HasSize {
+			offered[0].Size = header.Size
+		}
+		if !s.approveTransfer(sender, session.PeerName, offered) {
+			s.logf("File %s from %s declined", fileName, sender)
+			s.emit("server-error", fmt.Sprintf("Archivo %s de %s rechazado.", fileName, sender))
+			s.sendReject(conn, protocol.RejectDeclined, declinedMessage)
 			continue
 		}
 
-		newFile, err := os.Create("./receive/" + fileName)
-		if err != nil {
-			runtime.LogPrintf(ctx, "Error creating file: %v", err)
+		meta := shared.RemoteMetadata(fileName, int64(header.Size), algorithm, receivedChecksum)
+		s.logf("Receiving file: %s (%s), Segments: %d, Size: %d, ARQ mode: %d, Window: %d, Hash: %s", fileName, meta.MIMEType(), reps, header.Size, arqMode, window, meta.HashAlgorithm())
+		s.emit("reception-started", fileName)
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			s.logf("Error creating directory: %v", err)
+			s.emit("server-error", fmt.Sprintf("No se pudo crear la carpeta de descarga: %v", err))
+			s.sendReject(conn, protocol.RejectStorage, err.Error())
 			continue
 		}
 
+		// Si el cliente soporta reanudación y tenemos una parte de este archivo, seguimos desde ahí
 		var expectedSeq uint32 = 0
-		var arqs uint32 = 0
+		savedAs := fileName
+		if session.Has(protocol.FeatureResume) {
+			var partial string
+			expectedSeq, partial = s.resumeOffset(dir, header)
+			if expectedSeq > 0 {
+				savedAs = partial
+				filePath = filepath.Join(dir, partial)
+			}
+		}
 
-		for i := uint32(0); i < reps; i++ {
-			segmentHeader := make([]byte, 9)
-			_, err := io.ReadFull(conn, segmentHeader)
+		// El checksum se calcula a medida que se escriben los segmentos
+		hasher, _ := shared.NewHash(algorithm)
+		var (
+			newFile *os.File
+			place   placement
+		)
+		if expectedSeq > 0 {
+			place = placement{path: filePath, name: savedAs}
+			newFile, err = openForResume(partPath(filePath), expectedSeq, hasher)
 			if err != nil {
-				log.Printf("Error reading segment header: %v", err)
-				newFile.Close()
-				return
+				s.logf("Cannot resume %s, starting over: %v", fileName, err)
+				hasher.Reset()
+				expectedSeq = 0
+				savedAs = fileName
+			}
+		}
+
+		status := protocol.AckStatusResume
+		if expectedSeq == 0 {
+			// Un archivo nuevo: la política de colisiones decide dónde se guarda
+			place, err = s.placeFile(dir, fileName, algorithm, receivedChecksum)
+			if err != nil {
+				s.logf("Error creating file: %v", err)
+				s.emit("server-error", fmt.Sprintf("No se pudo crear %s: %v", fileName, err))
+				s.sendReject(conn, protocol.RejectStorage, err.Error())
+				continue
+			}
+			if msg := collisionMessage(place, fileName); msg != "" {
+				s.logf("Collision: %s", collisionLog(place, fileName))
+				s.emit("reception-finished", msg)
+			}
+			if place.status == protocol.AckStatusSkipped {
+				s.sendHeaderAck(conn, 0, place.status, "")
+				continue
 			}
+			newFile, filePath, savedAs, status = place.file, place.path, place.name, place.status
+		}
 
-			if segmentHeader[0] != 0 {
-				log.Println("Invalid segment: wrong type byte.")
-				newFile.Close()
+		if expectedSeq > 0 {
+			s.logf("Resuming %s from segment %d", fileName, expectedSeq)
+		}
+		ackName := ""
+		if status == protocol.AckStatusRenamed {
+			ackName = savedAs
+		}
+		s.sendHeaderAck(conn, expectedSeq, status, ackName)
+
+		// abort guarda el progreso antes de abandonar la recepción, para poder
+		// reanudarla; si no se puede reanudar se borra el archivo temporal
+		abort := func() {
+			newFile.Close()
+			if session.Has(protocol.FeatureResume) && expectedSeq > 0 {
+				s.saveProgress(dir, header, savedAs, expectedSeq)
 				return
 			}
+			os.Remove(partPath(filePath))
+		}
 
-			receivedSeq := binary.BigEndian.Uint32(segmentHeader[1:5])
-			dataLen := binary.BigEndian.Uint32(segmentHeader[5:9])
-			dataBuffer := make([]byte, dataLen+1) // +1 para el byte final
+		var arqs uint32 = 0
+		st := stats.New(fileName, header.Size, receivedBytes(header, expectedSeq))
+		// Segmentos fuera de orden que Selective Repeat guarda hasta poder escribirlos
+		outOfOrder := make(map[uint32][]byte)
 
-			_, err = io.ReadFull(conn, dataBuffer)
+		// ackFor devuelve el número de secuencia a confirmar: Selective Repeat confirma
+		// cada segmento individualmente, Go-Back-N y Stop-and-Wait de forma acumulativa.
+		ackFor := func(seq uint32) uint32 {
+			if arqMode == protocol.ARQSelectiveRepeat {
+				return seq
+			}
+			return expectedSeq - 1
+		}
+
+		for expectedSeq < reps {
+			if snapshot, ok := st.Due(); ok {
+				s.emit("receiving-file-stats", snapshot)
+			}
+			frame, err := protocol.ReadFrame(conn)
 			if err != nil {
-				log.Printf("Error reading segment data: %v", err)
-				newFile.Close()
+				s.logf("Error reading segment: %v", err)
+				abort()
 				return
 			}
 
-			if dataBuffer[dataLen] != 1 {
-				log.Println("Invalid segment: missing end byte.")
-				newFile.Close()
+			segment, ok := frame.(*protocol.Segment)
+			if !ok {
+				s.logf("Invalid segment: unexpected frame %T", frame)
+				abort()
 				return
 			}
+			receivedSeq := segment.Seq
+			st.Transferred(len(segment.Data))
 
-			// SIMULACIÓN DE PÉRDIDA DE PAQUETES (DOWNTIME)
-			if s.IsDowntime() {
-				// Leímos el paquete del socket (para vaciar el buffer), pero lo ignoramos.
-				// No enviamos ACK.
-				// Decrementamos i para volver a esperar este mismo segmento (retransmisión).
-				log.Printf("DOWNTIME: Dropping packet seq %d", receivedSeq)
-				i--
+			if !segment.Valid() {
+				// No se escribe: se le pide al cliente que lo reenvíe ya mismo
+				s.logf("Segment %d failed the CRC check. Requesting it again.", receivedSeq)
+				arqs++
+				st.Corrupt()
+				s.sendAck(conn, protocol.TypeAckSegment, receivedSeq, protocol.AckStatusCorrupt)
+				s.emit("receiving-file-progress", map[string]interface{}{
+					"received":   expectedSeq,
+					"total":      reps,
+					"bytes":      receivedBytes(header, expectedSeq),
+					"totalBytes": header.Size,
+					"arqs":       arqs,
+				})
 				continue
 			}
 
 			// Duplicate Detection
-			runtime.LogPrintf(ctx, "Received sequence: %d", receivedSeq)
-			runtime.LogPrintf(ctx, "Expected sequence: %d", expectedSeq)
-			if receivedSeq < expectedSeq {
-				runtime.LogPrintf(ctx, "Duplicate segment %d received (expected %d). Resending ACK.", receivedSeq, expectedSeq)
+			s.logf("Received sequence: %d", receivedSeq)
+			s.logf("Expected sequence: %d", expectedSeq)
+			_, alreadyBuffered := outOfOrder[receivedSeq]
+			if receivedSeq < expectedSeq || alreadyBuffered {
+				s.logf("Duplicate segment %d received (expected %d). Resending ACK.", receivedSeq, expectedSeq)
 				arqs++
-				fmt.Println("Resending ACK for segment, total aqrs = ", arqs)
+				st.Duplicate()
+				s.logf("Resending ACK for segment, total arqs = %d", arqs)
 				// Resend ACK for the received sequence (which is likely what the client is stuck on)
-				fmt.Fprintf(conn, "Segment %d received", receivedSeq)
+				s.sendAck(conn, protocol.TypeAckSegment, ackFor(receivedSeq), protocol.AckStatusDuplicate)
 
 				// Emit progress with ARQ update
-				runtime.EventsEmit(s.ctx, "receiving-file-progress", map[string]interface{}{
-					"received": expectedSeq, // Still at the same progress
-					"total":    reps,
-					"arqs":     arqs,
+				s.emit("receiving-file-progress", map[string]interface{}{
+					"received":   expectedSeq, // Still at the same progress
+					"total":      reps,
+					"bytes":      receivedBytes(header, expectedSeq),
+					"totalBytes": header.Size,
+					"arqs":       arqs,
 				})
-
-				// Decrement i because we didn't process a new segment
-				i--
 				continue
 			}
 
-			// Escribir en el archivo
-			_, err = newFile.Write(dataBuffer[:dataLen])
-			if err != nil {
-				log.Printf("Error writing to file: %v", err)
-				newFile.Close()
-				return
+			if receivedSeq > expectedSeq {
+				st.OutOfOrder()
+				if arqMode != protocol.ARQSelectiveRepeat || receivedSeq >= expectedSeq+window {
+					// Go-Back-N descarta todo lo que llega fuera de orden
+					s.logf("Out of order segment %d discarded (expected %d)", receivedSeq, expectedSeq)
+					continue
+				}
+				outOfOrder[receivedSeq] = segment.Data
+				st.Delivered(len(segment.Data))
+				s.sendAck(conn, protocol.TypeAckSegment, receivedSeq, protocol.AckStatusOK)
+				continue
 			}
 
-			expectedSeq++
+			// Escribir en el archivo el segmento esperado y los que estaban en espera
+			data := segment.Data
+			st.Delivered(len(data))
+			for {
+				_, err = newFile.Write(data)
+				if err != nil {
+					s.logf("Error writing to file: %v", err)
+					abort()
+					return
+				}
+				hasher.Write(data)
+				expectedSeq++
+
+				next, ok := outOfOrder[expectedSeq]
+				if !ok {
+					break
+				}
+				delete(outOfOrder, expectedSeq)
+				data = next
+			}
 
 			// Enviar confirmación del segmento
-			fmt.Fprintf(conn, "Segment %d received", i)
+			s.sendAck(conn, protocol.TypeAckSegment, ackFor(receivedSeq), protocol.AckStatusOK)
+
+			if expectedSeq%progressInterval == 0 && session.Has(protocol.FeatureResume) {
+				s.saveProgress(dir, header, savedAs, expectedSeq)
+			}
 
-			if (i+1)%100 == 0 || i+1 == reps {
-				runtime.EventsEmit(s.ctx, "receiving-file-progress", map[string]interface{}{
-					"received": i + 1,
-					"total":    reps,
-					"arqs":     arqs,
+			if expectedSeq%100 == 0 || expectedSeq == reps {
+				s.emit("receiving-file-progress", map[string]interface{}{
+					"received":   expectedSeq,
+					"total":      reps,
+					"bytes":      receivedBytes(header, expectedSeq),
+					"totalBytes": header.Size,
+					"arqs":       arqs,
 				})
 			}
 		}
 
 		newFile.Close()
-		log.Printf("File %s received successfully.", fileName)
+		s.clearProgress(dir, fileName)
+		s.logf("File %s received successfully.", fileName)
+		summary := st.Summary()
+		s.logf("Stats for %s: %v", fileName, summary)
+		s.emit("receiving-file-summary", summary)
 
-		fileToVerify, err := os.Open("./receive/" + fileName)
-		if err != nil {
-			log.Printf("Could not open received file for verification: %v", err)
+		if session.Has(protocol.FeatureTrailer) {
+			// El checksum viaja después del último segmento
+			receivedChecksum, err = readTrailer(conn)
+			if err != nil {
+				s.logf("Error reading checksum of %s: %v", fileName, err)
+				s.emit("server-error", fmt.Sprintf("❌ No llegó el checksum de %s, no se pudo verificar.", fileName))
+				return
+			}
+		}
+
+		if header.HasSize {
+			// Un archivo con otro tamaño está truncado (o le sobran datos) aunque
+			// hayan llegado todos los segmentos
+			if info, err := os.Stat(partPath(filePath)); err != nil || uint64(info.Size()) != header.Size {
+				got := int64(-1)
+				if err == nil {
+					got = info.Size()
+				}
+				s.logf("SIZE MISMATCH! %s has %d bytes, expected %d.", fileName, got, header.Size)
+				msg := fmt.Sprintf("%s llegó incompleto: %d de %d bytes.", fileName, max(got, 0), header.Size)
+				s.rejectReceived(conn, session, place, protocol.VerifySizeMismatch, msg)
+				continue
+			}
+		}
+
+		calculatedChecksum := hex.EncodeToString(hasher.Sum(nil))
+		if receivedChecksum != calculatedChecksum {
+			s.logf("CHECKSUM MISMATCH! File is corrupted.")
+			msg := fmt.Sprintf("Error de checksum en %s. El archivo está corrupto.", fileName)
+			s.rejectReceived(conn, session, place, protocol.VerifyChecksumMismatch, msg)
 			continue
 		}
-		defer fileToVerify.Close()
 
-		hash := md5.New()
-		if _, err := io.Copy(hash, fileToVerify); err != nil {
-			log.Printf("Error calculating checksum for received file: %v", err)
+		s.logf("Checksums match! File is intact.")
+		if s.discardIfIdentical(place, algorithm, receivedChecksum) {
+			s.sendVerify(conn, session, protocol.VerifyOK, "")
+			s.emit("reception-finished", duplicateMessage(fileName))
 			continue
 		}
-		calculatedChecksum := hex.EncodeToString(hash.Sum(nil))
+		if err := s.commitFile(place, attrsFrom(header.ModTime, header.Perm)); err != nil {
+			s.logf("Error renaming %s: %v", partPath(filePath), err)
+			s.emit("server-error", fmt.Sprintf("❌ No se pudo guardar %s: %v", savedAs, err))
+			s.sendVerify(conn, session, protocol.VerifyStoreFailed, err.Error())
+			continue
+		}
+		s.sendVerify(conn, session, protocol.VerifyOK, "")
+		s.emit("reception-finished", fmt.Sprintf("✅ ¡%s recibido y verificado con éxito!", fileName))
+	}
+}
+
+// rejectReceived aplica la acción elegida a un archivo que no pasó la
+// verificación final y se lo informa a la interfaz y al emisor, que puede
+// volver a enviarlo.
+func (s *Server) rejectReceived(conn net.Conn, session protocol.Session, place placement, result byte, msg string) {
+	msg += " " + s.discardCorrupt(place)
+	s.emit("server-error", "❌ "+msg)
+	s.sendVerify(conn, session, result, msg)
+}
 
-		if receivedChecksum == calculatedChecksum {
-			log.Println("Checksums match! File is intact.")
-			runtime.EventsEmit(s.ctx, "reception-finished", fmt.Sprintf("✅ ¡%s recibido y verificado con éxito!", fileName))
-		} else {
-			log.Println("CHECKSUM MISMATCH! File is corrupted.")
-			runtime.EventsEmit(s.ctx, "server-error", fmt.Sprintf("❌ Error de checksum en %s. El archivo está corrupto.", fileName))
+// readTrailer lee el checksum que el emisor envía cuando se confirmaron todos los
+// segmentos. Las retransmisiones que se cruzaron con el último ACK se descartan.
+func readTrailer(conn net.Conn) (string, error) {
+	for {
+		frame, err := protocol.ReadFrame(conn)
+		if err != nil {
+			return "", err
+		}
+		switch f := frame.(type) {
+		case *protocol.Trailer:
+			return f.Checksum, nil
+		case *protocol.Segment:
+			continue
+		default:
+			return "", fmt.Errorf("se esperaba el checksum del archivo, llegó %T", frame)
 		}
 	}
 }
+
+// receivedBytes estima los bytes recibidos a partir de los segmentos escritos.
+// Devuelve 0 si el header no informa el tamaño.
+func receivedBytes(header *protocol.Header, segments uint32) uint64 {
+	return min(uint64(segments)*protocol.SegmentSize, header.Size)
+}
+
+// sendHeaderAck confirma un header. name solo se envía si el archivo se renombró.
+func (s *Server) sendHeaderAck(conn net.Conn, seq uint32, status byte, name string) {
+	ack := &protocol.Ack{Type: protocol.TypeAckHeader, Seq: seq, Status: status, Name: name}
+	frame, err := ack.MarshalBinary()
+	if err != nil {
+		s.logf("Error encoding header ACK: %v", err)
+		return
+	}
+	if _, err := conn.Write(frame); err != nil {
+		s.logf("Error sending header ACK: %v", err)
+	}
+}
+
+// sendAck envía una confirmación al cliente.
+func (s *Server) sendAck(conn net.Conn, typ byte, seq uint32, status byte) {
+	ack := &protocol.Ack{Type: typ, Seq: seq, Status: status}
+	frame, err := ack.MarshalBinary()
+	if err != nil {
+		s.logf("Error encoding ACK: %v", err)
+		return
+	}
+	if _, err := conn.Write(frame); err != nil {
+		s.logf("Error sending ACK %d: %v", seq, err)
+	}
+}
+
+// sendReject le avisa al cliente que el archivo no se va a recibir.
+func (s *Server) sendReject(conn net.Conn, reason byte, message string) {
+	frame, err := (&protocol.Reject{Reason: reason, Message: rejectMessage(message)}).MarshalBinary()
+	if err != nil {
+		s.logf("Error encoding rejection: %v", err)
+		return
+	}
+	if _, err := conn.Write(frame); err != nil {
+		s.logf("Error sending rejection: %v", err)
+	}
+}
+
+// answerHello responde al HELLO del cliente con las capacidades del servidor y
+// devuelve la sesión negociada.
+func (s *Server) answerHello(conn net.Conn, hello *protocol.Hello) (protocol.Session, error) {
+	local := &protocol.Hello{
+		Type:      protocol.TypeHelloAck,
+		Version:   protocol.CurrentVersion,
+		Features:  protocol.SupportedFeatures,
+		MaxWindow: protocol.MaxWindowSize,
+		PeerName:  protocol.LocalPeerName(),
+	}
+	frame, err := local.MarshalBinary()
+	if err != nil {
+		return protocol.Session{}, err
+	}
+	if _, err := conn.Write(frame); err != nil {
+		return protocol.Session{}, err
+	}
+	return protocol.Negotiate(local, hello), nil
+}
@@ -1,58 +1,112 @@
 package server
 
 import (
-	"context"
-	"crypto/md5"
-	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"io"
-	"log"
 	"net"
 	"os"
 	"sort"
 
-	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"github.com/NeichS/final-redes-wails/internal/impair"
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+	"github.com/NeichS/final-redes-wails/internal/shared"
+	"github.com/NeichS/final-redes-wails/internal/stats"
 )
 
 type udpTransfer struct {
-	fileHandle   *os.File
-	checksum     string
-	totalSegs    uint32
+	fileName   string
+	filePath   string
+	fileHandle *os.File
+	// checksum viene en el paquete de inicio o, si el emisor lo calcula mientras
+	// envía, en el FIN; algorithm es el algoritmo con el que se calculó
+	checksum  string
+	algorithm string
+	totalSegs uint32
+	size      uint64
+	// bytes es la cantidad de bytes de datos recibidos, sin contar duplicados
+	bytes        uint64
+	mode         byte
+	done         bool
 	receivedData map[uint32][]byte
+	// attrs son la fecha y los permisos que se aplican al guardar el archivo
+	attrs fileAttrs
+	// stats mide la recepción; highest es la secuencia más alta recibida, para
+	// contar los segmentos que llegan desordenados
+	stats   *stats.Collector
+	highest uint32
+	// status y savedAs son el resultado de la política de colisiones que se le
+	// informa al emisor; pending indica que todavía se espera al usuario y
+	// declined que el usuario no aceptó el archivo.
+	status   byte
+	savedAs  string
+	pending  bool
+	declined bool
+	// existing es el archivo con el que se compara el contenido al terminar (ver
+	// discardIfIdentical)
+	existing string
 }
 
-func (s *Server) startUDPServer() {
-	addr, err := net.ResolveUDPAddr("udp", ":8080")
-	if err != nil {
-		log.Printf("Error UDP (Resolve): %v", err)
-		return
+// maxUDPFileSize es el tamaño máximo de un archivo recibido por UDP. El archivo
+// se guarda en memoria hasta el final, así que un inicio que declara más se rechaza.
+const maxUDPFileSize = 1 << 30
+
+// missing devuelve los números de secuencia (1..totalSegs) que todavía no
+// llegaron, hasta los que entran en un NAK.
+func (t *udpTransfer) missing() []uint32 {
+	var seqs []uint32
+	for seq := uint32(1); seq <= t.totalSegs && len(seqs) < protocol.MaxNakSegments; seq++ {
+		if _, ok := t.receivedData[seq]; !ok {
+			seqs = append(seqs, seq)
+		}
 	}
-	conn, err := net.ListenUDP("udp", addr)
-	if err != nil {
-		log.Printf("Error UDP (Listen): %v", err)
-		return
+	return seqs
+}
+
+// startAck arma la respuesta al paquete de inicio según el estado de la transferencia.
+func (t *udpTransfer) startAck() *protocol.UDPStartAck {
+	if t.pending {
+		return &protocol.UDPStartAck{Status: protocol.AckStatusPending}
+	}
+	ack := &protocol.UDPStartAck{Status: t.status}
+	if t.status == protocol.AckStatusRenamed {
+		ack.Name = t.savedAs
 	}
+	return ack
+}
 
-	s.udpConn = conn
-	defer conn.Close()
-	log.Println("Servidor UDP (simple) escuchando en :8080")
+// udpPacket es un datagrama ya decodificado junto con su emisor.
+type udpPacket struct {
+	addr   *net.UDPAddr
+	packet protocol.Frame
+}
 
-	// Mantenemos un mapa de las transferencias activas, identificadas por el nombre del archivo
-	activeTransfers := make(map[string]*udpTransfer)
-	buffer := make([]byte, 2048)
+// udpDecision lleva las respuestas del usuario (si acepta el archivo y qué hacer
+// si ya existe) de vuelta al bucle del servidor UDP, que es el único que toca las
+// transferencias. Un action vacío deja la decisión a la política de colisiones.
+type udpDecision struct {
+	sender   *net.UDPAddr
+	transfer *udpTransfer
+	dir      string
+	declined bool
+	action   string
+}
+
+// readUDPPackets lee y decodifica datagramas hasta que se cierra el socket.
+func (s *Server) readUDPPackets(conn net.PacketConn, packets chan<- udpPacket) {
+	defer close(packets)
+	buffer := make([]byte, protocol.MaxDatagramSize)
 
 	for {
-		n, _, err := conn.ReadFromUDP(buffer)
+		n, addr, err := conn.ReadFrom(buffer)
 		if err != nil {
 			// Si el error es por socket cerrado, salimos
 			if errors.Is(err, net.ErrClosed) {
-				log.Println("Servidor UDP detenido.")
+				s.logf("UDP server stopped.")
 				return
 			}
 			// Para otros errores, logueamos y seguimos (o salimos si es crítico)
-			log.Printf("Error leyendo UDP: %v", err)
+			s.logf("Error reading UDP: %v", err)
 			// Si el server ya no escucha, salimos
 			s.mu.Lock()
 			if !s.isListening {
@@ -63,96 +117,345 @@ func (s *Server) startUDPServer() {
 			continue
 		}
 
-		if s.IsDowntime() {
-			// Simular pérdida de paquetes: no procesamos nada
+		senderAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
 			continue
 		}
 
-		packetType := buffer[0]
-		packetData := buffer[:n]
+		packet, err := protocol.ParsePacket(buffer[:n])
+		if err != nil {
+			s.logf("UDP: invalid packet from %s: %v", senderAddr, err)
+			continue
+		}
+		packets <- udpPacket{addr: senderAddr, packet: packet}
+	}
+}
 
-		switch packetType {
-		case 1: // Paquete de INICIO
-			totalSegments := binary.BigEndian.Uint32(packetData[1:5])
-			nameLen := binary.BigEndian.Uint32(packetData[5:9])
-			checksumLen := binary.BigEndian.Uint32(packetData[9:13])
+func (s *Server) startUDPServer(conn *net.UDPConn) {
+	defer conn.Close()
 
-			endOfNames := 13 + nameLen
-			fileName := string(packetData[13:endOfNames])
-			receivedChecksum := string(packetData[endOfNames : endOfNames+checksumLen])
+	packets := make(chan udpPacket, 64)
+	decisions := make(chan udpDecision)
+	stopped := make(chan struct{})
+	defer close(stopped)
+	// Los datagramas que llegan pasan por el simulador de red
+	go s.readUDPPackets(impair.NewPacketReceiver(conn, &s.impairment, s.logger), packets)
 
-			log.Printf("UDP: Iniciando recepción de '%s'", fileName)
-			runtime.EventsEmit(s.ctx, "reception-started", fileName)
+	// Mantenemos un mapa de las transferencias activas, identificadas por la dirección del emisor
+	activeTransfers := make(map[string]*udpTransfer)
 
-			os.MkdirAll("./receive", 0755)
-			file, err := os.Create("./receive/" + fileName)
+	for {
+		var (
+			senderAddr *net.UDPAddr
+			packet     protocol.Frame
+		)
+		select {
+		case in, ok := <-packets:
+			if !ok {
+				return
+			}
+			senderAddr, packet = in.addr, in.packet
+		case d := <-decisions:
+			// El usuario respondió: si la transferencia sigue activa creamos el
+			// archivo y le avisamos al emisor
+			if activeTransfers[d.sender.String()] != d.transfer {
+				continue
+			}
+			if d.declined {
+				s.declineUDPTransfer(conn, d.sender, d.transfer)
+				continue
+			}
+			var (
+				place placement
+				err   error
+			)
+			if d.action == "" {
+				place, err = s.placeFile(d.dir, d.transfer.fileName, d.transfer.algorithm, d.transfer.checksum)
+			} else {
+				place, err = applyCollision(d.dir, d.transfer.fileName, d.action)
+			}
 			if err != nil {
-				log.Printf("UDP Error al crear archivo: %v", err)
+				s.rejectUDPStorage(conn, d.sender, d.transfer.fileName, err)
+				delete(activeTransfers, d.sender.String())
+				continue
+			}
+			s.placeUDPTransfer(d.transfer, place)
+			s.replyUDP(conn, d.sender, d.transfer.startAck())
+			continue
+		}
+		sender := senderAddr.String()
+		transfer := activeTransfers[sender]
+
+		switch p := packet.(type) {
+		case *protocol.UDPStart:
+			// Un inicio repetido de un archivo rechazado recibe otra vez el rechazo
+			if transfer != nil && transfer.declined && transfer.fileName == p.Name {
+				s.replyUDP(conn, senderAddr, &protocol.UDPReject{Reason: protocol.RejectDeclined, Message: declinedMessage})
+				continue
+			}
+			// Un inicio repetido (se perdió nuestro START-ACK) no reinicia la transferencia
+			if transfer != nil && !transfer.done && transfer.fileName == p.Name {
+				if transfer.mode == protocol.UDPReliable || transfer.pending || transfer.status != protocol.AckStatusOK {
+					s.replyUDP(conn, senderAddr, transfer.startAck())
+				}
+				continue
+			}
+			if transfer != nil && !transfer.done && transfer.fileHandle != nil {
+				transfer.fileHandle.Close()
+			}
+
+			dir := s.GetReceiveDir()
+			reason := protocol.RejectInvalidName
+			_, err := receivePath(dir, p.Name)
+			if err == nil && p.TotalSegments != protocol.Segments(p.Size, protocol.UDPSegmentSize) {
+				reason = protocol.RejectInvalidHeader
+				err = fmt.Errorf("el inicio de %s declara %d segmentos para %d bytes", p.Name, p.TotalSegments, p.Size)
+			}
+			if err == nil && (p.Size > maxUDPFileSize || p.TotalSegments > protocol.Segments(maxUDPFileSize, protocol.UDPSegmentSize)) {
+				reason = protocol.RejectInvalidHeader
+				err = fmt.Errorf("%s declara %d bytes y por UDP se aceptan hasta %d", p.Name, p.Size, maxUDPFileSize)
+			}
+			var algorithm string
+			if err == nil {
+				if algorithm, err = shared.NormalizeHash(p.HashAlgorithm); err != nil {
+					reason = protocol.RejectUnsupportedHash
+				}
+			}
+			if err != nil {
+				s.logf("UDP: rejecting file from %s: %v", sender, err)
+				s.emit("server-error", fmt.Sprintf("Archivo rechazado: %v", err))
+				delete(activeTransfers, sender)
+				s.replyUDP(conn, senderAddr, &protocol.UDPReject{Reason: reason, Message: rejectMessage(err.Error())})
+				continue
+			}
+
+			meta := shared.RemoteMetadata(p.Name, int64(p.Size), algorithm, p.Checksum)
+			s.logf("UDP: receiving '%s' (%s, %d bytes, %s) from %s", p.Name, meta.MIMEType(), p.Size, meta.HashAlgorithm(), sender)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				s.rejectUDPStorage(conn, senderAddr, p.Name, err)
+				delete(activeTransfers, sender)
 				continue
 			}
 
-			activeTransfers[fileName] = &udpTransfer{
-				fileHandle:   file,
-				checksum:     receivedChecksum,
-				totalSegs:    totalSegments,
+			transfer = &udpTransfer{
+				fileName:     p.Name,
+				checksum:     p.Checksum,
+				algorithm:    algorithm,
+				totalSegs:    p.TotalSegments,
+				size:         p.Size,
+				mode:         p.Mode,
 				receivedData: make(map[uint32][]byte),
+				attrs:        attrsFrom(p.ModTime, p.Perm),
+				stats:        stats.New(p.Name, p.Size, 0),
 			}
+			activeTransfers[sender] = transfer
 
-		case 2: // data
-			seqNum := binary.BigEndian.Uint32(packetData[1:5])
-			for _, transfer := range activeTransfers {
-				dataCopy := make([]byte, len(packetData[5:]))
-				copy(dataCopy, packetData[5:])
-				transfer.receivedData[seqNum] = dataCopy
+			// En UDP no hay oferta: cada archivo se acepta por separado
+			host := senderAddr.IP.String()
+			offered := []protocol.OfferedFile{{Name: p.Name, Size: p.Size}}
+			needsApproval := !s.GetAutoAccept() && !s.approved(host, offered)
+			if needsApproval || s.needsAnswer(dir, p.Name) {
+				// No bloqueamos el bucle mientras el usuario decide; el emisor
+				// espera hasta recibir la respuesta definitiva
+				transfer.pending = true
+				s.replyUDP(conn, senderAddr, transfer.startAck())
+				go func(t *udpTransfer, addr *net.UDPAddr) {
+					d := udpDecision{sender: addr, transfer: t, dir: dir}
+					if needsApproval && !s.approveTransfer(host, "", offered) {
+						d.declined = true
+					} else if s.needsAnswer(dir, t.fileName) {
+						d.action = s.askCollision(dir, t.fileName)
+					}
+					select {
+					case decisions <- d:
+					case <-stopped:
+					}
+				}(transfer, senderAddr)
+				continue
+			}
 
-				runtime.EventsEmit(s.ctx, "receiving-file-progress", map[string]interface{}{
-					"received": len(transfer.receivedData),
-					"total":    transfer.totalSegs,
-				})
-				break
+			place, err := s.placeFile(dir, p.Name, algorithm, p.Checksum)
+			if err != nil {
+				s.rejectUDPStorage(conn, senderAddr, p.Name, err)
+				delete(activeTransfers, sender)
+				continue
+			}
+			s.placeUDPTransfer(transfer, place)
+			// En el modo simple solo contestamos si hay algo que informar
+			if p.Mode == protocol.UDPReliable || transfer.status != protocol.AckStatusOK {
+				s.replyUDP(conn, senderAddr, transfer.startAck())
 			}
 
-		case 3: // fin
-			for fileName, transfer := range activeTransfers {
-				log.Printf("UDP: Finalizando recepción de '%s'", fileName)
-				runtime.EventsEmit(s.ctx, "reception-finished", fileName)
-				keys := make([]int, 0, len(transfer.receivedData))
-				for k := range transfer.receivedData {
-					keys = append(keys, int(k))
-				}
-				sort.Ints(keys)
+		case *protocol.UDPData: // data
+			if transfer == nil || transfer.done {
+				continue
+			}
+			if p.Seq == 0 || p.Seq > transfer.totalSegs {
+				// Fuera del rango que anunció el inicio
+				continue
+			}
+			transfer.stats.Transferred(len(p.Data))
+			if snapshot, ok := transfer.stats.Due(); ok {
+				s.emit("receiving-file-stats", snapshot)
+			}
+			if !p.Valid() {
+				// Queda como faltante: en el modo fiable el NAK lo vuelve a pedir
+				s.logf("UDP: segment %d of '%s' is corrupt, discarding it", p.Seq, transfer.fileName)
+				transfer.stats.Corrupt()
+				continue
+			}
+			if transfer.mode == protocol.UDPReliable {
+				// También los duplicados: el emisor regula su ritmo con estos ACKs
+				s.replyUDP(conn, senderAddr, &protocol.UDPAck{Seq: p.Seq})
+			}
+			if _, dup := transfer.receivedData[p.Seq]; dup {
+				transfer.stats.Duplicate()
+				continue
+			}
+			if p.Seq < transfer.highest {
+				transfer.stats.OutOfOrder()
+			}
+			transfer.highest = max(transfer.highest, p.Seq)
+			transfer.receivedData[p.Seq] = p.Data
+			transfer.bytes += uint64(len(p.Data))
+			transfer.stats.Delivered(len(p.Data))
 
-				for _, k := range keys {
-					transfer.fileHandle.Write(transfer.receivedData[uint32(k)])
-				}
-				transfer.fileHandle.Close()
+			s.emit("receiving-file-progress", map[string]interface{}{
+				"received":   len(transfer.receivedData),
+				"total":      transfer.totalSegs,
+				"bytes":      transfer.bytes,
+				"totalBytes": transfer.size,
+			})
+
+		case *protocol.UDPEnd: // fin
+			if transfer == nil || transfer.pending {
+				continue
+			}
+			if transfer.done {
+				// Se perdió nuestra confirmación final, la repetimos
+				s.replyUDP(conn, senderAddr, &protocol.UDPComplete{})
+				continue
+			}
+			if transfer.checksum == "" {
+				transfer.checksum = p.Checksum
+			}
 
-				verifyUDPChecksum(s.ctx, fileName, transfer.checksum)
+			if transfer.mode == protocol.UDPReliable {
+				if missing := transfer.missing(); len(missing) > 0 {
+					s.logf("UDP: %d segments of '%s' missing, sending NAK", len(missing), transfer.fileName)
+					s.replyUDP(conn, senderAddr, &protocol.UDPNak{Missing: missing})
+					continue
+				}
+			}
 
-				delete(activeTransfers, fileName)
-				break
+			s.finishUDPTransfer(transfer)
+			if transfer.mode == protocol.UDPReliable {
+				// Conservamos la transferencia terminada para responder a FINs repetidos
+				s.replyUDP(conn, senderAddr, &protocol.UDPComplete{})
+			} else {
+				delete(activeTransfers, sender)
 			}
 		}
 	}
 }
 
-func verifyUDPChecksum(ctx context.Context, fileName, receivedChecksum string) {
-	file, err := os.Open("./receive/" + fileName)
+// placeUDPTransfer aplica a la transferencia el destino elegido para el archivo,
+// una vez aceptado.
+// Un archivo omitido queda como terminado para responder a los FINs que sigan llegando.
+func (s *Server) placeUDPTransfer(transfer *udpTransfer, place placement) {
+	s.emit("reception-started", transfer.fileName)
+	transfer.pending = false
+	transfer.status = place.status
+	transfer.savedAs = place.name
+	transfer.filePath = place.path
+	transfer.fileHandle = place.file
+	transfer.existing = place.existing
+	if msg := collisionMessage(place, transfer.fileName); msg != "" {
+		s.logf("UDP: %s", collisionLog(place, transfer.fileName))
+		s.emit("reception-finished", msg)
+	}
+	if place.status == protocol.AckStatusSkipped {
+		transfer.done = true
+		transfer.receivedData = nil
+	}
+}
+
+// declineUDPTransfer le avisa al emisor que el usuario no aceptó el archivo. La
+// transferencia queda registrada para repetir el rechazo si el inicio se reenvía.
+func (s *Server) declineUDPTransfer(conn *net.UDPConn, addr *net.UDPAddr, transfer *udpTransfer) {
+	s.logf("UDP: '%s' from %s declined by the user", transfer.fileName, addr)
+	s.emit("server-error", fmt.Sprintf("Archivo %s de %s rechazado.", transfer.fileName, addr.IP))
+	transfer.pending = false
+	transfer.declined = true
+	transfer.done = true
+	transfer.receivedData = nil
+	s.replyUDP(conn, addr, &protocol.UDPReject{Reason: protocol.RejectDeclined, Message: declinedMessage})
+}
+
+// rejectUDPStorage le avisa al emisor que no se pudo crear el archivo name.
+func (s *Server) rejectUDPStorage(conn *net.UDPConn, addr *net.UDPAddr, name string, err error) {
+	s.logf("UDP: error creating '%s': %v", name, err)
+	s.emit("server-error", fmt.Sprintf("No se pudo crear %s: %v", name, err))
+	s.replyUDP(conn, addr, &protocol.UDPReject{Reason: protocol.RejectStorage, Message: rejectMessage(err.Error())})
+}
+
+// replyUDP envía un paquete de control al emisor de una transferencia.
+func (s *Server) replyUDP(conn *net.UDPConn, addr *net.UDPAddr, packet protocol.Frame) {
+	b, err := packet.MarshalBinary()
 	if err != nil {
-		log.Printf("UDP Checksum: No se pudo abrir el archivo: %v", err)
+		s.logf("UDP: error encoding reply: %v", err)
 		return
 	}
-	defer file.Close()
-
-	hash := md5.New()
-	io.Copy(hash, file)
-	calculatedChecksum := hex.EncodeToString(hash.Sum(nil))
-
-	if receivedChecksum == calculatedChecksum {
-		log.Println("UDP Checksum OK!")
-		runtime.EventsEmit(ctx, "reception-finished", fmt.Sprintf("✅ ¡%s (UDP) recibido y verificado!", fileName))
-	} else {
-		log.Println("UDP CHECKSUM ERROR!")
-		runtime.EventsEmit(ctx, "server-error", fmt.Sprintf("❌ Error de checksum en %s (UDP).", fileName))
+	if _, err := conn.WriteToUDP(b, addr); err != nil {
+		s.logf("UDP: error replying to %s: %v", addr, err)
+	}
+}
+
+// finishUDPTransfer escribe en orden los segmentos recibidos, calculando el
+// checksum a medida que los escribe, y lo verifica. Solo un archivo verificado
+// toma su nombre definitivo.
+func (s *Server) finishUDPTransfer(transfer *udpTransfer) {
+	s.logf("UDP: finishing reception of '%s'", transfer.fileName)
+	keys := make([]int, 0, len(transfer.receivedData))
+	for k := range transfer.receivedData {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+
+	hasher, _ := shared.NewHash(transfer.algorithm)
+	for _, k := range keys {
+		data := transfer.receivedData[uint32(k)]
+		transfer.fileHandle.Write(data)
+		hasher.Write(data)
+	}
+	transfer.fileHandle.Close()
+	transfer.receivedData = nil
+	transfer.done = true
+	summary := transfer.stats.Summary()
+	s.logf("UDP: stats for '%s': %v", transfer.fileName, summary)
+	s.emit("receiving-file-summary", summary)
+
+	place := placement{path: transfer.filePath, existing: transfer.existing}
+	if transfer.bytes != transfer.size {
+		s.logf("UDP: '%s' is incomplete: %d of %d bytes", transfer.fileName, transfer.bytes, transfer.size)
+		s.emit("server-error", fmt.Sprintf("❌ %s (UDP) llegó incompleto: %d de %d bytes. %s", transfer.fileName, transfer.bytes, transfer.size, s.discardCorrupt(place)))
+		return
+	}
+
+	if transfer.checksum != hex.EncodeToString(hasher.Sum(nil)) {
+		s.logf("UDP: CHECKSUM MISMATCH! File is corrupted.")
+		s.emit("server-error", fmt.Sprintf("❌ Error de checksum en %s (UDP). %s", transfer.fileName, s.discardCorrupt(place)))
+		return
+	}
+	s.logf("UDP: checksums match! File is intact.")
+	if s.discardIfIdentical(place, transfer.algorithm, transfer.checksum) {
+		s.emit("reception-finished", duplicateMessage(transfer.fileName))
+		return
+	}
+	if err := s.commitFile(place, transfer.attrs); err != nil {
+		s.logf("UDP: error renaming %s: %v", partPath(transfer.filePath), err)
+		s.emit("server-error", fmt.Sprintf("❌ No se pudo guardar %s: %v", transfer.savedAs, err))
+		return
 	}
+	s.emit("reception-finished", fmt.Sprintf("✅ ¡%s (UDP) recibido y verificado!", transfer.fileName))
 }
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/NeichS/final-redes-wails/internal/protocol"
+)
+
+// Qué hacer con un archivo que no pasa la verificación final.
+const (
+	MismatchQuarantine = "quarantine"
+	MismatchDelete     = "delete"
+)
+
+// Subcarpeta de la carpeta de descarga donde se guardan los archivos dañados.
+const quarantineDir = "quarantine"
+
+// Los archivos se reciben con esta extensión y solo toman su nombre definitivo
+// cuando se verifican.
+const partSuffix = ".part"
+
+// partPath devuelve el archivo temporal en el que se recibe el archivo path.
+func partPath(path string) string {
+	return path + partSuffix
+}
+
+// SetMismatchAction elige qué hacer con los archivos que llegan dañados.
+func (s *Server) SetMismatchAction(action string) error {
+	switch action {
+	case MismatchQuarantine, MismatchDelete:
+	default:
+		return fmt.Errorf("acción desconocida para archivos dañados: %q", action)
+	}
+	s.settingsMu.Lock()
+	s.mismatchAction = action
+	s.settingsMu.Unlock()
+	return nil
+}
+
+// GetMismatchAction devuelve la acción actual; por defecto los archivos dañados
+// se conservan en cuarentena para poder inspeccionarlos.
+func (s *Server) GetMismatchAction() string {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	if s.mismatchAction == "" {
+		return MismatchQuarantine
+	}
+	return s.mismatchAction
+}
+
+// fileAttrs son la fecha de modificación y los permisos que informó el emisor.
+// Los valores en cero no se conocen y no se aplican.
+type fileAttrs struct {
+	modTime time.Time
+	perm    os.FileMode
+}
+
+// attrsFrom arma los atributos con los campos del header o del inicio UDP.
+func attrsFrom(modTime int64, perm uint32) fileAttrs {
+	attrs := fileAttrs{perm: os.FileMode(perm) & os.ModePerm}
+	if modTime != 0 {
+		attrs.modTime = time.Unix(0, modTime)
+	}
+	return attrs
+}
+
+// commitFile le da al archivo recibido su nombre definitivo, con la fecha y los
+// permisos del original. Si reemplaza a otro, el anterior se conserva intacto
+// hasta este momento. No poder aplicar los atributos no impide guardarlo.
+func (s *Server) commitFile(p placement, attrs fileAttrs) error {
+	part := partPath(p.path)
+	if attrs.perm != 0 {
+		// El dueño siempre puede leerlo y reemplazarlo: las políticas de
+		// colisión tienen que poder compararlo y sobrescribirlo después
+		if err := os.Chmod(part, attrs.perm|0600); err != nil {
+			s.logf("Error setting permissions of %s: %v", part, err)
+		}
+	}
+	if !attrs.modTime.IsZero() {
+		if err := os.Chtimes(part, time.Time{}, attrs.modTime); err != nil {
+			s.logf("Error setting modification time of %s: %v", part, err)
+		}
+	}
+	return os.Rename(part, p.path)
+}
+
+// discardCorrupt aplica la acción elegida a un archivo que no pasó la
+// verificación y devuelve un mensaje que describe qué se hizo con él.
+func (s *Server) discardCorrupt(p placement) string {
+	part := partPath(p.path)
+	if s.GetMismatchAction() == MismatchDelete {
+		if err := os.Remove(part); err != nil {
+			s.logf("Error removing corrupt file %s: %v", part, err)
+		}
+		return "Se descartó el archivo."
+	}
+	dest, err := quarantine(part, filepath.Base(p.path))
+	if err != nil {
+		s.logf("Error quarantining %s: %v", part, err)
+		return fmt.Sprintf("Quedó como %s.", filepath.Base(part))
+	}
+	s.logf("Corrupt file moved to %s", dest)
+	return fmt.Sprintf("Se movió a %s.", filepath.Join(quarantineDir, filepath.Base(dest)))
+}
+
+// quarantine mueve el archivo part a la carpeta de cuarentena con el nombre name,
+// o "name (n).ext" si ya hay uno con ese nombre. Devuelve la ruta final.
+func quarantine(part, name string) (string, error) {
+	dir := filepath.Join(filepath.Dir(part), quarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	candidate := name
+	for n := 1; n <= maxRenameAttempts; n++ {
+		dest := filepath.Join(dir, candidate)
+		if _, err := os.Lstat(dest); os.IsNotExist(err) {
+			return dest, os.Rename(part, dest)
+		}
+		candidate = fmt.Sprintf("%s (%d)%s", stem, n, ext)
+	}
+	return "", fmt.Errorf("no hay un nombre libre para %s en %s", name, dir)
+}
+
+// sendVerify le informa al emisor el resultado de la verificación, si lo negoció.
+func (s *Server) sendVerify(conn net.Conn, session protocol.Session, result byte, message string) {
+	if !session.Has(protocol.FeatureVerify) {
+		return
+	}
+	frame, err := (&protocol.Verify{Result: result, Message: rejectMessage(message)}).MarshalBinary()
+	if err != nil {
+		s.logf("Error encoding verification result: %v", err)
+		return
+	}
+	if _, err := conn.Write(frame); err != nil {
+		s.logf("Error sending verification result: %v", err)
+	}
+}
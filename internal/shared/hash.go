@@ -0,0 +1,75 @@
+package shared
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Algoritmos de hash con los que se puede verificar un archivo.
+const (
+	HashMD5     = "md5"
+	HashSHA256  = "sha256"
+	HashBLAKE2b = "blake2b"
+	HashXXH64   = "xxh64"
+)
+
+// DefaultHash es el algoritmo que se usa si no se elige otro, y el único que
+// entienden los pares que no negocian algoritmos.
+const DefaultHash = HashMD5
+
+// hashes registra cómo crear cada algoritmo. MD5 y xxHash64 son rápidos pero no
+// resisten manipulación intencional; SHA-256 y BLAKE2b-256 sí.
+var hashes = map[string]func() hash.Hash{
+	HashMD5:    md5.New,
+	HashSHA256: sha256.New,
+	HashBLAKE2b: func() hash.Hash {
+		// Sin clave New256 no puede fallar
+		h, _ := blake2b.New256(nil)
+		return h
+	},
+	HashXXH64: func() hash.Hash { return xxhash.New() },
+}
+
+// HashAlgorithms devuelve los algoritmos disponibles, del más compatible al más rápido.
+func HashAlgorithms() []string {
+	return []string{HashMD5, HashSHA256, HashBLAKE2b, HashXXH64}
+}
+
+// NormalizeHash devuelve el nombre canónico del algoritmo; el vacío es DefaultHash.
+func NormalizeHash(algorithm string) (string, error) {
+	if algorithm == "" {
+		return DefaultHash, nil
+	}
+	if _, ok := hashes[algorithm]; !ok {
+		return "", fmt.Errorf("algoritmo de hash desconocido: %q", algorithm)
+	}
+	return algorithm, nil
+}
+
+// NewHash crea el hash del algoritmo indicado; el vacío es DefaultHash.
+func NewHash(algorithm string) (hash.Hash, error) {
+	algorithm, err := NormalizeHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return hashes[algorithm](), nil
+}
+
+// Checksum calcula el checksum en hexadecimal de todo lo que se lee de r.
+func Checksum(r io.Reader, algorithm string) (string, error) {
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
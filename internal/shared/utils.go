@@ -1,35 +1,95 @@
 package shared
 
 import (
-	"log"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
 	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NeichS/final-redes-wails/internal/protocol"
 )
 
+// Tipo MIME de los archivos cuyo contenido no se reconoce.
+const defaultMIMEType = "application/octet-stream"
+
+// MetaData describe un archivo a transferir. El emisor la arma a partir del
+// archivo en disco; el receptor, con lo que viaja en el protocolo.
 type MetaData struct {
-	name     string
-	fileSize int64
-	reps     uint32
-	Checksum string
+	name          string
+	fileSize      int64
+	reps          uint32
+	modTime       time.Time
+	mode          os.FileMode
+	mimeType      string
+	hashAlgorithm string
+	Checksum      string
 }
 
-func NewMetadata(file *os.File, baseName, checksum string) MetaData {
+// NewMetadata describe un archivo abierto para enviar, con su checksum calculado
+// con algorithm. Devuelve un error si no se puede leer su información o si no es
+// un archivo regular.
+func NewMetadata(file *os.File, baseName, algorithm, checksum string) (MetaData, error) {
 	fileInfo, err := file.Stat()
 	if err != nil {
-		log.Fatal(err)
+		return MetaData{}, fmt.Errorf("no se pudo leer la información de %s: %w", baseName, err)
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return MetaData{}, fmt.Errorf("%s no es un archivo regular", baseName)
 	}
 
 	size := fileInfo.Size()
 
 	header := MetaData{
-		name:     baseName,
-		fileSize: size,
-		reps:     uint32(size/1014) + 1,
-		Checksum: checksum,
+		name:          baseName,
+		fileSize:      size,
+		reps:          protocol.Segments(uint64(size), protocol.SegmentSize),
+		modTime:       fileInfo.ModTime(),
+		mode:          fileInfo.Mode().Perm(),
+		mimeType:      detectMIMEType(file, baseName),
+		hashAlgorithm: algorithm,
+		Checksum:      checksum,
 	}
 
-	return header
+	return header, nil
+}
+
+// RemoteMetadata describe un archivo anunciado por el otro extremo, con el tipo
+// MIME que sale de la extensión. No incluye la fecha ni los permisos: el
+// receptor los aplica directamente desde el header al guardar el archivo.
+func RemoteMetadata(name string, size int64, algorithm, checksum string) MetaData {
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+	if mimeType == "" {
+		mimeType = defaultMIMEType
+	}
+	return MetaData{
+		name:          name,
+		fileSize:      size,
+		reps:          protocol.Segments(uint64(size), protocol.SegmentSize),
+		mimeType:      mimeType,
+		hashAlgorithm: algorithm,
+		Checksum:      checksum,
+	}
 }
 
+// detectMIMEType usa la extensión del nombre y, si no la reconoce, los primeros
+// bytes del archivo. No mueve la posición de lectura.
+func detectMIMEType(file *os.File, name string) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(name)); mimeType != "" {
+		return mimeType
+	}
+	head := make([]byte, 512)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return defaultMIMEType
+	}
+	if n == 0 {
+		return defaultMIMEType
+	}
+	return http.DetectContentType(head[:n])
+}
 
 func (m *MetaData) Name() string {
 	return m.name
@@ -38,10 +98,29 @@ func (m *MetaData) Name() string {
 func (m *MetaData) FileSize() int64 {
 	return m.fileSize
 }
+
 func (m *MetaData) Reps() uint32 {
 	return m.reps
 }
 
+// ModTime devuelve la fecha de modificación; es cero si no se conoce.
+func (m *MetaData) ModTime() time.Time {
+	return m.modTime
+}
+
+// Mode devuelve los permisos del archivo; es cero si no se conocen.
+func (m *MetaData) Mode() os.FileMode {
+	return m.mode
+}
+
+func (m *MetaData) MIMEType() string {
+	return m.mimeType
+}
+
+func (m *MetaData) HashAlgorithm() string {
+	return m.hashAlgorithm
+}
+
 func (m *MetaData) GetChecksum() string {
 	return m.Checksum
 }
@@ -0,0 +1,181 @@
+// Package stats mide una transferencia mientras ocurre: cuántos bytes por
+// segundo pasan por el enlace y cuántos le sirven al receptor, cuánto falta,
+// el RTT y los eventos del ARQ (retransmisiones, timeouts, duplicados,
+// segmentos desordenados o dañados). Emisor y receptor usan un Collector por
+// archivo; cada lado registra lo que puede observar.
+//
+// Un Collector no es seguro para usar desde varias goroutines: lo actualiza el
+// bucle de la transferencia, que también decide cuándo informarlo (ver Due).
+package stats
+
+import (
+	"fmt"
+	"time"
+)
+
+// Interval es cada cuánto Due devuelve una foto para informar.
+const Interval = 500 * time.Millisecond
+
+// Snapshot es el estado de una transferencia en un momento dado. Los RTT solo
+// los mide el emisor; en cero no se midieron.
+type Snapshot struct {
+	File       string `json:"file"`
+	Bytes      uint64 `json:"bytes"`
+	TotalBytes uint64 `json:"totalBytes"`
+	ElapsedMs  int64  `json:"elapsedMs"`
+	// ThroughputBps cuenta todos los bytes de datos que pasaron por el enlace,
+	// retransmisiones y duplicados incluidos; GoodputBps solo los útiles. Los
+	// dos son promedios desde el inicio y CurrentBps es el goodput del último
+	// intervalo.
+	ThroughputBps float64 `json:"throughputBps"`
+	GoodputBps    float64 `json:"goodputBps"`
+	CurrentBps    float64 `json:"currentBps"`
+	// EtaMs es el tiempo restante estimado con el ritmo actual; -1 si todavía
+	// no se puede estimar.
+	EtaMs           int64   `json:"etaMs"`
+	RTTMinMs        float64 `json:"rttMinMs,omitempty"`
+	RTTAvgMs        float64 `json:"rttAvgMs,omitempty"`
+	RTTMaxMs        float64 `json:"rttMaxMs,omitempty"`
+	Retransmissions uint64  `json:"retransmissions"`
+	Timeouts        uint64  `json:"timeouts"`
+	Duplicates      uint64  `json:"duplicates"`
+	OutOfOrder      uint64  `json:"outOfOrder"`
+	Corrupt         uint64  `json:"corrupt"`
+	// Done indica que es el resumen final de la transferencia.
+	Done bool `json:"done"`
+}
+
+// String resume la foto en una línea, para el log y la terminal.
+func (s Snapshot) String() string {
+	text := fmt.Sprintf("%s/s útiles (%s/s en el enlace) en %.1f s", FormatSize(s.GoodputBps), FormatSize(s.ThroughputBps), float64(s.ElapsedMs)/1000)
+	if s.RTTAvgMs > 0 {
+		text += fmt.Sprintf(", RTT %.1f/%.1f/%.1f ms", s.RTTMinMs, s.RTTAvgMs, s.RTTMaxMs)
+	}
+	return text + fmt.Sprintf(", %d retransmisiones, %d timeouts, %d duplicados, %d desordenados, %d dañados",
+		s.Retransmissions, s.Timeouts, s.Duplicates, s.OutOfOrder, s.Corrupt)
+}
+
+// Collector acumula las estadísticas de un archivo.
+type Collector struct {
+	file       string
+	totalBytes uint64
+	// resumed son los bytes que el receptor ya tenía al empezar; no cuentan
+	// para los promedios
+	resumed uint64
+	start   time.Time
+	now     func() time.Time
+
+	delivered, transferred uint64
+	rttCount               int
+	rttSum, rttMin, rttMax time.Duration
+
+	retransmissions, timeouts, duplicates, outOfOrder, corrupt uint64
+
+	// Estado del último informe, para el ritmo actual
+	lastAt    time.Time
+	lastBytes uint64
+	current   float64
+}
+
+// New empieza a medir la transferencia de file, de totalBytes bytes de los
+// cuales el receptor ya tiene resumed.
+func New(file string, totalBytes, resumed uint64) *Collector {
+	return newCollector(file, totalBytes, resumed, time.Now)
+}
+
+func newCollector(file string, totalBytes, resumed uint64, now func() time.Time) *Collector {
+	start := now()
+	return &Collector{file: file, totalBytes: totalBytes, resumed: resumed, start: start, now: now, lastAt: start, current: -1}
+}
+
+// Transferred registra n bytes de datos que pasaron por el enlace.
+func (c *Collector) Transferred(n int) { c.transferred += uint64(n) }
+
+// Delivered registra n bytes que el receptor tiene por primera vez.
+func (c *Collector) Delivered(n int) { c.delivered += uint64(n) }
+
+// RTT registra una medición del RTT.
+func (c *Collector) RTT(rtt time.Duration) {
+	if c.rttCount == 0 || rtt < c.rttMin {
+		c.rttMin = rtt
+	}
+	c.rttMax = max(c.rttMax, rtt)
+	c.rttSum += rtt
+	c.rttCount++
+}
+
+func (c *Collector) Retransmission() { c.retransmissions++ }
+func (c *Collector) Timeout()        { c.timeouts++ }
+func (c *Collector) Duplicate()      { c.duplicates++ }
+func (c *Collector) OutOfOrder()     { c.outOfOrder++ }
+func (c *Collector) Corrupt()        { c.corrupt++ }
+
+// Due devuelve una foto si pasó Interval desde el informe anterior.
+func (c *Collector) Due() (Snapshot, bool) {
+	now := c.now()
+	if now.Sub(c.lastAt) < Interval {
+		return Snapshot{}, false
+	}
+	c.current = float64(c.delivered-c.lastBytes) / now.Sub(c.lastAt).Seconds()
+	c.lastAt, c.lastBytes = now, c.delivered
+	return c.snapshot(now), true
+}
+
+// Summary devuelve el resumen final.
+func (c *Collector) Summary() Snapshot {
+	s := c.snapshot(c.now())
+	s.Done = true
+	s.EtaMs = 0
+	return s
+}
+
+func (c *Collector) snapshot(now time.Time) Snapshot {
+	elapsed := now.Sub(c.start)
+	s := Snapshot{
+		File:            c.file,
+		Bytes:           min(c.resumed+c.delivered, c.totalBytes),
+		TotalBytes:      c.totalBytes,
+		ElapsedMs:       elapsed.Milliseconds(),
+		EtaMs:           -1,
+		Retransmissions: c.retransmissions,
+		Timeouts:        c.timeouts,
+		Duplicates:      c.duplicates,
+		OutOfOrder:      c.outOfOrder,
+		Corrupt:         c.corrupt,
+	}
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		s.ThroughputBps = float64(c.transferred) / seconds
+		s.GoodputBps = float64(c.delivered) / seconds
+	}
+	s.CurrentBps = max(c.current, 0)
+	if c.current > 0 {
+		s.EtaMs = int64(float64(s.TotalBytes-s.Bytes) / c.current * 1000)
+	} else if s.Bytes == s.TotalBytes {
+		s.EtaMs = 0
+	}
+	if c.rttCount > 0 {
+		s.RTTMinMs = ms(c.rttMin)
+		s.RTTAvgMs = ms(c.rttSum / time.Duration(c.rttCount))
+		s.RTTMaxMs = ms(c.rttMax)
+	}
+	return s
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// FormatSize escribe una cantidad de bytes con la unidad más grande que la
+// deja en al menos 1 (por ejemplo "512 B" o "1.5 MB").
+func FormatSize(bytes float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", bytes, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
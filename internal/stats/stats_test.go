@@ -0,0 +1,91 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+// clock es un reloj que avanza solo cuando la prueba lo indica.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestCollector(total, resumed uint64) (*Collector, *clock) {
+	clk := &clock{t: time.Unix(1000, 0)}
+	return newCollector("a.bin", total, resumed, clk.now), clk
+}
+
+func TestRatesAndETA(t *testing.T) {
+	c, clk := newTestCollector(10000, 0)
+	if _, ok := c.Due(); ok {
+		t.Fatal("Due informó antes de que pasara el intervalo")
+	}
+
+	// En un segundo pasan 3000 bytes por el enlace y 2000 son útiles
+	c.Transferred(3000)
+	c.Delivered(2000)
+	clk.advance(time.Second)
+	s, ok := c.Due()
+	if !ok {
+		t.Fatal("Due no informó después del intervalo")
+	}
+	if s.ThroughputBps != 3000 || s.GoodputBps != 2000 || s.CurrentBps != 2000 {
+		t.Errorf("throughput %v, goodput %v, actual %v; se esperaban 3000, 2000 y 2000", s.ThroughputBps, s.GoodputBps, s.CurrentBps)
+	}
+	// Faltan 8000 bytes a 2000 por segundo
+	if s.EtaMs != 4000 {
+		t.Errorf("ETA %d ms, se esperaban 4000", s.EtaMs)
+	}
+
+	// El ritmo actual es el del último intervalo y el promedio, desde el inicio
+	c.Delivered(4000)
+	clk.advance(time.Second)
+	s, _ = c.Due()
+	if s.CurrentBps != 4000 || s.GoodputBps != 3000 || s.EtaMs != 1000 {
+		t.Errorf("actual %v, goodput %v, ETA %d; se esperaban 4000, 3000 y 1000", s.CurrentBps, s.GoodputBps, s.EtaMs)
+	}
+	if _, ok := c.Due(); ok {
+		t.Error("Due informó dos veces en el mismo intervalo")
+	}
+
+	c.Delivered(4000)
+	sum := c.Summary()
+	if !sum.Done || sum.EtaMs != 0 || sum.Bytes != 10000 {
+		t.Errorf("resumen %+v, se esperaba terminado con los 10000 bytes", sum)
+	}
+}
+
+func TestResumedBytesDoNotCountForRates(t *testing.T) {
+	c, clk := newTestCollector(10000, 6000)
+	c.Delivered(1000)
+	clk.advance(time.Second)
+	s, _ := c.Due()
+	if s.Bytes != 7000 || s.GoodputBps != 1000 || s.EtaMs != 3000 {
+		t.Errorf("bytes %d, goodput %v, ETA %d; se esperaban 7000, 1000 y 3000", s.Bytes, s.GoodputBps, s.EtaMs)
+	}
+}
+
+func TestRTTAndCounters(t *testing.T) {
+	c, _ := newTestCollector(100, 0)
+	if s := c.Summary(); s.RTTAvgMs != 0 {
+		t.Errorf("RTT promedio %v sin mediciones, se esperaba 0", s.RTTAvgMs)
+	}
+	for _, rtt := range []time.Duration{4, 2, 6} {
+		c.RTT(rtt * time.Millisecond)
+	}
+	c.Retransmission()
+	c.Retransmission()
+	c.Timeout()
+	c.Duplicate()
+	c.OutOfOrder()
+	c.Corrupt()
+
+	s := c.Summary()
+	if s.RTTMinMs != 2 || s.RTTAvgMs != 4 || s.RTTMaxMs != 6 {
+		t.Errorf("RTT %v/%v/%v ms, se esperaba 2/4/6", s.RTTMinMs, s.RTTAvgMs, s.RTTMaxMs)
+	}
+	if s.Retransmissions != 2 || s.Timeouts != 1 || s.Duplicates != 1 || s.OutOfOrder != 1 || s.Corrupt != 1 {
+		t.Errorf("contadores %+v", s)
+	}
+}
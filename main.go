@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"embed"
+	"os"
 
 	"github.com/NeichS/final-redes-wails/internal/app"
+	"github.com/NeichS/final-redes-wails/internal/cli"
 	client "github.com/NeichS/final-redes-wails/internal/client"
 	sv "github.com/NeichS/final-redes-wails/internal/server"
 	"github.com/wailsapp/wails/v2"
@@ -17,6 +19,11 @@ import (
 var assets embed.FS
 
 func main() {
+	// Con un subcomando (send, receive) se trabaja desde la terminal, sin ventana
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	// Create an instance of the app structure
 	app := app.NewApp()
 	server := &sv.Server{}